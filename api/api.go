@@ -0,0 +1,278 @@
+// Package api implements the HTTP and public gRPC APIs used by applications
+// to read and write the cache
+package api
+
+import (
+	"NexusCache/nexuscache"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// NewHandler returns the HTTP API served by svr. Requests address the group
+// named by their "group" parameter, defaultGroup when it is absent.
+func NewHandler(defaultGroup *nexuscache.Group, svr *nexuscache.Server) http.Handler {
+	lookupGroup := func(w http.ResponseWriter, r *http.Request) (*nexuscache.Group, bool) {
+		name := r.FormValue("group")
+		if name == "" {
+			return defaultGroup, true
+		}
+		g := nexuscache.GetGroup(name)
+		if g == nil {
+			http.Error(w, fmt.Sprintf("unknown group %q", name), http.StatusNotFound)
+			return nil, false
+		}
+		return g, true
+	}
+
+	getHandle := func(w http.ResponseWriter, r *http.Request) {
+		group, ok := lookupGroup(w, r)
+		if !ok {
+			return
+		}
+		key := r.URL.Query().Get("key")
+		view, err := group.Get(key)
+		if err != nil {
+			if err == context.DeadlineExceeded {
+				// If timeout, the remote node is unavailable
+				// Remove the node from hash ring and request from database
+				svr.RemovePeerByKey(key)
+				view, err = group.Load(key)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set("Content-Type", "application/octet-stream")
+				value := fmt.Sprintf("value=%v\n", string(view.ByteSlice()))
+				w.Write([]byte(value))
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("X-Cache-Version", strconv.FormatUint(view.Version(), 10))
+		value := fmt.Sprintf("value=%v\n", string(view.ByteSlice()))
+		w.Write([]byte(value))
+	}
+
+	setPeerHandle := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		peer := r.FormValue("peer")
+		if peer == "" {
+			http.Error(w, "peer is not allow empty!", http.StatusInternalServerError)
+			return
+		}
+		svr.SetPeers(peer)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte(fmt.Sprintf("set peer %v successful\n", peer)))
+	}
+
+	setHandle := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, "Error ParseForm", http.StatusInternalServerError)
+			return
+		}
+		group, ok := lookupGroup(w, r)
+		if !ok {
+			return
+		}
+		key := r.FormValue("key")
+		value := r.FormValue("value")
+		expire := r.FormValue("expire")
+		hot := r.FormValue("hot")
+		pin := r.FormValue("pin")
+		expireTime, err := strconv.Atoi(expire)
+		if err != nil {
+			w.Write([]byte("Please set expire time correctly, unit: minutes"))
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		if expireTime < 0 || expireTime > 4321 {
+			w.Write([]byte("Expire time error, unit is minutes, max 4320 minutes (3 days)"))
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		ishot := false
+		if hot == "true" {
+			ishot = true
+		}
+		if hot != "true" && hot != "false" && hot != "" {
+			w.Write([]byte("Invalid Param \"hot\" "))
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		if pin != "true" && pin != "false" && pin != "" {
+			w.Write([]byte("Invalid Param \"pin\" "))
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		pinned := pin == "true"
+		exp := time.Duration(expireTime) * time.Minute
+		exptime := time.Now().Add(exp)
+		byteView := nexuscache.NewByteView([]byte(value), exptime)
+		if tags := r.FormValue("tags"); tags != "" {
+			byteView = byteView.WithTags(strings.Split(tags, ",")...)
+		}
+		if err := group.Set(key, byteView, ishot, pinned); err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("done\n"))
+	}
+
+	// expireParam reads the optional "expire" parameter in minutes, the zero
+	// time when it is absent or 0 so that the group's TTL applies
+	expireParam := func(w http.ResponseWriter, r *http.Request) (time.Time, bool) {
+		expire := r.FormValue("expire")
+		if expire == "" {
+			return time.Time{}, true
+		}
+		minutes, err := strconv.Atoi(expire)
+		if err != nil || minutes < 0 || minutes > 4320 {
+			http.Error(w, "Expire time error, unit is minutes, max 4320 minutes (3 days)", http.StatusBadRequest)
+			return time.Time{}, false
+		}
+		if minutes == 0 {
+			return time.Time{}, true
+		}
+		return time.Now().Add(time.Duration(minutes) * time.Minute), true
+	}
+
+	// casHandle stores value if key still has the given version, 0 to add it
+	casHandle := func(w http.ResponseWriter, r *http.Request) {
+		group, ok := lookupGroup(w, r)
+		if !ok {
+			return
+		}
+		version, err := strconv.ParseUint(r.FormValue("version"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Param \"version\" ", http.StatusBadRequest)
+			return
+		}
+		expire, ok := expireParam(w, r)
+		if !ok {
+			return
+		}
+		value := nexuscache.NewByteView([]byte(r.FormValue("value")), expire)
+		stored, err := group.CompareAndSet(r.FormValue("key"), version, value)
+		switch errors.Cause(err) {
+		case nil:
+			w.Write([]byte(fmt.Sprintf("version=%d\n", stored.Version())))
+		case nexuscache.ErrorVersionMismatch:
+			http.Error(w, err.Error(), http.StatusConflict)
+		case nexuscache.ErrorNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+
+	// incrHandle adds delta, 1 by default, to the integer value of key
+	incrHandle := func(w http.ResponseWriter, r *http.Request) {
+		group, ok := lookupGroup(w, r)
+		if !ok {
+			return
+		}
+		delta := int64(1)
+		if d := r.FormValue("delta"); d != "" {
+			var err error
+			if delta, err = strconv.ParseInt(d, 10, 64); err != nil {
+				http.Error(w, "Invalid Param \"delta\" ", http.StatusBadRequest)
+				return
+			}
+		}
+		expire, ok := expireParam(w, r)
+		if !ok {
+			return
+		}
+		n, err := group.Incr(r.FormValue("key"), delta, expire)
+		switch errors.Cause(err) {
+		case nil:
+			w.Write([]byte(fmt.Sprintf("value=%d\n", n)))
+		case nexuscache.ErrorNotInteger:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+
+	// invalidateHandle drops the keys set with tag, or starting with prefix,
+	// from every node
+	invalidateHandle := func(w http.ResponseWriter, r *http.Request) {
+		group, ok := lookupGroup(w, r)
+		if !ok {
+			return
+		}
+		tag, prefix := r.FormValue("tag"), r.FormValue("prefix")
+		var (
+			removed int
+			err     error
+		)
+		switch {
+		case tag != "" && prefix == "":
+			removed, err = group.InvalidateTag(tag)
+		case prefix != "" && tag == "":
+			removed, err = group.InvalidatePrefix(prefix)
+		default:
+			http.Error(w, "Please set either \"tag\" or \"prefix\"", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(fmt.Sprintf("removed=%d\n", removed)))
+	}
+
+	// flushHandle drops every key of a group from every node. The group must
+	// be named, so that a bare request can't clear the default one.
+	flushHandle := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.FormValue("group") == "" {
+			http.Error(w, "Please set \"group\"", http.StatusBadRequest)
+			return
+		}
+		group, ok := lookupGroup(w, r)
+		if !ok {
+			return
+		}
+		err := group.Flush()
+		result := "ok"
+		if err != nil {
+			result = err.Error()
+		}
+		log.Printf("audit: flush of group %s requested by %s: %s", group.Name(), r.RemoteAddr, result)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("flushed\n"))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/get", getHandle)
+	mux.HandleFunc("/setpeer", setPeerHandle)
+	mux.HandleFunc("/api/set", setHandle)
+	mux.HandleFunc("/api/cas", casHandle)
+	mux.HandleFunc("/api/incr", incrHandle)
+	mux.HandleFunc("/api/invalidate", invalidateHandle)
+	mux.HandleFunc("/admin/flush", flushHandle)
+	return mux
+}
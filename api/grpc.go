@@ -0,0 +1,386 @@
+package api
+
+import (
+	cachepb "NexusCache/cachepb/v1"
+	"NexusCache/nexuscache"
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CacheService implements the public gRPC API. Unlike the peer service it
+// routes keys: a request may reach any node, which asks the owner when needed.
+type CacheService struct {
+	cachepb.UnimplementedCacheServiceServer
+}
+
+func NewCacheService() *CacheService {
+	return &CacheService{}
+}
+
+// lookup returns the group and key of a request, InvalidArgument or NotFound
+// when they are missing or unknown
+func lookup(group, key string) (*nexuscache.Group, error) {
+	if group == "" || key == "" {
+		return nil, status.Error(codes.InvalidArgument, "group and key are required")
+	}
+	g := nexuscache.GetGroup(group)
+	if g == nil {
+		return nil, status.Errorf(codes.NotFound, "group %q not found", group)
+	}
+	return g, nil
+}
+
+// toStatus turns a group error into the status documented in cache.proto
+func toStatus(err error) error {
+	switch errors.Cause(err) {
+	case nexuscache.ErrorNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case nexuscache.ErrorLoadRateLimited, nexuscache.ErrorWriteQueueFull, nexuscache.ErrorWatcherBehind:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case nexuscache.ErrorEventsCompacted:
+		return status.Error(codes.OutOfRange, err.Error())
+	case nexuscache.ErrorVersionMismatch:
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case nexuscache.ErrorNotInteger, nexuscache.ErrorInvalidateScope:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case nexuscache.ErrorWriterClosed:
+		return status.Error(codes.Unavailable, err.Error())
+	case context.DeadlineExceeded:
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case context.Canceled:
+		return status.Error(codes.Canceled, err.Error())
+	}
+	// Failed calls to the owner keep its status, or tell that it is unreachable
+	if s, ok := status.FromError(err); ok && s.Code() != codes.Unknown {
+		return status.Error(s.Code(), err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// expiry returns the expiry of a ttl given in milliseconds, 0 for the group's TTL
+func expiry(g *nexuscache.Group, ttlMs int64) (time.Time, error) {
+	if ttlMs < 0 {
+		return time.Time{}, status.Error(codes.InvalidArgument, "ttl_ms must not be negative")
+	}
+	ttl := time.Duration(ttlMs) * time.Millisecond
+	if ttl == 0 {
+		ttl = g.TTL()
+	}
+	return time.Now().Add(ttl), nil
+}
+
+// ttlMs returns the time left until expire in milliseconds, 0 if unknown
+func ttlMs(expire time.Time) int64 {
+	if expire.IsZero() {
+		return 0
+	}
+	return max(time.Until(expire).Milliseconds(), 1)
+}
+
+func (s *CacheService) Get(ctx context.Context, in *cachepb.GetRequest) (*cachepb.GetResponse, error) {
+	g, err := lookup(in.GetGroup(), in.GetKey())
+	if err != nil {
+		return nil, err
+	}
+	view, err := g.Get(in.GetKey())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &cachepb.GetResponse{
+		Value:   view.ByteSlice(),
+		Flags:   view.Flags(),
+		TtlMs:   ttlMs(view.Expire()),
+		Version: view.Version(),
+	}, nil
+}
+
+func (s *CacheService) Set(ctx context.Context, in *cachepb.SetRequest) (*cachepb.SetResponse, error) {
+	g, err := lookup(in.GetGroup(), in.GetKey())
+	if err != nil {
+		return nil, err
+	}
+	expire, err := expiry(g, in.GetTtlMs())
+	if err != nil {
+		return nil, err
+	}
+	value := nexuscache.NewByteViewFlags(in.GetValue(), expire, in.GetFlags()).WithTags(in.GetTags()...)
+	if err := g.Set(in.GetKey(), value, in.GetHot(), in.GetPinned()); err != nil {
+		return nil, toStatus(err)
+	}
+	return &cachepb.SetResponse{}, nil
+}
+
+func (s *CacheService) Delete(ctx context.Context, in *cachepb.DeleteRequest) (*cachepb.DeleteResponse, error) {
+	g, err := lookup(in.GetGroup(), in.GetKey())
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := g.Delete(in.GetKey())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &cachepb.DeleteResponse{Deleted: deleted}, nil
+}
+
+// MultiGet fails as a whole on the first error other than a missing key
+func (s *CacheService) MultiGet(ctx context.Context, in *cachepb.MultiGetRequest) (*cachepb.MultiGetResponse, error) {
+	out := &cachepb.MultiGetResponse{Items: make([]*cachepb.Item, 0, len(in.GetKeys()))}
+	for _, key := range in.GetKeys() {
+		g, err := lookup(in.GetGroup(), key)
+		if err != nil {
+			return nil, err
+		}
+		item := &cachepb.Item{Key: key}
+		view, err := g.Get(key)
+		switch {
+		case errors.Cause(err) == nexuscache.ErrorNotFound:
+		case err != nil:
+			return nil, toStatus(err)
+		default:
+			item.Found, item.Value, item.Flags, item.TtlMs = true, view.ByteSlice(), view.Flags(), ttlMs(view.Expire())
+			item.Version = view.Version()
+		}
+		out.Items = append(out.Items, item)
+	}
+	return out, nil
+}
+
+func (s *CacheService) Touch(ctx context.Context, in *cachepb.TouchRequest) (*cachepb.TouchResponse, error) {
+	g, err := lookup(in.GetGroup(), in.GetKey())
+	if err != nil {
+		return nil, err
+	}
+	expire, err := expiry(g, in.GetTtlMs())
+	if err != nil {
+		return nil, err
+	}
+	touched, err := g.Touch(in.GetKey(), expire)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if !touched {
+		return nil, status.Errorf(codes.NotFound, "key %q is not cached", in.GetKey())
+	}
+	return &cachepb.TouchResponse{}, nil
+}
+
+func (s *CacheService) TTL(ctx context.Context, in *cachepb.TTLRequest) (*cachepb.TTLResponse, error) {
+	g, err := lookup(in.GetGroup(), in.GetKey())
+	if err != nil {
+		return nil, err
+	}
+	view, err := g.Peek(in.GetKey())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &cachepb.TTLResponse{TtlMs: ttlMs(view.Expire())}, nil
+}
+
+func (s *CacheService) CompareAndSet(ctx context.Context, in *cachepb.CompareAndSetRequest) (*cachepb.CompareAndSetResponse, error) {
+	g, err := lookup(in.GetGroup(), in.GetKey())
+	if err != nil {
+		return nil, err
+	}
+	expire, err := expiry(g, in.GetTtlMs())
+	if err != nil {
+		return nil, err
+	}
+	value := nexuscache.NewByteViewFlags(in.GetValue(), expire, in.GetFlags()).WithTags(in.GetTags()...)
+	stored, err := g.CompareAndSet(in.GetKey(), in.GetVersion(), value)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &cachepb.CompareAndSetResponse{Version: stored.Version()}, nil
+}
+
+func (s *CacheService) Incr(ctx context.Context, in *cachepb.IncrRequest) (*cachepb.IncrResponse, error) {
+	g, err := lookup(in.GetGroup(), in.GetKey())
+	if err != nil {
+		return nil, err
+	}
+	expire, err := expiry(g, in.GetTtlMs())
+	if err != nil {
+		return nil, err
+	}
+	n, err := g.Incr(in.GetKey(), in.GetDelta(), expire)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &cachepb.IncrResponse{Value: n}, nil
+}
+
+func (s *CacheService) Invalidate(ctx context.Context, in *cachepb.InvalidateRequest) (*cachepb.InvalidateResponse, error) {
+	g := nexuscache.GetGroup(in.GetGroup())
+	if g == nil {
+		return nil, status.Errorf(codes.NotFound, "group %q not found", in.GetGroup())
+	}
+	var (
+		removed int
+		err     error
+	)
+	switch {
+	case in.GetTag() != "" && in.GetPrefix() == "":
+		removed, err = g.InvalidateTag(in.GetTag())
+	case in.GetPrefix() != "" && in.GetTag() == "":
+		removed, err = g.InvalidatePrefix(in.GetPrefix())
+	default:
+		err = nexuscache.ErrorInvalidateScope
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &cachepb.InvalidateResponse{Removed: int64(removed)}, nil
+}
+
+func (s *CacheService) Stats(ctx context.Context, in *cachepb.StatsRequest) (*cachepb.StatsResponse, error) {
+	groups := nexuscache.Groups()
+	if name := in.GetGroup(); name != "" {
+		g := nexuscache.GetGroup(name)
+		if g == nil {
+			return nil, status.Errorf(codes.NotFound, "group %q not found", name)
+		}
+		groups = []*nexuscache.Group{g}
+	}
+	out := &cachepb.StatsResponse{}
+	for _, g := range groups {
+		st := g.Stats()
+		out.Groups = append(out.Groups, &cachepb.GroupStats{
+			Name:      g.Name(),
+			Gets:      st.Gets,
+			Hits:      st.Hits,
+			Loads:     st.Loads,
+			PeerLoads: st.PeerLoads,
+			Items:     st.Items,
+			Bytes:     st.Bytes,
+			HotItems:  st.HotItems,
+			HotBytes:  st.HotBytes,
+		})
+	}
+	return out, nil
+}
+
+// watchBuffer is how many events a slow Watch or Invalidations stream may lag behind
+const watchBuffer = 4096
+
+// maxInvalidationBatch caps the keys sent in one Invalidation message
+const maxInvalidationBatch = 256
+
+// errorBehind is the status of a stream whose watcher fell behind
+func errorBehind(w *nexuscache.Watcher) error {
+	if err := w.Err(); err != nil {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return status.Error(codes.Aborted, "watch closed")
+}
+
+func (s *CacheService) Invalidations(in *cachepb.InvalidationsRequest, stream cachepb.CacheService_InvalidationsServer) error {
+	g := nexuscache.GetGroup(in.GetGroup())
+	if g == nil {
+		return status.Errorf(codes.NotFound, "group %q not found", in.GetGroup())
+	}
+	w, err := g.Watch("", true, 0, watchBuffer)
+	if err != nil {
+		return toStatus(err)
+	}
+	defer w.Close()
+	if err := stream.Send(&cachepb.Invalidation{}); err != nil {
+		return err
+	}
+	for {
+		var batch cachepb.Invalidation
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case e, ok := <-w.C:
+			if !ok {
+				return errorBehind(w)
+			}
+			addInvalidation(&batch, e)
+		}
+	drain:
+		for len(batch.Keys) < maxInvalidationBatch && !batch.Flush {
+			select {
+			case e, ok := <-w.C:
+				if !ok {
+					return errorBehind(w)
+				}
+				addInvalidation(&batch, e)
+			default:
+				break drain
+			}
+		}
+		if len(batch.Keys) == 0 && !batch.Flush {
+			continue
+		}
+		if err := stream.Send(&batch); err != nil {
+			return err
+		}
+	}
+}
+
+// addInvalidation adds the keys an event makes stale to batch. A flush makes
+// every key stale, so the keys batched before it are dropped.
+func addInvalidation(batch *cachepb.Invalidation, e nexuscache.Event) {
+	switch e.Type {
+	case nexuscache.EventSet, nexuscache.EventDelete:
+		batch.Keys = append(batch.Keys, e.Key)
+	case nexuscache.EventFlush:
+		batch.Keys, batch.Flush = nil, true
+	}
+}
+
+// eventTypes maps the event types of the group to the API's
+var eventTypes = map[nexuscache.EventType]cachepb.WatchEvent_Type{
+	nexuscache.EventSet:    cachepb.WatchEvent_SET,
+	nexuscache.EventDelete: cachepb.WatchEvent_DELETE,
+	nexuscache.EventExpire: cachepb.WatchEvent_EXPIRE,
+	nexuscache.EventEvict:  cachepb.WatchEvent_EVICT,
+	nexuscache.EventFlush:  cachepb.WatchEvent_FLUSH,
+}
+
+func (s *CacheService) Watch(in *cachepb.WatchRequest, stream cachepb.CacheService_WatchServer) error {
+	g := nexuscache.GetGroup(in.GetGroup())
+	if g == nil {
+		return status.Errorf(codes.NotFound, "group %q not found", in.GetGroup())
+	}
+	if in.GetKey() == "" && !in.GetPrefix() {
+		return status.Error(codes.InvalidArgument, "key is required unless watching a prefix")
+	}
+	after := in.GetAfterSeq()
+	if after > 0 && in.GetEpoch() != nexuscache.EventEpoch() {
+		return status.Error(codes.OutOfRange, "the node restarted since the given epoch")
+	}
+	w, err := g.Watch(in.GetKey(), in.GetPrefix(), after, watchBuffer)
+	if err != nil {
+		return toStatus(err)
+	}
+	defer w.Close()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case e, ok := <-w.C:
+			if !ok {
+				return errorBehind(w)
+			}
+			out := &cachepb.WatchEvent{
+				Type:       eventTypes[e.Type],
+				Key:        e.Key,
+				Epoch:      nexuscache.EventEpoch(),
+				Seq:        e.Seq,
+				TimeUnixMs: e.Time.UnixMilli(),
+			}
+			if e.Value != nil {
+				out.Value, out.Flags, out.TtlMs = e.Value.ByteSlice(), e.Value.Flags(), ttlMs(e.Value.Expire())
+				out.Version = e.Value.Version()
+			}
+			if err := stream.Send(out); err != nil {
+				return err
+			}
+		}
+	}
+}
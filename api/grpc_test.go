@@ -0,0 +1,224 @@
+package api
+
+import (
+	cachepb "NexusCache/cachepb/v1"
+	"NexusCache/connect"
+	"NexusCache/nexuscache"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// localPeers makes every key owned by this node
+type localPeers struct{}
+
+func (localPeers) PickPeer(key string) (connect.PeerGetter, bool) { return nil, false }
+
+func TestCacheService(t *testing.T) {
+	g := nexuscache.NewGroup("api-grpc", 1<<20, 1<<20, nexuscache.GetterFunc(func(key string) ([]byte, error) {
+		if key == "origin" {
+			return []byte("loaded"), nil
+		}
+		return nil, nexuscache.ErrorNotFound
+	}))
+	g.RegisterPeers(localPeers{})
+	g.SetExpireJitter(0)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	cachepb.RegisterCacheServiceServer(srv, NewCacheService())
+	go srv.Serve(lis)
+	defer srv.Stop()
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := cachepb.NewCacheServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	expectCode := func(what string, err error, want codes.Code) {
+		t.Helper()
+		if status.Code(err) != want {
+			t.Fatalf("%s: expected %v, got %v", what, want, err)
+		}
+	}
+
+	if _, err := c.Set(ctx, &cachepb.SetRequest{Group: "api-grpc", Key: "k", Value: []byte("v"), TtlMs: 60000, Flags: 3}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	got, err := c.Get(ctx, &cachepb.GetRequest{Group: "api-grpc", Key: "k"})
+	if err != nil || string(got.GetValue()) != "v" || got.GetFlags() != 3 || got.GetTtlMs() <= 0 || got.GetTtlMs() > 60000 {
+		t.Fatalf("Get = %v, %v", got, err)
+	}
+	if _, err := c.Touch(ctx, &cachepb.TouchRequest{Group: "api-grpc", Key: "k", TtlMs: 3600000}); err != nil {
+		t.Fatalf("Touch: %v", err)
+	}
+	ttl, err := c.TTL(ctx, &cachepb.TTLRequest{Group: "api-grpc", Key: "k"})
+	if err != nil || ttl.GetTtlMs() < 3500000 {
+		t.Fatalf("TTL after Touch = %v, %v", ttl, err)
+	}
+
+	multi, err := c.MultiGet(ctx, &cachepb.MultiGetRequest{Group: "api-grpc", Keys: []string{"k", "missing", "origin"}})
+	if err != nil || len(multi.GetItems()) != 3 {
+		t.Fatalf("MultiGet = %v, %v", multi, err)
+	}
+	if items := multi.GetItems(); !items[0].GetFound() || items[1].GetFound() || string(items[2].GetValue()) != "loaded" {
+		t.Fatalf("MultiGet items %v", items)
+	}
+
+	del, err := c.Delete(ctx, &cachepb.DeleteRequest{Group: "api-grpc", Key: "k"})
+	if err != nil || !del.GetDeleted() {
+		t.Fatalf("Delete = %v, %v", del, err)
+	}
+	_, err = c.Get(ctx, &cachepb.GetRequest{Group: "api-grpc", Key: "missing"})
+	expectCode("Get missing key", err, codes.NotFound)
+	_, err = c.TTL(ctx, &cachepb.TTLRequest{Group: "api-grpc", Key: "k"})
+	expectCode("TTL of a deleted key", err, codes.NotFound)
+	_, err = c.Touch(ctx, &cachepb.TouchRequest{Group: "api-grpc", Key: "k"})
+	expectCode("Touch of a deleted key", err, codes.NotFound)
+	_, err = c.Get(ctx, &cachepb.GetRequest{Group: "unknown", Key: "k"})
+	expectCode("unknown group", err, codes.NotFound)
+	_, err = c.Get(ctx, &cachepb.GetRequest{Group: "api-grpc"})
+	expectCode("missing key", err, codes.InvalidArgument)
+	_, err = c.Set(ctx, &cachepb.SetRequest{Group: "api-grpc", Key: "k", TtlMs: -1})
+	expectCode("negative ttl", err, codes.InvalidArgument)
+
+	added, err := c.CompareAndSet(ctx, &cachepb.CompareAndSetRequest{Group: "api-grpc", Key: "cas", Value: []byte("v1")})
+	if err != nil || added.GetVersion() == 0 {
+		t.Fatalf("CompareAndSet adding a key = %v, %v", added, err)
+	}
+	_, err = c.CompareAndSet(ctx, &cachepb.CompareAndSetRequest{Group: "api-grpc", Key: "cas", Value: []byte("v2")})
+	expectCode("adding a cached key", err, codes.FailedPrecondition)
+	got, err = c.Get(ctx, &cachepb.GetRequest{Group: "api-grpc", Key: "cas"})
+	if err != nil || got.GetVersion() != added.GetVersion() {
+		t.Fatalf("Get = %v, %v, want version %d", got, err, added.GetVersion())
+	}
+	if _, err := c.CompareAndSet(ctx, &cachepb.CompareAndSetRequest{Group: "api-grpc", Key: "cas", Value: []byte("v2"), Version: got.GetVersion()}); err != nil {
+		t.Fatalf("CompareAndSet: %v", err)
+	}
+	_, err = c.CompareAndSet(ctx, &cachepb.CompareAndSetRequest{Group: "api-grpc", Key: "cas", Value: []byte("v3"), Version: got.GetVersion()})
+	expectCode("stale CompareAndSet", err, codes.FailedPrecondition)
+	_, err = c.CompareAndSet(ctx, &cachepb.CompareAndSetRequest{Group: "api-grpc", Key: "absent", Version: 1})
+	expectCode("CompareAndSet of a missing key", err, codes.NotFound)
+
+	incr, err := c.Incr(ctx, &cachepb.IncrRequest{Group: "api-grpc", Key: "n", Delta: 3})
+	if err != nil || incr.GetValue() != 3 {
+		t.Fatalf("Incr = %v, %v", incr, err)
+	}
+	if incr, err = c.Incr(ctx, &cachepb.IncrRequest{Group: "api-grpc", Key: "n", Delta: -5}); err != nil || incr.GetValue() != -2 {
+		t.Fatalf("Incr = %v, %v", incr, err)
+	}
+	_, err = c.Incr(ctx, &cachepb.IncrRequest{Group: "api-grpc", Key: "cas", Delta: 1})
+	expectCode("Incr of a string", err, codes.InvalidArgument)
+
+	for _, key := range []string{"user:1:a", "user:1:b"} {
+		if _, err := c.Set(ctx, &cachepb.SetRequest{Group: "api-grpc", Key: key, Value: []byte("v"), Tags: []string{"user:1"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	inv, err := c.Invalidate(ctx, &cachepb.InvalidateRequest{Group: "api-grpc", Tag: "user:1"})
+	if err != nil || inv.GetRemoved() != 2 {
+		t.Fatalf("Invalidate = %v, %v", inv, err)
+	}
+	_, err = c.Get(ctx, &cachepb.GetRequest{Group: "api-grpc", Key: "user:1:a"})
+	expectCode("Get of an invalidated key", err, codes.NotFound)
+	_, err = c.Invalidate(ctx, &cachepb.InvalidateRequest{Group: "api-grpc"})
+	expectCode("Invalidate without a tag or prefix", err, codes.InvalidArgument)
+
+	g.SetLoadRateLimit(1e-9, 1)
+	g.Get("first-load") // Uses the only token
+	_, err = c.Get(ctx, &cachepb.GetRequest{Group: "api-grpc", Key: "origin2"})
+	expectCode("rate limited load", err, codes.ResourceExhausted)
+
+	stats, err := c.Stats(ctx, &cachepb.StatsRequest{Group: "api-grpc"})
+	if err != nil || len(stats.GetGroups()) != 1 {
+		t.Fatalf("Stats = %v, %v", stats, err)
+	}
+	if st := stats.GetGroups()[0]; st.GetName() != "api-grpc" || st.GetGets() == 0 || st.GetHits() == 0 || st.GetLoads() == 0 {
+		t.Fatalf("unexpected stats %v", st)
+	}
+	_, err = c.Stats(ctx, &cachepb.StatsRequest{Group: "unknown"})
+	expectCode("stats of an unknown group", err, codes.NotFound)
+}
+
+func TestWatch(t *testing.T) {
+	g := nexuscache.NewGroup("api-watch", 1<<20, 1<<20, nexuscache.GetterFunc(func(key string) ([]byte, error) {
+		return nil, nexuscache.ErrorNotFound
+	}))
+	g.RegisterPeers(localPeers{})
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	cachepb.RegisterCacheServiceServer(srv, NewCacheService())
+	go srv.Serve(lis)
+	defer srv.Stop()
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := cachepb.NewCacheServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	after := nexuscache.LastEventSeq()
+	if _, err := c.Set(ctx, &cachepb.SetRequest{Group: "api-watch", Key: "k", Value: []byte("v"), Flags: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Delete(ctx, &cachepb.DeleteRequest{Group: "api-watch", Key: "k"}); err != nil {
+		t.Fatal(err)
+	}
+	// Resuming replays the events that happened before the stream was opened
+	stream, err := c.Watch(ctx, &cachepb.WatchRequest{Group: "api-watch", Key: "k", Epoch: nexuscache.EventEpoch(), AfterSeq: after})
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := stream.Recv()
+	if err != nil || set.GetType() != cachepb.WatchEvent_SET || string(set.GetValue()) != "v" || set.GetFlags() != 2 || set.GetSeq() <= after {
+		t.Fatalf("expected the set event, got %v %v", set, err)
+	}
+	del, err := stream.Recv()
+	if err != nil || del.GetType() != cachepb.WatchEvent_DELETE || del.GetSeq() <= set.GetSeq() {
+		t.Fatalf("expected the delete event, got %v %v", del, err)
+	}
+
+	// A flush reaches the watchers of every key and the near caches
+	invalidations, err := c.Invalidations(ctx, &cachepb.InvalidationsRequest{Group: "api-watch"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := invalidations.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if flush, err := stream.Recv(); err != nil || flush.GetType() != cachepb.WatchEvent_FLUSH {
+		t.Fatalf("expected the flush event, got %v %v", flush, err)
+	}
+	if batch, err := invalidations.Recv(); err != nil || !batch.GetFlush() {
+		t.Fatalf("expected a flush invalidation, got %v %v", batch, err)
+	}
+
+	stale, err := c.Watch(ctx, &cachepb.WatchRequest{Group: "api-watch", Key: "k", Epoch: nexuscache.EventEpoch() + 1, AfterSeq: 1})
+	if err == nil {
+		_, err = stale.Recv()
+	}
+	if status.Code(err) != codes.OutOfRange {
+		t.Fatalf("resuming another epoch should fail with OutOfRange, got %v", err)
+	}
+}
@@ -0,0 +1,330 @@
+// Package config describes a NexusCache node: its addresses, how it finds
+// its peers and the cache groups it serves. A config is read from a YAML file
+// and may be overridden by environment variables and command line flags.
+package config
+
+import (
+	"NexusCache/consistenthash"
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Eviction policies
+const (
+	EvictionLRU = "lru"
+)
+
+// Origin loader types
+const (
+	OriginStatic = "static" // Values listed in the config
+	OriginHTTP   = "http"   // GET {url}/{key}
+	OriginFile   = "file"   // Reads {dir}/{key}
+)
+
+var ErrorInvalidConfig = errors.New("invalid config")
+
+// Config is the configuration of a node
+type Config struct {
+	Node      Node          `yaml:"node"`
+	Discovery Discovery     `yaml:"discovery"`
+	Groups    []GroupConfig `yaml:"groups"`
+}
+
+// Node holds the settings of this node
+type Node struct {
+	Name          string  `yaml:"name"`
+	Port          string  `yaml:"port"`
+	GrpcAddr      string  `yaml:"grpc_addr"` // Defaults to 0.0.0.0:<port>
+	ApiAddr       string  `yaml:"api_addr"`
+	MetricsAddr   string  `yaml:"metrics_addr"`
+	RespAddr      string  `yaml:"resp_addr"`      // Redis protocol front-end, off when empty
+	MemcacheAddr  string  `yaml:"memcache_addr"`  // memcached protocol front-end, off when empty
+	MemcacheGroup string  `yaml:"memcache_group"` // Group memcached keys address, the first group by default
+	KeyPrefix     bool    `yaml:"key_prefix"`     // Route "group:key" to the named group in both front-ends
+	AdvertiseAddr string  `yaml:"advertise_addr"` // Defaults to $IP_ADDRESS:<port>
+	Weight        int     `yaml:"weight"`
+	Placement     string  `yaml:"placement"`
+	Replicas      int     `yaml:"replicas"` // Virtual nodes per unit of weight on the ring
+	BoundedLoad   float64 `yaml:"bounded_load"`
+	LogLevel      string  `yaml:"log_level"` // "info" or "debug"
+}
+
+// Discovery tells a node where etcd is and which peers form the cluster
+type Discovery struct {
+	Etcd  []string `yaml:"etcd"`
+	Peers []string `yaml:"peers"`
+}
+
+// GroupConfig describes a cache group
+type GroupConfig struct {
+	Name          string         `yaml:"name"`
+	CacheBytes    int64          `yaml:"cache_bytes"`
+	HotCacheBytes int64          `yaml:"hot_cache_bytes"`
+	PinnedBytes   int64          `yaml:"pinned_bytes"`    // 0 keeps the default share of cache_bytes
+	TTL           time.Duration  `yaml:"ttl"`             // 0 keeps nexuscache.DefaultExpireTime
+	TTLJitter     *time.Duration `yaml:"ttl_jitter"`      // Random extra TTL, unset keeps lru.DefaultExpireRandom
+	LoadRateLimit float64        `yaml:"load_rate_limit"` // Origin loads per second, 0 is unlimited
+	LoadBurst     int            `yaml:"load_burst"`      // Loads allowed at once above the rate, defaults to 1
+	Eviction      string         `yaml:"eviction"`
+	Origin        Origin         `yaml:"origin"`
+}
+
+// Origin describes where a group loads missing keys from
+type Origin struct {
+	Type    string            `yaml:"type"`
+	Data    map[string]string `yaml:"data,omitempty"`    // Values of the static origin
+	URL     string            `yaml:"url,omitempty"`     // Base URL of the http origin
+	Timeout time.Duration     `yaml:"timeout,omitempty"` // Per attempt, defaults to 2s
+	Retries int               `yaml:"retries,omitempty"` // Extra attempts after a failed request or a 5xx
+	Dir     string            `yaml:"dir,omitempty"`     // Directory of the file origin
+	Write   Write             `yaml:"write,omitempty"`
+}
+
+// Write modes
+const (
+	WriteThrough = "through" // Set returns once the origin stored the value
+	WriteBehind  = "behind"  // Set returns at once, the value is written asynchronously
+)
+
+// Write configures writing values set in the cache back to the origin,
+// see nexuscache.WriteBehindOptions for the defaults
+type Write struct {
+	Mode          string        `yaml:"mode,omitempty"` // Empty for a read-only origin
+	QueueSize     int           `yaml:"queue_size,omitempty"`
+	BatchSize     int           `yaml:"batch_size,omitempty"`
+	FlushInterval time.Duration `yaml:"flush_interval,omitempty"`
+	Retries       int           `yaml:"retries,omitempty"`
+}
+
+// Default returns the configuration used when no file is given: a single
+// "scores" group backed by a small static data set.
+func Default() *Config {
+	return &Config{
+		Node: Node{
+			Port:        "8888",
+			ApiAddr:     "0.0.0.0:9999",
+			MetricsAddr: ":9100",
+			Weight:      1,
+			Placement:   "ring",
+			Replicas:    consistenthash.DefaultReplicas,
+			LogLevel:    "info",
+		},
+		Discovery: Discovery{
+			Etcd: []string{"127.0.0.1:2379"},
+		},
+		Groups: []GroupConfig{{
+			Name:          "scores",
+			CacheBytes:    2 << 10,
+			HotCacheBytes: 2 << 7,
+			Eviction:      EvictionLRU,
+			Origin: Origin{Type: OriginStatic, Data: map[string]string{
+				"Tom":  "630",
+				"Jack": "589",
+				"Sam":  "567",
+			}},
+		}},
+	}
+}
+
+// Load reads the YAML file at path on top of the defaults. Groups listed in
+// the file replace the default group.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse decodes a YAML config on top of the defaults
+func Parse(data []byte) (*Config, error) {
+	c := Default()
+	c.Groups = nil
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "parse config")
+	}
+	if len(c.Groups) == 0 {
+		c.Groups = Default().Groups
+	}
+	return c, nil
+}
+
+// ApplyEnv overrides node and discovery settings from NEXUSCACHE_*
+// environment variables, lookup is usually os.LookupEnv.
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) {
+	if v, ok := lookup("NEXUSCACHE_NAME"); ok {
+		c.Node.Name = v
+	}
+	if v, ok := lookup("NEXUSCACHE_PORT"); ok {
+		c.Node.Port = v
+	}
+	if v, ok := lookup("NEXUSCACHE_ADVERTISE_ADDR"); ok {
+		c.Node.AdvertiseAddr = v
+	}
+	if v, ok := lookup("NEXUSCACHE_ETCD"); ok {
+		c.Discovery.Etcd = SplitList(v)
+	}
+	if v, ok := lookup("NEXUSCACHE_PEERS"); ok {
+		c.Discovery.Peers = SplitList(v)
+	}
+}
+
+// SplitList splits a comma separated list, dropping empty items
+func SplitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// MarshalGroup encodes a group definition, e.g. to publish it in etcd
+func MarshalGroup(g GroupConfig) ([]byte, error) {
+	return yaml.Marshal(g)
+}
+
+// ParseGroup decodes and validates a group definition written by MarshalGroup
+func ParseGroup(data []byte) (GroupConfig, error) {
+	var g GroupConfig
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&g); err != nil {
+		return GroupConfig{}, errors.Wrap(err, "parse group")
+	}
+	return g, g.Validate()
+}
+
+// Group returns the group named name
+func (c *Config) Group(name string) (GroupConfig, bool) {
+	for _, g := range c.Groups {
+		if g.Name == name {
+			return g, true
+		}
+	}
+	return GroupConfig{}, false
+}
+
+// Validate reports the first problem found in the config
+func (c *Config) Validate() error {
+	if c.Node.Name == "" {
+		return errors.Wrap(ErrorInvalidConfig, "node.name is required")
+	}
+	if len(c.Discovery.Peers) == 0 {
+		return errors.Wrap(ErrorInvalidConfig, "discovery.peers is required")
+	}
+	found := false
+	for _, p := range c.Discovery.Peers {
+		found = found || p == c.Node.Name
+	}
+	if !found {
+		return errors.Wrapf(ErrorInvalidConfig, "discovery.peers must contain %s", c.Node.Name)
+	}
+	if len(c.Discovery.Etcd) == 0 {
+		return errors.Wrap(ErrorInvalidConfig, "discovery.etcd is required")
+	}
+	if c.Node.Weight < 1 {
+		return errors.Wrap(ErrorInvalidConfig, "node.weight must be at least 1")
+	}
+	if c.Node.Replicas < 1 {
+		return errors.Wrap(ErrorInvalidConfig, "node.replicas must be at least 1")
+	}
+	if c.Node.BoundedLoad < 0 {
+		return errors.Wrap(ErrorInvalidConfig, "node.bounded_load must not be negative")
+	}
+	if c.Node.LogLevel != "info" && c.Node.LogLevel != "debug" {
+		return errors.Wrapf(ErrorInvalidConfig, "unknown node.log_level %q", c.Node.LogLevel)
+	}
+	if len(c.Groups) == 0 {
+		return errors.Wrap(ErrorInvalidConfig, "at least one group is required")
+	}
+	seen := make(map[string]bool)
+	for i := range c.Groups {
+		g := &c.Groups[i]
+		if err := g.Validate(); err != nil {
+			return err
+		}
+		if seen[g.Name] {
+			return errors.Wrapf(ErrorInvalidConfig, "group %s is defined twice", g.Name)
+		}
+		seen[g.Name] = true
+	}
+	if c.Node.MemcacheGroup != "" && !seen[c.Node.MemcacheGroup] {
+		return errors.Wrapf(ErrorInvalidConfig, "node.memcache_group %s is not a configured group", c.Node.MemcacheGroup)
+	}
+	return nil
+}
+
+// Validate checks a group definition and fills in its default eviction policy
+func (g *GroupConfig) Validate() error {
+	if g.Name == "" {
+		return errors.Wrap(ErrorInvalidConfig, "group name is required")
+	}
+	invalid := func(format string, v ...interface{}) error {
+		return errors.Wrapf(ErrorInvalidConfig, "group %s: %s", g.Name, fmt.Sprintf(format, v...))
+	}
+	if g.CacheBytes <= 0 {
+		return invalid("cache_bytes must be positive")
+	}
+	if g.HotCacheBytes < 0 || g.PinnedBytes < 0 {
+		return invalid("hot_cache_bytes and pinned_bytes must not be negative")
+	}
+	if g.PinnedBytes > g.CacheBytes {
+		return invalid("pinned_bytes exceeds cache_bytes")
+	}
+	if g.TTL < 0 || g.TTLJitter != nil && *g.TTLJitter < 0 {
+		return invalid("ttl and ttl_jitter must not be negative")
+	}
+	if g.LoadRateLimit < 0 || g.LoadBurst < 0 {
+		return invalid("load_rate_limit and load_burst must not be negative")
+	}
+	if g.Eviction == "" {
+		g.Eviction = EvictionLRU
+	}
+	if g.Eviction != EvictionLRU {
+		return invalid("unknown eviction policy %q", g.Eviction)
+	}
+	switch g.Origin.Type {
+	case OriginStatic:
+	case OriginHTTP:
+		if u, err := url.Parse(g.Origin.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return invalid("origin.url must be an http(s) URL, got %q", g.Origin.URL)
+		}
+		if g.Origin.Timeout < 0 || g.Origin.Retries < 0 {
+			return invalid("origin.timeout and origin.retries must not be negative")
+		}
+	case OriginFile:
+		if g.Origin.Dir == "" {
+			return invalid("origin.dir is required")
+		}
+	case "":
+		return invalid("origin.type is required")
+	default:
+		return invalid("unknown origin type %q", g.Origin.Type)
+	}
+	w := g.Origin.Write
+	switch w.Mode {
+	case "":
+	case WriteThrough, WriteBehind:
+		if g.Origin.Type == OriginStatic {
+			return invalid("the static origin can't be written to")
+		}
+	default:
+		return invalid("unknown origin.write.mode %q", w.Mode)
+	}
+	if w.QueueSize < 0 || w.BatchSize < 0 || w.FlushInterval < 0 || w.Retries < 0 {
+		return invalid("origin.write settings must not be negative")
+	}
+	return nil
+}
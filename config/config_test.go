@@ -0,0 +1,126 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestLoadExample(t *testing.T) {
+	c, err := Load("../config.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Node.Name != "svc1" || len(c.Discovery.Peers) != 3 || len(c.Groups) != 4 {
+		t.Fatalf("unexpected config %+v", c)
+	}
+	g, ok := c.Group("sessions")
+	if !ok || g.TTL != 10*time.Minute || g.PinnedBytes != 8<<20 || g.Eviction != EvictionLRU {
+		t.Fatalf("unexpected sessions group %+v", g)
+	}
+	if c.Node.MetricsAddr != ":9100" {
+		t.Fatalf("defaults should fill unset fields, metrics_addr=%q", c.Node.MetricsAddr)
+	}
+}
+
+func TestParseDefaults(t *testing.T) {
+	c, err := Parse([]byte("node:\n  name: a\ndiscovery:\n  peers: [a]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Groups) != 1 || c.Groups[0].Name != "scores" || c.Node.Port != "8888" {
+		t.Fatalf("expected the default node and group, got %+v", c)
+	}
+	if _, err := Parse([]byte("node:\n  nmae: a\n")); err == nil {
+		t.Fatalf("unknown fields should be rejected")
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	c := Default()
+	env := map[string]string{
+		"NEXUSCACHE_NAME":  "b",
+		"NEXUSCACHE_PEERS": "a, b,,c",
+		"NEXUSCACHE_ETCD":  "etcd:2379",
+	}
+	c.ApplyEnv(func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	})
+	if c.Node.Name != "b" || strings.Join(c.Discovery.Peers, ",") != "a,b,c" || c.Discovery.Etcd[0] != "etcd:2379" {
+		t.Fatalf("env not applied: %+v", c)
+	}
+	if c.Node.Port != "8888" {
+		t.Fatalf("unset env should keep the default port, got %q", c.Node.Port)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() *Config {
+		c := Default()
+		c.Node.Name = "a"
+		c.Discovery.Peers = []string{"a", "b"}
+		return c
+	}
+	if err := valid().Validate(); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]func(c *Config){
+		"no name":          func(c *Config) { c.Node.Name = "" },
+		"self not a peer":  func(c *Config) { c.Discovery.Peers = []string{"b"} },
+		"no etcd":          func(c *Config) { c.Discovery.Etcd = nil },
+		"zero weight":      func(c *Config) { c.Node.Weight = 0 },
+		"zero replicas":    func(c *Config) { c.Node.Replicas = 0 },
+		"no groups":        func(c *Config) { c.Groups = nil },
+		"duplicate group":  func(c *Config) { c.Groups = append(c.Groups, c.Groups[0]) },
+		"zero capacity":    func(c *Config) { c.Groups[0].CacheBytes = 0 },
+		"pinned too big":   func(c *Config) { c.Groups[0].PinnedBytes = c.Groups[0].CacheBytes + 1 },
+		"negative ttl":     func(c *Config) { c.Groups[0].TTL = -time.Second },
+		"unknown policy":   func(c *Config) { c.Groups[0].Eviction = "lfu" },
+		"no origin":        func(c *Config) { c.Groups[0].Origin.Type = "" },
+		"unknown origin":   func(c *Config) { c.Groups[0].Origin.Type = "redis" },
+		"http without url": func(c *Config) { c.Groups[0].Origin = Origin{Type: OriginHTTP} },
+		"http bad url":     func(c *Config) { c.Groups[0].Origin = Origin{Type: OriginHTTP, URL: "ftp://x"} },
+		"file without dir": func(c *Config) { c.Groups[0].Origin = Origin{Type: OriginFile} },
+		"writing static":   func(c *Config) { c.Groups[0].Origin.Write.Mode = WriteThrough },
+		"memcache group":   func(c *Config) { c.Node.MemcacheGroup = "missing" },
+		"unknown write": func(c *Config) {
+			c.Groups[0].Origin = Origin{Type: OriginFile, Dir: "/d", Write: Write{Mode: "around"}}
+		},
+	}
+	for name, mutate := range cases {
+		c := valid()
+		mutate(c)
+		if err := c.Validate(); errors.Cause(err) != ErrorInvalidConfig {
+			t.Fatalf("%s: expected ErrorInvalidConfig, got %v", name, err)
+		}
+	}
+}
+
+func TestGroupRoundTrip(t *testing.T) {
+	g := Default().Groups[0]
+	jitter := time.Second
+	g.TTL, g.TTLJitter = time.Minute, &jitter
+	data, err := MarshalGroup(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseGroup(data)
+	if err != nil {
+		t.Fatalf("parse %s: %v", data, err)
+	}
+	if changes, err := DiffGroup(g, parsed); err != nil || len(changes) != 0 {
+		t.Fatalf("round trip changed the group: %v %v", changes, err)
+	}
+	if _, err := ParseGroup([]byte("name: x\ncache_bytes: 0\n")); errors.Cause(err) != ErrorInvalidConfig {
+		t.Fatalf("invalid definitions should be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ErrorUnsafeChange = errors.New("config change requires a restart")
+
+// reloadable lists the settings a running node applies without a restart,
+// group settings are named without the "groups.<name>." prefix
+var reloadable = map[string]bool{
+	"node.log_level":  true,
+	"cache_bytes":     true,
+	"hot_cache_bytes": true,
+	"pinned_bytes":    true,
+	"ttl":             true,
+	"ttl_jitter":      true,
+	"load_rate_limit": true,
+	"load_burst":      true,
+}
+
+// Change is a setting that differs between two configs
+type Change struct {
+	Field    string // Dotted yaml path, e.g. groups.scores.ttl
+	Old, New interface{}
+	safe     bool
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %v -> %v", c.Field, show(c.Old), show(c.New))
+}
+
+func show(v interface{}) interface{} {
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return "unset"
+		}
+		return rv.Elem().Interface()
+	}
+	return v
+}
+
+// Diff compares next against the running config old. It returns the changes
+// when all of them can be applied live, or an error wrapping
+// ErrorUnsafeChange that names every setting needing a restart.
+func Diff(old, next *Config) ([]Change, error) {
+	var changes []Change
+	changes = diffStruct(changes, "node", reflect.ValueOf(old.Node), reflect.ValueOf(next.Node), false)
+	changes = diffStruct(changes, "discovery", reflect.ValueOf(old.Discovery), reflect.ValueOf(next.Discovery), false)
+	for _, og := range old.Groups {
+		prefix := "groups." + og.Name
+		ng, ok := next.Group(og.Name)
+		if !ok {
+			changes = append(changes, Change{Field: prefix, Old: "defined", New: "removed"})
+			continue
+		}
+		changes = diffStruct(changes, prefix, reflect.ValueOf(og), reflect.ValueOf(ng), true)
+	}
+	for _, ng := range next.Groups {
+		if _, ok := old.Group(ng.Name); !ok {
+			changes = append(changes, Change{Field: "groups." + ng.Name, Old: "undefined", New: "added"})
+		}
+	}
+
+	var unsafe []string
+	for _, c := range changes {
+		if !c.safe {
+			unsafe = append(unsafe, c.String())
+		}
+	}
+	if len(unsafe) > 0 {
+		return nil, errors.Wrap(ErrorUnsafeChange, strings.Join(unsafe, "; "))
+	}
+	return changes, nil
+}
+
+// DiffGroup compares two definitions of the same group like Diff does
+func DiffGroup(old, next GroupConfig) ([]Change, error) {
+	return Diff(&Config{Groups: []GroupConfig{old}}, &Config{Groups: []GroupConfig{next}})
+}
+
+// diffStruct appends a Change for every yaml field of a and b that differs
+func diffStruct(changes []Change, prefix string, a, b reflect.Value, group bool) []Change {
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		field := prefix + "." + tag
+		af, bf := a.Field(i), b.Field(i)
+		if af.Kind() == reflect.Struct {
+			changes = diffStruct(changes, field, af, bf, false)
+			continue
+		}
+		if reflect.DeepEqual(af.Interface(), bf.Interface()) {
+			continue
+		}
+		safe := reloadable[field]
+		if group {
+			safe = reloadable[tag]
+		}
+		changes = append(changes, Change{Field: field, Old: af.Interface(), New: bf.Interface(), safe: safe})
+	}
+	return changes
+}
+
+// Watch polls the file at path every interval and calls load, then onChange
+// with its result, whenever the file is modified. Errors from load are logged
+// and the file is checked again on the next modification.
+func Watch(ctx context.Context, path string, interval time.Duration, load func() (*Config, error), onChange func(*Config)) {
+	stat := func() (time.Time, int64) {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, -1
+		}
+		return fi.ModTime(), fi.Size()
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		lastMod, lastSize := stat()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			mod, size := stat()
+			if size < 0 || mod.Equal(lastMod) && size == lastSize {
+				continue
+			}
+			lastMod, lastSize = mod, size
+			c, err := load()
+			if err != nil {
+				log.Printf("config reload of %s failed: %v", path, err)
+				continue
+			}
+			onChange(c)
+		}
+	}()
+}
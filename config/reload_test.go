@@ -0,0 +1,105 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestDiff(t *testing.T) {
+	old, err := Load("../config.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next, _ := Load("../config.example.yaml")
+	next.Node.LogLevel = "debug"
+	next.Groups[0].TTL = time.Minute
+	next.Groups[1].CacheBytes *= 2
+	jitter := time.Duration(0)
+	next.Groups[0].TTLJitter = &jitter
+	changes, err := Diff(old, next)
+	if err != nil {
+		t.Fatalf("safe changes rejected: %v", err)
+	}
+	var fields []string
+	for _, c := range changes {
+		fields = append(fields, c.Field)
+	}
+	want := "node.log_level,groups.scores.ttl,groups.scores.ttl_jitter,groups.sessions.cache_bytes"
+	if strings.Join(fields, ",") != want {
+		t.Fatalf("expected changes %s, got %s", want, strings.Join(fields, ","))
+	}
+	if s := changes[1].String(); s != "groups.scores.ttl: 30s -> 1m0s" {
+		t.Fatalf("unexpected change description %q", s)
+	}
+
+	unsafe := map[string]func(c *Config){
+		"node.port":                   func(c *Config) { c.Node.Port = "9000" },
+		"discovery.peers":             func(c *Config) { c.Discovery.Peers = c.Discovery.Peers[:2] },
+		"groups.scores.eviction":      func(c *Config) { c.Groups[0].Eviction = "lfu" },
+		"groups.scores.origin.type":   func(c *Config) { c.Groups[0].Origin.Type = "http" },
+		"groups.sessions: defined":    func(c *Config) { c.Groups = c.Groups[:1] },
+		"groups.extra: undefined":     func(c *Config) { c.Groups = append(c.Groups, GroupConfig{Name: "extra"}) },
+		"groups.scores.origin.data: ": func(c *Config) { c.Groups[0].Origin.Data = nil },
+	}
+	for field, mutate := range unsafe {
+		next, _ := Load("../config.example.yaml")
+		next.Node.LogLevel = "debug"
+		mutate(next)
+		changes, err := Diff(old, next)
+		if errors.Cause(err) != ErrorUnsafeChange || changes != nil {
+			t.Fatalf("%s: expected ErrorUnsafeChange, got %v", field, err)
+		}
+		if !strings.Contains(err.Error(), field) || strings.Contains(err.Error(), "log_level") {
+			t.Fatalf("%s: error should name only the unsafe setting, got %v", field, err)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nexuscache.yaml")
+	write := func(level string) {
+		data := "node:\n  name: a\n  log_level: " + level + "\ndiscovery:\n  peers: [a]\n"
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("info")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloaded := make(chan *Config, 1)
+	load := func() (*Config, error) {
+		c, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		return c, c.Validate()
+	}
+	Watch(ctx, path, 10*time.Millisecond, load, func(c *Config) {
+		reloaded <- c
+	})
+
+	time.Sleep(50 * time.Millisecond)
+	write("debug!") // invalid, grows the file so the edit is seen within the mtime granularity
+	select {
+	case c := <-reloaded:
+		t.Fatalf("unexpected reload %+v", c)
+	case <-time.After(100 * time.Millisecond):
+	}
+	write("debug")
+	select {
+	case c := <-reloaded:
+		if c.Node.LogLevel != "debug" {
+			t.Fatalf("expected the edited log level, got %q", c.Node.LogLevel)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("edit of the config file was not picked up")
+	}
+}
@@ -6,23 +6,39 @@ import (
 	"fmt"
 	"log"
 	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 // Package connect provides gRPC client functionality for calling remote nodes' Get and Set methods
 
+// migrateTimeout bounds a whole Migrate stream, which may carry many entries
+const migrateTimeout = 30 * time.Second
+
 type Client struct {
-	Name string
+	Name string // Registered node name, used to discover the node in etcd
+	Addr string // Address the node advertised, for logging
 	Etcd *Etcd
 }
 
 func newClient(name string, etcd *Etcd) *Client {
-	return &Client{name, etcd}
+	return &Client{Name: name, Etcd: etcd}
+}
+
+// dial connects to the node through etcd, or straight to Addr when the client
+// has no etcd, as in tests
+func (c *Client) dial() (*grpc.ClientConn, error) {
+	if c.Etcd == nil {
+		return grpc.NewClient(c.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+	return DialPeer(c.Etcd.EtcdCli, c.Name)
 }
 
-func (c *Client) Get(group string, key string) ([]byte, error) {
+func (c *Client) Get(group string, key string) (*pb.GetResponse, error) {
 
 	// Use etcd for service discovery to get grpc connection
-	conn, err := DialPeer(c.Etcd.EtcdCli, c.Name)
+	conn, err := c.dial()
 	if err != nil {
 		return nil, err
 	}
@@ -37,16 +53,16 @@ func (c *Client) Get(group string, key string) ([]byte, error) {
 		Key:   key,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("could not get %s/%s from peer %s", group, key, c.Name)
+		return nil, fmt.Errorf("could not get %s/%s from peer %s: %w", group, key, c.Name, err)
 	}
 	log.Println("In client.Get, grpcClient.Get Done, resp :", resp)
-	return resp.GetValue(), nil
+	return resp, nil
 }
 
-func (c *Client) Set(group string, key string, value []byte, expire time.Time, ishot bool) error {
+func (c *Client) Set(group string, key string, value []byte, expire time.Time, flags uint32, tags []string, ishot bool, pinned bool) error {
 
 	// Use etcd for service discovery to get grpc connection
-	conn, err := DialPeer(c.Etcd.EtcdCli, c.Name)
+	conn, err := c.dial()
 	if err != nil {
 		return err
 	}
@@ -61,7 +77,10 @@ func (c *Client) Set(group string, key string, value []byte, expire time.Time, i
 		Key:    key,
 		Value:  value,
 		Expire: expire.Unix(),
+		Flags:  flags,
+		Tags:   tags,
 		Ishot:  ishot,
+		Pinned: pinned,
 	})
 	if err != nil {
 		log.Println("grpcClient.Set Error:", err)
@@ -73,5 +92,159 @@ func (c *Client) Set(group string, key string, value []byte, expire time.Time, i
 	return nil
 }
 
+// Peek returns the cached value of key on the remote peer and its expiry.
+// Keys the peer has not cached fail with the NotFound status.
+func (c *Client) Peek(group string, key string) (*pb.GetResponse, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	grpcClient := pb.NewNexusCacheClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	resp, err := grpcClient.Get(ctx, &pb.GetRequest{Group: group, Key: key, Peek: true})
+	if err != nil {
+		return nil, fmt.Errorf("could not peek %s/%s on peer %s: %w", group, key, c.Name, err)
+	}
+	return resp, nil
+}
+
+// Delete drops key from the remote peer's cache
+func (c *Client) Delete(group string, key string) (bool, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	grpcClient := pb.NewNexusCacheClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	resp, err := grpcClient.Delete(ctx, &pb.DeleteRequest{Group: group, Key: key})
+	if err != nil {
+		return false, fmt.Errorf("could not delete %s/%s on peer %s: %w", group, key, c.Name, err)
+	}
+	return resp.GetDeleted(), nil
+}
+
+// ttlMs returns the time left until expire in milliseconds for the owner,
+// at least 1, or 0 for a zero expire
+func ttlMs(expire time.Time) int64 {
+	if expire.IsZero() {
+		return 0
+	}
+	return max(time.Until(expire).Milliseconds(), 1)
+}
+
+// CompareAndSet stores value on the remote peer if key has version there
+func (c *Client) CompareAndSet(group string, key string, version uint64, value []byte, expire time.Time, flags uint32, tags []string) (uint64, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	grpcClient := pb.NewNexusCacheClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	resp, err := grpcClient.CompareAndSet(ctx, &pb.CompareAndSetRequest{
+		Group:   group,
+		Key:     key,
+		Value:   value,
+		TtlMs:   ttlMs(expire),
+		Flags:   flags,
+		Version: version,
+		Tags:    tags,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("could not compare and set %s/%s on peer %s: %w", group, key, c.Name, err)
+	}
+	return resp.GetVersion(), nil
+}
+
+// Incr adds delta to the integer value of key on the remote peer
+func (c *Client) Incr(group string, key string, delta int64, expire time.Time) (int64, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	grpcClient := pb.NewNexusCacheClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	resp, err := grpcClient.Incr(ctx, &pb.IncrRequest{Group: group, Key: key, Delta: delta, TtlMs: ttlMs(expire)})
+	if err != nil {
+		return 0, fmt.Errorf("could not incr %s/%s on peer %s: %w", group, key, c.Name, err)
+	}
+	return resp.GetValue(), nil
+}
+
+// Invalidate drops the keys set with tag, or starting with prefix, from the
+// remote peer's caches
+func (c *Client) Invalidate(group string, tag string, prefix string) (int64, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	grpcClient := pb.NewNexusCacheClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	resp, err := grpcClient.Invalidate(ctx, &pb.InvalidateRequest{Group: group, Tag: tag, Prefix: prefix})
+	if err != nil {
+		return 0, fmt.Errorf("could not invalidate %s on peer %s: %w", group, c.Name, err)
+	}
+	return resp.GetRemoved(), nil
+}
+
+// Flush drops every key of group from the remote peer's caches
+func (c *Client) Flush(group string) error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	grpcClient := pb.NewNexusCacheClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := grpcClient.Flush(ctx, &pb.FlushRequest{Group: group}); err != nil {
+		return fmt.Errorf("could not flush %s on peer %s: %w", group, c.Name, err)
+	}
+	return nil
+}
+
+// Migrate streams entries to the remote peer, which takes them over as their
+// new owner, and returns how many entries the peer accepted
+func (c *Client) Migrate(entries []*pb.MigrateEntry) (int64, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	grpcClient := pb.NewNexusCacheClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), migrateTimeout)
+	defer cancel()
+	stream, err := grpcClient.Migrate(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		if err := stream.Send(entry); err != nil {
+			return 0, fmt.Errorf("could not migrate %s/%s to peer %s: %v", entry.Group, entry.Key, c.Name, err)
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return 0, err
+	}
+	return resp.GetReceived(), nil
+}
+
 // Verify that Client implements the PeerGetter interface
 var _ PeerGetter = (*Client)(nil)
@@ -2,6 +2,7 @@ package connect
 
 import (
 	"context"
+	"fmt"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/client/v3/naming/resolver"
 	"google.golang.org/grpc"
@@ -29,14 +30,67 @@ func DialPeer(c *clientv3.Client, service string) (conn *grpc.ClientConn, err er
 
 // GetAddrByName discovers a service by name in etcd and returns its IP address
 func GetAddrByName(c *clientv3.Client, name string) (addr string, err error) {
+	node, err := GetNodeByName(c, name)
+	if err != nil {
+		return "", err
+	}
+	return node.Addr, nil
+}
+
+// GetNodeByName discovers a service by name in etcd and returns its registration
+func GetNodeByName(c *clientv3.Client, name string) (node NodeInfo, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 	//log.Printf("debug, In discover.GetAddrByName, after get ctx")
 	resp, err := c.Get(ctx, name)
 	if err != nil {
-		return "", err
+		return NodeInfo{}, err
+	}
+	if len(resp.Kvs) == 0 {
+		return NodeInfo{}, fmt.Errorf("service %s is not registered", name)
+	}
+	return ParseNodeInfo(resp.Kvs[0].Value), nil
+}
+
+// WatchNodes watches the registrations of names until ctx is done. onChange is
+// called when a node registers or updates its registration, and with
+// deleted=true when the registration disappears (lease revoked or expired).
+func WatchNodes(ctx context.Context, c *clientv3.Client, names []string, onChange func(name string, node NodeInfo, deleted bool)) {
+	for _, name := range names {
+		go func(name string) {
+			for resp := range c.Watch(ctx, name) {
+				for _, ev := range resp.Events {
+					if ev.Type == clientv3.EventTypeDelete {
+						onChange(name, NodeInfo{}, true)
+					} else {
+						onChange(name, ParseNodeInfo(ev.Kv.Value), false)
+					}
+				}
+			}
+		}(name)
+	}
+}
+
+// WatchPrefix calls onChange for every key under prefix and then, until ctx
+// is done, for every later put or delete of a key under prefix
+func WatchPrefix(ctx context.Context, c *clientv3.Client, prefix string, onChange func(key string, value []byte, deleted bool)) error {
+	getCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	resp, err := c.Get(getCtx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return err
+	}
+	for _, kv := range resp.Kvs {
+		onChange(string(kv.Key), kv.Value, false)
 	}
-	return string(resp.Kvs[0].Value), nil
+	go func() {
+		for wresp := range c.Watch(ctx, prefix, clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1)) {
+			for _, ev := range wresp.Events {
+				onChange(string(ev.Kv.Key), ev.Kv.Value, ev.Type == clientv3.EventTypeDelete)
+			}
+		}
+	}()
+	return nil
 }
 
 //func CheckIf
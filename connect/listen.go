@@ -0,0 +1,34 @@
+package connect
+
+import (
+	"context"
+	"net"
+	"os"
+	"strings"
+)
+
+// ParseAddr splits a listen address into network and address. Addresses of
+// the form unix:///path/to.sock or unix:/path/to.sock are Unix domain sockets,
+// everything else is a TCP host:port.
+func ParseAddr(addr string) (network, address string) {
+	switch {
+	case strings.HasPrefix(addr, "unix://"):
+		return "unix", strings.TrimPrefix(addr, "unix://")
+	case strings.HasPrefix(addr, "unix:"):
+		return "unix", strings.TrimPrefix(addr, "unix:")
+	}
+	return "tcp", addr
+}
+
+// Listen binds addr, see ParseAddr for the accepted forms. A socket file left
+// behind by a previous run is removed before binding a Unix socket.
+func Listen(ctx context.Context, addr string) (net.Listener, error) {
+	network, address := ParseAddr(addr)
+	if network == "unix" {
+		if fi, err := os.Lstat(address); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(address)
+		}
+	}
+	var lc net.ListenConfig
+	return lc.Listen(ctx, network, address)
+}
@@ -1,6 +1,9 @@
 package connect
 
-import "time"
+import (
+	pb "NexusCache/nexuscachepb"
+	"time"
+)
 
 // Package connect provides RPC communication functionality between nodes
 
@@ -9,10 +12,39 @@ type PeerPicker interface {
 	PickPeer(key string) (peer PeerGetter, ok bool)
 }
 
+// LoadPeerPicker is implemented by pickers that may send a read-through load
+// to another node than the owner, e.g. with bounded loads. Writes, deletes and
+// peeks always go to the owner returned by PickPeer.
+type LoadPeerPicker interface {
+	PickLoadPeer(key string) (peer PeerGetter, ok bool)
+}
+
 // PeerGetter defines the ability to fetch cache from a remote node (implemented by Client)
 // In the connect.client package, the Client struct has Get and Set methods below,
 // satisfying this interface, so it can be used as a PeerGetter
 type PeerGetter interface {
-	Get(group string, key string) ([]byte, error)
-	Set(group string, key string, value []byte, expire time.Time, ishot bool) error
+	// Get returns the value of a key with its remaining TTL and flags
+	Get(group string, key string) (*pb.GetResponse, error)
+	Set(group string, key string, value []byte, expire time.Time, flags uint32, tags []string, ishot bool, pinned bool) error
+	// Peek is Get without loading the key from the origin when it is not cached
+	Peek(group string, key string) (*pb.GetResponse, error)
+	// Delete drops a key from the cache and reports whether it was cached
+	Delete(group string, key string) (bool, error)
+	// CompareAndSet stores a value if the key has the given version, or if it
+	// is not cached when version is 0, and returns the new version
+	CompareAndSet(group string, key string, version uint64, value []byte, expire time.Time, flags uint32, tags []string) (uint64, error)
+	// Incr adds delta to an integer value, creating it to expire at expire
+	Incr(group string, key string, delta int64, expire time.Time) (int64, error)
+	// Invalidate drops the keys set with tag, or starting with prefix, from
+	// the peer's caches and returns how many were dropped
+	Invalidate(group string, tag string, prefix string) (int64, error)
+	// Flush drops every key of a group from the peer's caches
+	Flush(group string) error
+}
+
+// PeerLister is implemented by pickers that know every node of the cluster,
+// for operations that must reach all of them
+type PeerLister interface {
+	// AllPeers returns the other nodes by name
+	AllPeers() map[string]PeerGetter
 }
@@ -1,6 +1,7 @@
 package connect
 
 import (
+	"encoding/json"
 	"fmt"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/client/v3/naming/endpoints"
@@ -15,6 +16,31 @@ var (
 	defaultLeaseExpTime = 10
 )
 
+// NodeInfo is the registration value a node publishes in etcd under its name
+type NodeInfo struct {
+	Addr   string `json:"addr"`
+	Weight int    `json:"weight"` // Relative capacity, scales the node's virtual nodes
+}
+
+// Encode serializes the registration for etcd
+func (n NodeInfo) Encode() string {
+	b, _ := json.Marshal(n)
+	return string(b)
+}
+
+// ParseNodeInfo decodes a registration value. Values written by older nodes
+// contain only the address and get weight 1.
+func ParseNodeInfo(value []byte) NodeInfo {
+	var node NodeInfo
+	if err := json.Unmarshal(value, &node); err != nil || node.Addr == "" {
+		return NodeInfo{Addr: string(value), Weight: 1}
+	}
+	if node.Weight < 1 {
+		node.Weight = 1
+	}
+	return node
+}
+
 type Etcd struct {
 	EtcdCli *clientv3.Client
 	leaseId clientv3.LeaseID // 租约ID
@@ -117,8 +143,8 @@ func (s *Etcd) KeepAlive() error {
 //	return nil
 //}
 
-// RegisterServer stores serviceName as key and addr as value in etcd
-func (s *Etcd) RegisterServer(serviceName, addr string) error {
+// RegisterServer stores serviceName as key and the node's address and weight as value in etcd
+func (s *Etcd) RegisterServer(serviceName, addr string, weight int) error {
 	// Create lease
 	err := s.CreateLease(defaultLeaseExpTime)
 	if err != nil {
@@ -126,7 +152,7 @@ func (s *Etcd) RegisterServer(serviceName, addr string) error {
 		return err
 	}
 	// Bind lease to service
-	err = s.BindLease(serviceName, addr)
+	err = s.BindLease(serviceName, NodeInfo{Addr: addr, Weight: weight}.Encode())
 	if err != nil {
 		log.Println("bind etcd register err:", err)
 		return err
@@ -145,3 +171,18 @@ func (s *Etcd) RegisterServer(serviceName, addr string) error {
 	}
 	return em.AddEndpoint(s.ctx, serviceName+"/"+addr, endpoints.Endpoint{Addr: addr}, clientv3.WithLease(s.leaseId))
 }
+
+// Deregister revokes the node's lease, which removes its registration and its
+// discovery endpoint from etcd at once instead of waiting for the lease to expire
+func (s *Etcd) Deregister(ctx context.Context) error {
+	if s.leaseId == clientv3.NoLease {
+		return nil
+	}
+	_, err := s.EtcdCli.Revoke(ctx, s.leaseId)
+	if err != nil {
+		return err
+	}
+	log.Println("revoke lease success:", s.leaseId)
+	s.leaseId = clientv3.NoLease
+	return nil
+}
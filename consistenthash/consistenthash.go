@@ -4,90 +4,269 @@ import (
 	"crypto/md5"
 	"fmt"
 	"github.com/segmentio/fasthash/fnv1"
+	"math"
 	"sort"
 	"strconv"
 	"sync"
+	"sync/atomic"
 )
 
 type Hash func(data []byte) uint64
 
 type Map struct {
-	sync.Mutex
-	hash     Hash           // Hash function to use
-	replicas int            // Number of virtual nodes per real node
-	keys     []int          // Sorted array of hash values (the hash ring)
-	hashMap  map[int]string // Map from virtual node hash to real node
+	mu       sync.Mutex          // Serializes writers, readers use the ring snapshot
+	hash     Hash                // Hash function to use
+	replicas int                 // Number of virtual nodes per unit of weight
+	weights  map[string]int      // Weight of every real node, scales its virtual nodes
+	vnodes   map[string][]uint64 // Virtual node positions of every real node
+	ring     atomic.Pointer[ring]
+
+	// Consistent hashing with bounded loads: a node may take a key only while
+	// its load stays below (1+loadFactor) times the average load.
+	loadMu     sync.Mutex
+	loadFactor float64          // 0 disables bounded loads
+	loads      map[string]int64 // In-flight requests per real node
+	totalLoad  int64            // Sum of loads
+}
+
+// ring is an immutable snapshot of the hash ring. Writers build a new ring and
+// swap it in, so lookups never observe a half-updated ring and need no lock.
+type ring struct {
+	keys  []uint64 // Sorted virtual node positions
+	nodes []string // nodes[i] is the real node owning keys[i]
+	count int      // Number of real nodes
 }
 
 func New(replicas int, fn Hash) *Map {
 	m := &Map{
 		replicas: replicas,
 		hash:     fn,
-		hashMap:  make(map[int]string),
+		weights:  make(map[string]int),
+		vnodes:   make(map[string][]uint64),
+		loads:    make(map[string]int64),
 	}
 	// If no hash function provided, use default fnv1 algorithm
 	if m.hash == nil {
 		m.hash = fnv1.HashBytes64
 		// m.hash = crc32.ChecksumIEEE
 	}
+	m.ring.Store(&ring{})
 	return m
 }
 
 // AddNodes add some nodes to hash
 func (m *Map) AddNodes(keys ...string) {
-	m.Lock()
-	defer m.Unlock()
-	//log.Println("In consistenthash.AddNodes, keys =", keys)
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	for _, key := range keys {
-		// Create virtual nodes for each real node to solve data skew in consistent hashing
-		for i := 0; i < m.replicas; i++ {
-			// Calculate hash value for virtual node
-			hash := int(m.hash([]byte(fmt.Sprintf("%x", md5.Sum([]byte(strconv.Itoa(i)+key))))))
-			m.keys = append(m.keys, hash)
-			m.hashMap[hash] = key // Record mapping: hashMap[virtual node hash] = real node key
+		m.addNode(key, 1)
+	}
+	m.rebuild()
+}
+
+// AddWeightedNode adds a node owning weight*replicas virtual nodes, so that a
+// node with weight 2 receives about twice the keys of a node with weight 1.
+// Adding a node again replaces its weight.
+func (m *Map) AddWeightedNode(key string, weight int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.addNode(key, weight)
+	m.rebuild()
+}
+
+func (m *Map) addNode(key string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	m.weights[key] = weight
+	// Create virtual nodes for each real node to solve data skew in consistent hashing
+	positions := make([]uint64, m.replicas*weight)
+	for i := range positions {
+		// Calculate hash value for virtual node
+		positions[i] = m.hash([]byte(fmt.Sprintf("%x", md5.Sum([]byte(strconv.Itoa(i)+key)))))
+	}
+	m.vnodes[key] = positions
+	m.loadMu.Lock()
+	if _, ok := m.loads[key]; !ok {
+		m.loads[key] = 0
+	}
+	m.loadMu.Unlock()
+}
+
+// rebuild builds a new ring from the virtual nodes and publishes it.
+// When two virtual nodes land on the same position the one of the node with
+// the smallest name wins, so the ring only depends on the set of nodes and
+// not on the order they were added or removed in.
+func (m *Map) rebuild() {
+	type vnode struct {
+		pos  uint64
+		node string
+	}
+	var all []vnode
+	for node, positions := range m.vnodes {
+		for _, pos := range positions {
+			all = append(all, vnode{pos, node})
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].pos != all[j].pos {
+			return all[i].pos < all[j].pos
+		}
+		return all[i].node < all[j].node
+	})
+	r := &ring{count: len(m.vnodes)}
+	for i, v := range all {
+		if i > 0 && all[i-1].pos == v.pos {
+			continue // collision, the smaller node name already owns this position
 		}
+		r.keys = append(r.keys, v.pos)
+		r.nodes = append(r.nodes, v.node)
+	}
+	m.ring.Store(r)
+}
+
+// search returns the index of the first virtual node at or after hash,
+// wrapping around to 0 past the end of the ring
+func (r *ring) search(hash uint64) int {
+	idx := sort.Search(len(r.keys), func(i int) bool {
+		return r.keys[i] >= hash
+	})
+	if idx == len(r.keys) {
+		idx = 0
 	}
-	sort.Ints(m.keys) // Sort the hash ring
-	//fmt.Printf("In consistenthash.AddNodes, m.keys = %v, m.hashMap = %v \n", m.keys, m.hashMap)
+	return idx
 }
 
 // Get finds the real node that should store the given key and returns its IP address
 func (m *Map) Get(key string) string {
+	r := m.ring.Load()
+	if len(r.keys) == 0 {
+		return ""
+	}
+	return r.nodes[r.search(m.hash([]byte(key)))]
+}
 
-	if len(m.keys) == 0 {
+// Remove deletes all virtual nodes of key from the ring
+func (m *Map) Remove(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.vnodes[key]; !ok {
+		return
+	}
+	delete(m.vnodes, key)
+	delete(m.weights, key)
+	m.rebuild()
+	m.loadMu.Lock()
+	m.totalLoad -= m.loads[key]
+	delete(m.loads, key)
+	m.loadMu.Unlock()
+}
+
+// Nodes returns the real nodes on the ring
+func (m *Map) Nodes() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return sortedNodes(m.weights)
+}
+
+// SetLoadFactor enables bounded loads with the given epsilon, so that no node
+// is handed more than ceil((1+epsilon) * average load). 0 disables it.
+func (m *Map) SetLoadFactor(epsilon float64) {
+	m.loadMu.Lock()
+	defer m.loadMu.Unlock()
+	m.loadFactor = epsilon
+}
+
+// BoundedLoad reports whether GetLeast applies the load bound
+func (m *Map) BoundedLoad() bool {
+	m.loadMu.Lock()
+	defer m.loadMu.Unlock()
+	return m.loadFactor > 0
+}
+
+// Inc records a new in-flight request on node
+func (m *Map) Inc(node string) {
+	m.loadMu.Lock()
+	defer m.loadMu.Unlock()
+	if _, ok := m.loads[node]; ok {
+		m.loads[node]++
+		m.totalLoad++
+	}
+}
+
+// Done records the end of a request started with Inc
+func (m *Map) Done(node string) {
+	m.loadMu.Lock()
+	defer m.loadMu.Unlock()
+	if l, ok := m.loads[node]; ok && l > 0 {
+		m.loads[node]--
+		m.totalLoad--
+	}
+}
+
+// Load returns the number of in-flight requests on node
+func (m *Map) Load(node string) int64 {
+	m.loadMu.Lock()
+	defer m.loadMu.Unlock()
+	return m.loads[node]
+}
+
+// GetLeast works like Get, but when bounded loads are enabled it walks the ring
+// clockwise from the key's position and returns the first node whose load is
+// still under the bound.
+func (m *Map) GetLeast(key string) string {
+	r := m.ring.Load()
+	if len(r.keys) == 0 {
 		return ""
 	}
-	hash := int(m.hash([]byte(key)))
-	//idx := sort.Search(len(m.keys), func(i int) bool {
-	//	return m.keys[i] >= hash
-	//})
-
-	// Binary search to find the node
-	// Note: j is len(m.keys) not len(m.keys)-1, so when hash > max value on ring,
-	// the result will be len(m.keys)
-	i, j := 0, len(m.keys)
-	for i < j {
-		mid := uint((i + j) >> 1)
-		if m.keys[mid] >= hash {
-			j = int(mid)
-		} else if m.keys[mid] < hash {
-			i = int(mid) + 1
+	idx := r.search(m.hash([]byte(key)))
+	m.loadMu.Lock()
+	defer m.loadMu.Unlock()
+	if m.loadFactor <= 0 {
+		return r.nodes[idx]
+	}
+	// Every node may take up to ceil((1+ε) * (total+1) / n) requests, so some
+	// node is always below the bound and the walk terminates.
+	avg := float64(m.totalLoad+1) / float64(r.count)
+	bound := int64(math.Ceil(avg * (1 + m.loadFactor)))
+	for i := 0; i < len(r.keys); i++ {
+		node := r.nodes[(idx+i)%len(r.keys)]
+		if m.loads[node]+1 <= bound {
+			return node
 		}
 	}
-	idx := i
-	// Special case: when hash value exceeds the max node hash on the ring,
-	// we need to wrap around to the first node.
-	// When this happens with 9 nodes, idx would equal 9,
-	// so we use modulo to map idx=9 back to 0 (first node)
-	return m.hashMap[m.keys[idx%len(m.keys)]]
+	return r.nodes[idx]
 }
 
-func (m *Map) Remove(key string) {
-	m.Lock()
-	defer m.Unlock()
-	for i := 0; i < m.replicas; i++ {
-		hash := int(m.hash([]byte(fmt.Sprintf("%x", md5.Sum([]byte(strconv.Itoa(i)+key))))))
-		idx := sort.SearchInts(m.keys, hash)
-		m.keys = append(m.keys[:idx], m.keys[idx+1:]...)
+// Distribution reports the expected share of keys owned by every node, i.e.
+// the fraction of the hash ring covered by its virtual nodes. Shares sum to 1.
+func (m *Map) Distribution() map[string]float64 {
+	r := m.ring.Load()
+	dist := make(map[string]float64)
+	n := len(r.keys)
+	for i, pos := range r.keys {
+		// A virtual node owns the arc between its predecessor and itself;
+		// uint64 arithmetic makes the first arc wrap around the ring.
+		arc := pos - r.keys[(i+n-1)%n]
+		if n == 1 {
+			arc = math.MaxUint64
+		}
+		dist[r.nodes[i]] += float64(arc) / math.MaxUint64
+	}
+	return dist
+}
+
+// Clone copies the ring. Load counters start from zero in the copy.
+func (m *Map) Clone() Placement {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := New(m.replicas, m.hash)
+	for node, weight := range m.weights {
+		c.weights[node] = weight
+		c.vnodes[node] = m.vnodes[node] // positions are never modified in place
+		c.loads[node] = 0
 	}
+	c.loadFactor = m.loadFactor
+	c.ring.Store(m.ring.Load())
+	return c
 }
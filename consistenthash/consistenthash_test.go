@@ -0,0 +1,246 @@
+package consistenthash
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"testing/quick"
+
+	"github.com/segmentio/fasthash/fnv1"
+)
+
+func TestGetLeastBoundedLoad(t *testing.T) {
+	m := New(50, nil)
+	m.AddNodes("a", "b", "c")
+	owner := m.Get("hot-key")
+	if got := m.GetLeast("hot-key"); got != owner {
+		t.Fatalf("without bounded loads GetLeast should match Get, got %s want %s", got, owner)
+	}
+
+	m.SetLoadFactor(0.25)
+	// Pile requests for the same key onto its owner until it hits the bound
+	for i := 0; i < 10; i++ {
+		m.Inc(m.GetLeast("hot-key"))
+	}
+	// avg = 10/3, bound = ceil(11/3 * 1.25) = 5
+	for _, node := range []string{"a", "b", "c"} {
+		if l := m.Load(node); l > 5 {
+			t.Fatalf("node %s carries %d requests, above the bound", node, l)
+		}
+	}
+	if m.Load(owner) == 10 {
+		t.Fatalf("all load went to owner %s", owner)
+	}
+
+	for _, node := range []string{"a", "b", "c"} {
+		for m.Load(node) > 0 {
+			m.Done(node)
+		}
+	}
+	if got := m.GetLeast("hot-key"); got != owner {
+		t.Fatalf("idle ring should route to owner %s, got %s", owner, got)
+	}
+}
+
+func TestGetLeastSkipsOverloadedNode(t *testing.T) {
+	m := New(50, nil)
+	m.AddNodes("a", "b")
+	m.SetLoadFactor(0.1)
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		owner := m.Get(key)
+		m.Inc(owner)
+		m.Inc(owner)
+		if got := m.GetLeast(key); got == owner {
+			t.Fatalf("key %s routed to overloaded owner %s", key, owner)
+		}
+		m.Done(owner)
+		m.Done(owner)
+	}
+}
+
+func TestWeightedDistribution(t *testing.T) {
+	m := New(50, nil)
+	m.AddWeightedNode("small", 1)
+	m.AddWeightedNode("large", 8)
+	dist := m.Distribution()
+	if sum := dist["small"] + dist["large"]; sum < 0.999 || sum > 1.001 {
+		t.Fatalf("shares should sum to 1, got %f", sum)
+	}
+	if dist["large"] < 4*dist["small"] {
+		t.Fatalf("large node should own most keys, got %v", dist)
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		counts[m.Get(strconv.Itoa(i))]++
+	}
+	if counts["large"] < 4*counts["small"] {
+		t.Fatalf("weighted lookup is unbalanced: %v", counts)
+	}
+
+	m.Remove("large")
+	if got := m.Get("any"); got != "small" {
+		t.Fatalf("after removing large every key belongs to small, got %s", got)
+	}
+}
+
+// ringConfig is a random cluster used by the property tests
+type ringConfig struct {
+	Nodes []string
+	Keys  []string
+	Seed  int64
+}
+
+func (ringConfig) Generate(r *rand.Rand, size int) reflect.Value {
+	cfg := ringConfig{Seed: r.Int63()}
+	n := 2 + r.Intn(10)
+	for i := 0; i < n; i++ {
+		cfg.Nodes = append(cfg.Nodes, fmt.Sprintf("10.0.%d.%d:8888", r.Intn(256), r.Intn(256)))
+	}
+	for i := 0; i < 500; i++ {
+		cfg.Keys = append(cfg.Keys, strconv.FormatUint(r.Uint64(), 36))
+	}
+	return reflect.ValueOf(cfg)
+}
+
+func owners(m *Map, keys []string) map[string]string {
+	out := make(map[string]string, len(keys))
+	for _, key := range keys {
+		out[key] = m.Get(key)
+	}
+	return out
+}
+
+func TestPropertyAddMovesKeysOnlyToNewNode(t *testing.T) {
+	f := func(cfg ringConfig) bool {
+		m := New(50, nil)
+		m.AddNodes(cfg.Nodes[1:]...)
+		before := owners(m, cfg.Keys)
+		m.AddNodes(cfg.Nodes[0])
+		for key, owner := range owners(m, cfg.Keys) {
+			if owner != before[key] && owner != cfg.Nodes[0] {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPropertyRemoveMovesOnlyRemovedKeys(t *testing.T) {
+	f := func(cfg ringConfig) bool {
+		m := New(50, nil)
+		m.AddNodes(cfg.Nodes...)
+		before := owners(m, cfg.Keys)
+		m.Remove(cfg.Nodes[0])
+		for key, owner := range owners(m, cfg.Keys) {
+			if owner == cfg.Nodes[0] {
+				return false
+			}
+			if before[key] != cfg.Nodes[0] && owner != before[key] {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPropertyOrderIndependent(t *testing.T) {
+	f := func(cfg ringConfig) bool {
+		a := New(50, nil)
+		a.AddNodes(cfg.Nodes...)
+
+		b := New(50, nil)
+		shuffled := append([]string(nil), cfg.Nodes...)
+		rand.New(rand.NewSource(cfg.Seed)).Shuffle(len(shuffled), func(i, j int) {
+			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		})
+		b.AddNodes("transient")
+		for _, node := range shuffled {
+			b.AddNodes(node)
+		}
+		b.Remove("transient")
+		return reflect.DeepEqual(a.ring.Load(), b.ring.Load())
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollisionResolution(t *testing.T) {
+	// A hash with only 4 distinct values forces virtual nodes to collide
+	collide := func(data []byte) uint64 {
+		return fnv1.HashBytes64(data) % 4 * (math.MaxUint64 / 4)
+	}
+	a := New(10, collide)
+	a.AddNodes("b", "a")
+	b := New(10, collide)
+	b.AddNodes("a")
+	b.AddNodes("b")
+	if !reflect.DeepEqual(a.ring.Load(), b.ring.Load()) {
+		t.Fatalf("collisions must be resolved independently of insertion order")
+	}
+	for _, node := range a.ring.Load().nodes {
+		if node != "a" {
+			t.Fatalf("colliding positions should belong to the smallest node, got %s", node)
+		}
+	}
+	// Once the winner leaves its positions go to the other node
+	a.Remove("a")
+	if got := a.Get("key"); got != "b" {
+		t.Fatalf("expected b after removing a, got %s", got)
+	}
+	a.Remove("b")
+	if got := a.Get("key"); got != "" {
+		t.Fatalf("empty ring should return no node, got %s", got)
+	}
+}
+
+func TestConcurrentLookups(t *testing.T) {
+	m := New(50, nil)
+	m.AddNodes("a", "b", "c")
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	base := owners(m, keys)
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; ; j++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				// A key is either on its original owner or on a transient node
+				key := keys[j%len(keys)]
+				if node := m.Get(key); node != base[key] && node != "d" && node != "e" {
+					t.Errorf("lookup of %s returned %q during membership change", key, node)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		m.AddNodes("d")
+		m.Remove("d")
+		m.AddWeightedNode("e", 2)
+		m.Remove("e")
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,101 @@
+package consistenthash
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/segmentio/fasthash/fnv1"
+)
+
+// Jump implements Lamping and Veach's jump consistent hash. Lookups take
+// O(log n) with no memory beyond the bucket list, but buckets can only be
+// added or removed at the end without moving extra keys.
+// Weights are honored by giving a node weight buckets. Buckets follow the
+// sorted node names, so nodes that added the same nodes in another order, or
+// re-added one, agree on the owners. In exchange, both adding and removing a
+// node renumber the buckets of the nodes whose names sort after it, and move
+// far more keys than the ring would unless the node's name sorts last.
+type Jump struct {
+	mu      sync.RWMutex
+	hash    Hash
+	buckets []string       // Bucket number -> node, in node name order
+	weights map[string]int // Weight of every node
+}
+
+func NewJump(fn Hash) *Jump {
+	if fn == nil {
+		fn = fnv1.HashBytes64
+	}
+	return &Jump{hash: fn, weights: make(map[string]int)}
+}
+
+func (j *Jump) AddWeightedNode(node string, weight int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if weight < 1 {
+		weight = 1
+	}
+	j.weights[node] = weight
+	j.rebuildLocked()
+}
+
+func (j *Jump) Remove(node string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	delete(j.weights, node)
+	j.rebuildLocked()
+}
+
+// rebuildLocked lays out the buckets of every node in the order of their names
+func (j *Jump) rebuildLocked() {
+	nodes := make([]string, 0, len(j.weights))
+	for node := range j.weights {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	buckets := make([]string, 0, len(j.buckets))
+	for _, node := range nodes {
+		for i := 0; i < j.weights[node]; i++ {
+			buckets = append(buckets, node)
+		}
+	}
+	j.buckets = buckets
+}
+
+func (j *Jump) Get(key string) string {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if len(j.buckets) == 0 {
+		return ""
+	}
+	return j.buckets[jumpHash(j.hash([]byte(key)), len(j.buckets))]
+}
+
+func (j *Jump) Distribution() map[string]float64 {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return weightShares(j.weights)
+}
+
+// jumpHash maps key to a bucket in [0, buckets), see
+// "A Fast, Minimal Memory, Consistent Hash Algorithm" (Lamping, Veach 2014)
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+func (j *Jump) Clone() Placement {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	c := NewJump(j.hash)
+	for node, weight := range j.weights {
+		c.weights[node] = weight
+	}
+	c.buckets = append(c.buckets, j.buckets...)
+	return c
+}
@@ -0,0 +1,121 @@
+package consistenthash
+
+import (
+	"sync"
+
+	"github.com/segmentio/fasthash/fnv1"
+)
+
+// DefaultMaglevTableSize is the lookup table size, a prime much larger than
+// the expected number of nodes
+const DefaultMaglevTableSize = 65537
+
+// Maglev implements Google's Maglev hashing: every node fills slots of a fixed
+// lookup table following its own permutation, giving O(1) lookups and near
+// perfect balance. Membership changes move slightly more keys than the ring.
+type Maglev struct {
+	mu      sync.RWMutex
+	hash    Hash
+	size    uint64         // Table size, must be prime
+	nodes   []string       // Sorted nodes, table entries index into it
+	weights map[string]int // Weight of every node
+	table   []int          // Slot -> index in nodes
+}
+
+func NewMaglev(size uint64, fn Hash) *Maglev {
+	if fn == nil {
+		fn = fnv1.HashBytes64
+	}
+	if size == 0 {
+		size = DefaultMaglevTableSize
+	}
+	return &Maglev{hash: fn, size: size, weights: make(map[string]int)}
+}
+
+func (m *Maglev) AddWeightedNode(node string, weight int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if weight < 1 {
+		weight = 1
+	}
+	m.weights[node] = weight
+	m.populate()
+}
+
+func (m *Maglev) Remove(node string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.weights, node)
+	m.populate()
+}
+
+// populate rebuilds the lookup table. Nodes take turns claiming the next free
+// slot of their permutation (offset + i*skip) mod size; a node with weight w
+// gets w turns per round.
+func (m *Maglev) populate() {
+	m.nodes = sortedNodes(m.weights)
+	m.table = nil
+	if len(m.nodes) == 0 {
+		return
+	}
+	offsets := make([]uint64, len(m.nodes))
+	skips := make([]uint64, len(m.nodes))
+	next := make([]uint64, len(m.nodes))
+	for i, node := range m.nodes {
+		h := m.hash([]byte(node))
+		offsets[i] = mix64(h) % m.size
+		skips[i] = mix64(h^0x9e3779b97f4a7c15)%(m.size-1) + 1
+	}
+	table := make([]int, m.size)
+	for i := range table {
+		table[i] = -1
+	}
+	for filled := uint64(0); ; {
+		for i, node := range m.nodes {
+			for turn := 0; turn < m.weights[node]; turn++ {
+				slot := (offsets[i] + next[i]*skips[i]) % m.size
+				for table[slot] >= 0 {
+					next[i]++
+					slot = (offsets[i] + next[i]*skips[i]) % m.size
+				}
+				table[slot] = i
+				next[i]++
+				if filled++; filled == m.size {
+					m.table = table
+					return
+				}
+			}
+		}
+	}
+}
+
+func (m *Maglev) Get(key string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.table) == 0 {
+		return ""
+	}
+	return m.nodes[m.table[mix64(m.hash([]byte(key)))%m.size]]
+}
+
+func (m *Maglev) Distribution() map[string]float64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	dist := make(map[string]float64, len(m.nodes))
+	for _, i := range m.table {
+		dist[m.nodes[i]] += 1 / float64(m.size)
+	}
+	return dist
+}
+
+func (m *Maglev) Clone() Placement {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c := NewMaglev(m.size, m.hash)
+	for node, weight := range m.weights {
+		c.weights[node] = weight
+	}
+	c.nodes = m.nodes
+	c.table = m.table // populate always allocates a new table
+	return c
+}
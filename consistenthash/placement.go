@@ -0,0 +1,102 @@
+package consistenthash
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Placement decides which node owns a key. The hash ring (Map) is the default;
+// rendezvous, jump and Maglev hashing trade lookup cost, balance and key
+// movement differently and can be selected at startup with NewPlacement.
+type Placement interface {
+	// AddWeightedNode adds a node, weight scales its share of keys
+	AddWeightedNode(node string, weight int)
+	// Remove drops a node, its keys move to the remaining nodes
+	Remove(node string)
+	// Get returns the node owning key, or "" if there are no nodes
+	Get(key string) string
+	// Distribution reports the expected share of keys per node
+	Distribution() map[string]float64
+	// Clone returns an independent copy, used to compare ownership before and
+	// after a membership change
+	Clone() Placement
+}
+
+// BoundedLoader is implemented by placements that support consistent hashing
+// with bounded loads, currently only the hash ring.
+type BoundedLoader interface {
+	SetLoadFactor(epsilon float64)
+	BoundedLoad() bool
+	Inc(node string)
+	Done(node string)
+	GetLeast(key string) string
+}
+
+// DefaultReplicas is the number of virtual nodes per unit of weight on the
+// ring, used by servers and clients unless configured otherwise
+const DefaultReplicas = 50
+
+// Placement algorithms accepted by NewPlacement
+const (
+	PlacementRing       = "ring"
+	PlacementRendezvous = "rendezvous"
+	PlacementJump       = "jump"
+	PlacementMaglev     = "maglev"
+)
+
+// NewPlacement creates a placement by name. replicas is only used by the ring.
+func NewPlacement(kind string, replicas int) (Placement, error) {
+	switch kind {
+	case "", PlacementRing:
+		return New(replicas, nil), nil
+	case PlacementRendezvous:
+		return NewRendezvous(nil), nil
+	case PlacementJump:
+		return NewJump(nil), nil
+	case PlacementMaglev:
+		return NewMaglev(DefaultMaglevTableSize, nil), nil
+	}
+	return nil, fmt.Errorf("consistenthash: unknown placement %q", kind)
+}
+
+var (
+	_ Placement     = (*Map)(nil)
+	_ BoundedLoader = (*Map)(nil)
+	_ Placement     = (*Rendezvous)(nil)
+	_ Placement     = (*Jump)(nil)
+	_ Placement     = (*Maglev)(nil)
+)
+
+// mix64 is the splitmix64 finalizer, it spreads the bits of combined hashes
+// so that scores derived from fnv1 values are uniformly distributed
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// weightShares returns every node's share of the total weight
+func weightShares(weights map[string]int) map[string]float64 {
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+	dist := make(map[string]float64, len(weights))
+	for node, w := range weights {
+		dist[node] = float64(w) / float64(total)
+	}
+	return dist
+}
+
+// sortedNodes returns the nodes of a weight map in a deterministic order
+func sortedNodes(weights map[string]int) []string {
+	nodes := make([]string, 0, len(weights))
+	for node := range weights {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
@@ -0,0 +1,191 @@
+package consistenthash
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+var placementKinds = []string{PlacementRing, PlacementRendezvous, PlacementJump, PlacementMaglev}
+
+func newTestPlacement(tb testing.TB, kind string, nodes int) Placement {
+	p, err := NewPlacement(kind, 50)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for i := 0; i < nodes; i++ {
+		p.AddWeightedNode("node"+strconv.Itoa(i), 1)
+	}
+	return p
+}
+
+func TestPlacements(t *testing.T) {
+	for _, kind := range placementKinds {
+		t.Run(kind, func(t *testing.T) {
+			p := newTestPlacement(t, kind, 5)
+			counts := make(map[string]int)
+			for i := 0; i < 10000; i++ {
+				counts[p.Get(strconv.Itoa(i))]++
+			}
+			if len(counts) != 5 {
+				t.Fatalf("expected keys on 5 nodes, got %v", counts)
+			}
+			sum := 0.0
+			for _, share := range p.Distribution() {
+				sum += share
+			}
+			if math.Abs(sum-1) > 0.001 {
+				t.Fatalf("distribution should sum to 1, got %f", sum)
+			}
+
+			// Keys of surviving nodes should stay put when the last node leaves
+			before := make(map[string]string)
+			for i := 0; i < 10000; i++ {
+				before[strconv.Itoa(i)] = p.Get(strconv.Itoa(i))
+			}
+			p.Remove("node4")
+			for key, owner := range before {
+				got := p.Get(key)
+				if got == "node4" {
+					t.Fatalf("key %s still maps to removed node", key)
+				}
+				if owner != "node4" && got != owner && kind != PlacementMaglev {
+					t.Fatalf("key %s moved from %s to %s", key, owner, got)
+				}
+			}
+		})
+	}
+	if _, err := NewPlacement("modulo", 50); err == nil {
+		t.Fatalf("unknown placement should fail")
+	}
+}
+
+func TestPlacementRemoveMiddleNode(t *testing.T) {
+	for _, kind := range placementKinds {
+		t.Run(kind, func(t *testing.T) {
+			p := newTestPlacement(t, kind, 5)
+			before := make(map[string]string)
+			for i := 0; i < 10000; i++ {
+				before[strconv.Itoa(i)] = p.Get(strconv.Itoa(i))
+			}
+			p.Remove("node2")
+			moved := 0
+			for key, owner := range before {
+				got := p.Get(key)
+				if got == "node2" || got == "" {
+					t.Fatalf("key %s maps to %q after node2 left", key, got)
+				}
+				if owner != "node2" && got != owner {
+					moved++
+				}
+			}
+			// Jump renumbers the buckets after a removed node, see Jump
+			if moved != 0 && kind != PlacementMaglev && kind != PlacementJump {
+				t.Fatalf("%d keys of surviving nodes moved", moved)
+			}
+		})
+	}
+}
+
+func TestPlacementAddOrder(t *testing.T) {
+	for _, kind := range placementKinds {
+		t.Run(kind, func(t *testing.T) {
+			a, _ := NewPlacement(kind, 50)
+			b, _ := NewPlacement(kind, 50)
+			for _, node := range []string{"node0", "node1", "node2", "node3"} {
+				a.AddWeightedNode(node, 1)
+			}
+			for _, node := range []string{"node3", "node1", "node0", "node2"} {
+				b.AddWeightedNode(node, 1)
+			}
+			// Re-adding a node, e.g. on re-registration, must not move it either
+			b.AddWeightedNode("node1", 1)
+			for i := 0; i < 10000; i++ {
+				key := strconv.Itoa(i)
+				if a.Get(key) != b.Get(key) {
+					t.Fatalf("key %s maps to %s or %s depending on the add order", key, a.Get(key), b.Get(key))
+				}
+			}
+		})
+	}
+}
+
+func TestPlacementWeights(t *testing.T) {
+	for _, kind := range placementKinds {
+		t.Run(kind, func(t *testing.T) {
+			p, _ := NewPlacement(kind, 50)
+			p.AddWeightedNode("small", 1)
+			p.AddWeightedNode("large", 4)
+			counts := make(map[string]int)
+			for i := 0; i < 20000; i++ {
+				counts[p.Get(strconv.Itoa(i))]++
+			}
+			if ratio := float64(counts["large"]) / float64(counts["small"]); ratio < 2.5 || ratio > 6 {
+				t.Fatalf("expected about 4x keys on large node, got %v", counts)
+			}
+		})
+	}
+}
+
+// BenchmarkPlacementGet measures lookup cost with 10 nodes
+func BenchmarkPlacementGet(b *testing.B) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+	}
+	for _, kind := range placementKinds {
+		b.Run(kind, func(b *testing.B) {
+			p := newTestPlacement(b, kind, 10)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				p.Get(keys[i%len(keys)])
+			}
+		})
+	}
+}
+
+// BenchmarkPlacementBalance reports the load of the busiest node relative to
+// the mean (1.0 is perfect balance) over b.N keys on 10 nodes
+func BenchmarkPlacementBalance(b *testing.B) {
+	for _, kind := range placementKinds {
+		b.Run(kind, func(b *testing.B) {
+			p := newTestPlacement(b, kind, 10)
+			counts := make(map[string]int)
+			for i := 0; i < b.N; i++ {
+				counts[p.Get(strconv.Itoa(i))]++
+			}
+			most := 0
+			for _, c := range counts {
+				if c > most {
+					most = c
+				}
+			}
+			b.ReportMetric(float64(most)/(float64(b.N)/10), "max/mean")
+		})
+	}
+}
+
+// BenchmarkPlacementMovement reports the fraction of keys that change owner
+// when an 11th node joins a 10 node cluster; 1/11 is the optimum. The new
+// node's name sorts either after the others or among them, which matters for
+// jump: its buckets follow the node names, so a node joining in the middle
+// renumbers the buckets after it.
+func BenchmarkPlacementMovement(b *testing.B) {
+	for _, joiner := range []struct{ name, node string }{{"last", "node9a"}, {"middle", "node10"}} {
+		for _, kind := range placementKinds {
+			b.Run(joiner.name+"/"+kind, func(b *testing.B) {
+				before := newTestPlacement(b, kind, 10)
+				after := newTestPlacement(b, kind, 10)
+				after.AddWeightedNode(joiner.node, 1)
+				moved := 0
+				for i := 0; i < b.N; i++ {
+					key := strconv.Itoa(i)
+					if before.Get(key) != after.Get(key) {
+						moved++
+					}
+				}
+				b.ReportMetric(float64(moved)/float64(b.N), "moved/key")
+			})
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package consistenthash
+
+import (
+	"math"
+	"sync"
+
+	"github.com/segmentio/fasthash/fnv1"
+)
+
+// Rendezvous implements highest random weight (HRW) hashing: every node scores
+// the key and the highest score wins. Removing a node only moves the keys it
+// owned, at the cost of an O(n) lookup.
+type Rendezvous struct {
+	mu       sync.RWMutex
+	hash     Hash
+	nodes    []string
+	nodeHash []uint64       // hash of nodes[i], precomputed
+	weights  map[string]int // Weight of every node
+}
+
+func NewRendezvous(fn Hash) *Rendezvous {
+	if fn == nil {
+		fn = fnv1.HashBytes64
+	}
+	return &Rendezvous{hash: fn, weights: make(map[string]int)}
+}
+
+func (r *Rendezvous) AddWeightedNode(node string, weight int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if weight < 1 {
+		weight = 1
+	}
+	r.weights[node] = weight
+	r.rebuild()
+}
+
+func (r *Rendezvous) Remove(node string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.weights, node)
+	r.rebuild()
+}
+
+func (r *Rendezvous) rebuild() {
+	r.nodes = sortedNodes(r.weights)
+	r.nodeHash = make([]uint64, len(r.nodes))
+	for i, node := range r.nodes {
+		r.nodeHash[i] = r.hash([]byte(node))
+	}
+}
+
+func (r *Rendezvous) Get(key string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	keyHash := r.hash([]byte(key))
+	best, bestScore := "", math.Inf(-1)
+	for i, node := range r.nodes {
+		score := r.score(keyHash, i)
+		if score > bestScore {
+			best, bestScore = node, score
+		}
+	}
+	return best
+}
+
+// score is the weighted HRW score -w/ln(u), u uniform in (0,1), so that a
+// node's chance of winning is proportional to its weight
+func (r *Rendezvous) score(keyHash uint64, i int) float64 {
+	h := mix64(keyHash ^ r.nodeHash[i])
+	u := (float64(h>>11) + 0.5) / (1 << 53)
+	return -float64(r.weights[r.nodes[i]]) / math.Log(u)
+}
+
+func (r *Rendezvous) Distribution() map[string]float64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return weightShares(r.weights)
+}
+
+func (r *Rendezvous) Clone() Placement {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c := NewRendezvous(r.hash)
+	for node, weight := range r.weights {
+		c.weights[node] = weight
+	}
+	c.rebuild()
+	return c
+}
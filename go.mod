@@ -8,8 +8,11 @@ require (
 	github.com/segmentio/fasthash v1.0.3
 	go.etcd.io/etcd/client/v3 v3.5.17
 	golang.org/x/net v0.28.0
+	golang.org/x/sync v0.19.0
+	golang.org/x/time v0.7.0
 	google.golang.org/grpc v1.68.0-dev
 	google.golang.org/protobuf v1.36.10
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -28,7 +31,6 @@ require (
 	go.uber.org/atomic v1.7.0 // indirect
 	go.uber.org/multierr v1.6.0 // indirect
 	go.uber.org/zap v1.17.0 // indirect
-	golang.org/x/sync v0.19.0 // indirect
 	golang.org/x/sys v0.37.0 // indirect
 	golang.org/x/text v0.30.0 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20240814211410-ddb44dafa142 // indirect
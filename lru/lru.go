@@ -3,6 +3,7 @@ package lru
 
 import (
 	"container/list"
+	"errors"
 	"math/rand"
 	"time"
 )
@@ -10,22 +11,55 @@ import (
 var DefaultMaxBytes int64 = 10
 var DefaultExpireRandom time.Duration = 3 * time.Minute
 
+// DefaultMaxPinnedRatio is the share of maxBytes granted to pinned entries
+// when the cache is created. Use SetMaxPinnedBytes to override it.
+var DefaultMaxPinnedRatio = 0.25
+
+// ErrPinnedBudgetExceeded is returned by AddPinned when the entry does not fit
+// into the pinned-bytes budget even after dropping expired pinned entries.
+var ErrPinnedBudgetExceeded = errors.New("lru: pinned bytes budget exceeded")
+
+// EvictReason tells OnEvicted listeners why an entry left the cache
+type EvictReason int
+
+const (
+	EvictCapacity EvictReason = iota // Removed by RemoveOldest under memory pressure
+	EvictExpired                     // TTL passed
+	EvictRemoved                     // Removed explicitly with Remove
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictCapacity:
+		return "capacity"
+	case EvictExpired:
+		return "expired"
+	case EvictRemoved:
+		return "removed"
+	}
+	return "unknown"
+}
+
 type NowFunc func() time.Time
 
 var nowFunc NowFunc = time.Now
 
 type Cache struct {
-	maxBytes  int64                         // Maximum memory allowed
-	nbytes    int64                         // Current memory usage
-	ll        *list.List                    // Doubly-linked list for LRU ordering
-	cache     map[string]*list.Element      // Map storing actual key-value pairs
-	OnEvicted func(key string, value Value) // Optional callback when an entry is evicted
+	maxBytes       int64                                             // Maximum memory allowed for unpinned entries
+	nbytes         int64                                             // Current memory usage of unpinned entries
+	maxPinnedBytes int64                                             // Maximum memory allowed for pinned entries
+	pinnedBytes    int64                                             // Current memory usage of pinned entries
+	ll             *list.List                                        // Doubly-linked list for LRU ordering
+	pinned         *list.List                                        // Pinned entries, never evicted by RemoveOldest
+	cache          map[string]*list.Element                          // Map storing actual key-value pairs
+	OnEvicted      func(key string, value Value, reason EvictReason) // Optional callback when an entry is evicted
 
 	// Now is the Now() function the cache will use to determine
 	// the current time which is used to calculate expired values
 	// Defaults to time.Now()
 	Now NowFunc
-	//
+	// ExpireRandom is the upper bound of the random jitter added to expiry
+	// times by Add and AddPinned, 0 disables it
 	ExpireRandom time.Duration
 }
 
@@ -34,25 +68,58 @@ type entry struct {
 	value   Value
 	expire  time.Time // Expiration time
 	addTime time.Time // Time when entry was added
+	pinned  bool      // Pinned entries are exempt from capacity eviction
 }
 
 type Value interface {
 	Len() int
 }
 
-func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
+func New(maxBytes int64, onEvicted func(string, Value, EvictReason)) *Cache {
 	return &Cache{
-		maxBytes:     maxBytes,
-		ll:           list.New(),
-		cache:        make(map[string]*list.Element),
-		OnEvicted:    onEvicted,
-		Now:          nowFunc,
-		ExpireRandom: DefaultExpireRandom,
+		maxBytes:       maxBytes,
+		maxPinnedBytes: int64(float64(maxBytes) * DefaultMaxPinnedRatio),
+		ll:             list.New(),
+		pinned:         list.New(),
+		cache:          make(map[string]*list.Element),
+		OnEvicted:      onEvicted,
+		Now:            nowFunc,
+		ExpireRandom:   DefaultExpireRandom,
 	}
 }
 
 func (c *Cache) Len() int {
-	return c.ll.Len()
+	return c.ll.Len() + c.pinned.Len()
+}
+
+// Bytes returns the memory used by unpinned entries
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
+
+// PinnedLen returns the number of pinned entries
+func (c *Cache) PinnedLen() int {
+	return c.pinned.Len()
+}
+
+// PinnedBytes returns the memory used by pinned entries
+func (c *Cache) PinnedBytes() int64 {
+	return c.pinnedBytes
+}
+
+// SetMaxPinnedBytes changes the pinned-bytes budget. 0 means unlimited.
+// Entries already pinned are kept even if they exceed the new budget.
+func (c *Cache) SetMaxPinnedBytes(maxPinnedBytes int64) {
+	c.maxPinnedBytes = maxPinnedBytes
+}
+
+// SetMaxBytes changes the memory allowed for unpinned entries, evicting the
+// least recently used ones until they fit. 0 means unlimited.
+func (c *Cache) SetMaxBytes(maxBytes int64) {
+	c.maxBytes = maxBytes
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.RemoveOldest()
+	}
 }
 
 // Get retrieves a value from the cache and moves it to the front (most recently used)
@@ -62,67 +129,176 @@ func (c *Cache) Get(key string) (value Value, ok bool) {
 		// ll.Value is interface{} type that can store any data type
 		// Since we stored *entry type, we can assert it back to *entry
 		kv := ele.Value.(*entry)
-		// If entry has expired, remove it from cache
-		if kv.expire.Before(time.Now()) {
-			c.removeElement(ele)
+		// If entry has expired, remove it from cache (pinned entries expire too)
+		if kv.expire.Before(c.Now()) {
+			c.removeElement(ele, EvictExpired)
 			return nil, false
 		}
 		// If not expired, refresh the expiration time
 		expireTime := kv.expire.Sub(kv.addTime)
-		kv.expire = time.Now().Add(expireTime)
-		kv.addTime = time.Now()
+		kv.expire = c.Now().Add(expireTime)
+		kv.addTime = c.Now()
 		// With doubly-linked list as queue, front/back is relative - here we define front as most recent
-		c.ll.MoveToFront(ele)
+		c.listOf(kv).MoveToFront(ele)
 		return kv.value, true
 	}
 	return nil, false
 }
 
-func (c *Cache) RemoveOldest() {
-	ele := c.ll.Back()
-	if ele != nil {
-		// Remove this node from the LRU list
-		c.ll.Remove(ele)
+// Peek returns the value of key and when it expires, without refreshing the
+// entry or moving it to the front. Expired entries are reported as missing.
+func (c *Cache) Peek(key string) (value Value, expire time.Time, ok bool) {
+	if ele, ok := c.cache[key]; ok {
 		kv := ele.Value.(*entry)
-		// Delete from the cache map
-		delete(c.cache, kv.key)
-		c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
-		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value)
+		if !kv.expire.Before(c.Now()) {
+			return kv.value, kv.expire, true
 		}
 	}
+	return nil, time.Time{}, false
+}
+
+// IsPinned reports whether key is cached as a pinned entry
+func (c *Cache) IsPinned(key string) bool {
+	if ele, ok := c.cache[key]; ok {
+		return ele.Value.(*entry).pinned
+	}
+	return false
+}
+
+// RemoveOldest evicts the least recently used unpinned entry
+func (c *Cache) RemoveOldest() {
+	if ele := c.ll.Back(); ele != nil {
+		c.removeElement(ele, EvictCapacity)
+	}
 }
 
 func (c *Cache) Remove(key string) {
 	if ele, ok := c.cache[key]; ok {
-		c.removeElement(ele)
+		c.removeElement(ele, EvictRemoved)
 	}
 }
 
-func (c *Cache) removeElement(ele *list.Element) {
+func (c *Cache) removeElement(ele *list.Element, reason EvictReason) {
 	kv := ele.Value.(*entry)
+	c.listOf(kv).Remove(ele)
 	delete(c.cache, kv.key)
-	c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	c.account(kv, -(int64(len(kv.key)) + int64(kv.value.Len())))
 	if c.OnEvicted != nil {
-		c.OnEvicted(kv.key, kv.value)
+		c.OnEvicted(kv.key, kv.value, reason)
+	}
+}
+
+// listOf returns the list holding the entry
+func (c *Cache) listOf(kv *entry) *list.List {
+	if kv.pinned {
+		return c.pinned
+	}
+	return c.ll
+}
+
+// account adds delta to the byte counter the entry is charged against
+func (c *Cache) account(kv *entry, delta int64) {
+	if kv.pinned {
+		c.pinnedBytes += delta
+	} else {
+		c.nbytes += delta
 	}
 }
 
 func (c *Cache) Add(key string, value Value, expire time.Time) {
+	c.add(key, value, expire, false, true)
+}
+
+// AddPinned adds an entry that is never evicted because of capacity pressure.
+// The entry still expires, and it is charged against the pinned-bytes budget
+// instead of maxBytes so that pins can't starve regular entries.
+func (c *Cache) AddPinned(key string, value Value, expire time.Time) error {
+	return c.addPinned(key, value, expire, true)
+}
+
+// Import adds an entry moved over from another cache. The expiry is kept as is,
+// since the jitter was already applied when the entry was first added.
+func (c *Cache) Import(key string, value Value, expire time.Time, pinned bool) error {
+	if pinned {
+		return c.addPinned(key, value, expire, false)
+	}
+	c.add(key, value, expire, false, false)
+	return nil
+}
+
+// Range calls fn for every unexpired entry, pinned entries first and then from
+// most to least recently used, until fn returns false. fn must not modify the cache.
+func (c *Cache) Range(fn func(key string, value Value, expire time.Time, pinned bool) bool) {
+	now := c.Now()
+	for _, l := range []*list.List{c.pinned, c.ll} {
+		for ele := l.Front(); ele != nil; ele = ele.Next() {
+			kv := ele.Value.(*entry)
+			if kv.expire.Before(now) {
+				continue
+			}
+			if !fn(kv.key, kv.value, kv.expire, kv.pinned) {
+				return
+			}
+		}
+	}
+}
+
+func (c *Cache) addPinned(key string, value Value, expire time.Time, jitter bool) error {
+	size := int64(len(key)) + int64(value.Len())
+	if ele, ok := c.cache[key]; ok && ele.Value.(*entry).pinned {
+		size -= int64(len(key)) + int64(ele.Value.(*entry).value.Len())
+	}
+	if c.maxPinnedBytes != 0 && c.pinnedBytes+size > c.maxPinnedBytes {
+		c.removeExpiredPinned()
+		if c.pinnedBytes+size > c.maxPinnedBytes {
+			return ErrPinnedBudgetExceeded
+		}
+	}
+	c.add(key, value, expire, true, jitter)
+	return nil
+}
+
+// removeExpiredPinned drops pinned entries whose TTL has passed to free budget
+func (c *Cache) removeExpiredPinned() {
+	now := c.Now()
+	for ele := c.pinned.Back(); ele != nil; {
+		prev := ele.Prev()
+		if ele.Value.(*entry).expire.Before(now) {
+			c.removeElement(ele, EvictExpired)
+		}
+		ele = prev
+	}
+}
+
+func (c *Cache) add(key string, value Value, expire time.Time, pinned bool, jitter bool) {
 	// randDuration adds randomness to expiration time to prevent cache stampede
-	randDuration := time.Duration(rand.Int63n(int64(c.ExpireRandom)))
+	var randDuration time.Duration
+	if jitter && c.ExpireRandom > 0 {
+		randDuration = time.Duration(rand.Int63n(int64(c.ExpireRandom)))
+	}
 
 	if ele, ok := c.cache[key]; ok {
 		// If key already exists, update the value
-		c.ll.MoveToFront(ele)
 		kv := ele.Value.(*entry)
-		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
+		c.account(kv, -int64(kv.value.Len()))
+		if kv.pinned != pinned {
+			// Move the entry between the pinned and the LRU list
+			c.listOf(kv).Remove(ele)
+			c.account(kv, -int64(len(key)))
+			kv.pinned = pinned
+			c.account(kv, int64(len(key)))
+			ele = c.listOf(kv).PushFront(kv)
+			c.cache[key] = ele
+		} else {
+			c.listOf(kv).MoveToFront(ele)
+		}
+		c.account(kv, int64(value.Len()))
 		kv.value = value
 		kv.expire = expire.Add(randDuration)
 	} else {
-		newEle := c.ll.PushFront(&entry{key, value, expire.Add(randDuration), time.Now()})
-		c.cache[key] = newEle
-		c.nbytes += int64(len(key)) + int64(value.Len())
+		kv := &entry{key, value, expire.Add(randDuration), c.Now(), pinned}
+		c.cache[key] = c.listOf(kv).PushFront(kv)
+		c.account(kv, int64(len(key))+int64(value.Len()))
 	}
 	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
 		c.RemoveOldest()
@@ -2,6 +2,7 @@ package lru
 
 import (
 	"container/list"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -30,7 +31,7 @@ func TestCache_RemoveOldest(t *testing.T) {
 		nbytes    int64
 		ll        *list.List
 		cache     map[string]*list.Element
-		OnEvicted func(key string, value Value)
+		OnEvicted func(key string, value Value, reason EvictReason)
 	}
 	tests := []struct {
 		name   string
@@ -60,3 +61,102 @@ func TestCache_RemoveOldest(t *testing.T) {
 		})
 	}
 }
+
+func TestAddPinned(t *testing.T) {
+	lru := New(int64(10), nil)
+	lru.SetMaxPinnedBytes(10)
+	if err := lru.AddPinned("k1", String("1234"), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("pin k1 failed: %v", err)
+	}
+	// Fill the regular budget several times over, k1 must survive
+	lru.Add("k2", String("12345678"), time.Now().Add(time.Hour))
+	lru.Add("k3", String("12345678"), time.Now().Add(time.Hour))
+	if _, ok := lru.Get("k1"); !ok {
+		t.Fatalf("pinned key k1 was evicted")
+	}
+	if _, ok := lru.Get("k2"); ok {
+		t.Fatalf("unpinned key k2 should have been evicted")
+	}
+	if lru.PinnedBytes() != 6 || lru.Bytes() != 10 {
+		t.Fatalf("unexpected accounting pinned=%d unpinned=%d", lru.PinnedBytes(), lru.Bytes())
+	}
+	if err := lru.AddPinned("k4", String("1234"), time.Now().Add(time.Hour)); err != ErrPinnedBudgetExceeded {
+		t.Fatalf("expected pinned budget error, got %v", err)
+	}
+	// Unpinning moves the entry back under LRU control
+	lru.Add("k1", String("1234"), time.Now().Add(time.Hour))
+	if lru.PinnedLen() != 0 || lru.PinnedBytes() != 0 {
+		t.Fatalf("k1 should no longer be pinned")
+	}
+}
+
+func TestPinnedExpire(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.SetMaxPinnedBytes(6)
+	lru.ExpireRandom = time.Nanosecond
+	if err := lru.AddPinned("k1", String("1234"), time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("pin k1 failed: %v", err)
+	}
+	// The expired pin is dropped to make room for the new one
+	if err := lru.AddPinned("k2", String("1234"), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("pin k2 failed: %v", err)
+	}
+	if _, ok := lru.Get("k1"); ok {
+		t.Fatalf("expired pinned key k1 should be gone")
+	}
+}
+
+func TestOnEvictedReason(t *testing.T) {
+	reasons := make(map[string]EvictReason)
+	callback := func(key string, value Value, reason EvictReason) {
+		reasons[key] = reason
+	}
+	lru := New(int64(12), callback)
+	lru.ExpireRandom = time.Nanosecond
+	lru.Add("k1", String("1234"), time.Now().Add(time.Hour))
+	lru.Add("k2", String("1234"), time.Now().Add(-time.Second))
+	lru.Get("k2")
+	lru.Add("k3", String("1234"), time.Now().Add(time.Hour))
+	lru.Add("k4", String("1234"), time.Now().Add(time.Hour))
+	lru.Remove("k4")
+
+	expect := map[string]EvictReason{"k1": EvictCapacity, "k2": EvictExpired, "k4": EvictRemoved}
+	if !reflect.DeepEqual(expect, reasons) {
+		t.Fatalf("Call OnEvicted failed, expect reasons %v, got %v", expect, reasons)
+	}
+}
+
+func TestSetMaxBytes(t *testing.T) {
+	lru := New(0, nil)
+	lru.ExpireRandom = 0
+	expire := time.Now().Add(time.Hour)
+	for _, k := range []string{"k1", "k2", "k3"} {
+		lru.Add(k, String("1234"), expire)
+	}
+	lru.SetMaxBytes(12)
+	if _, ok := lru.Get("k1"); ok || lru.Len() != 2 || lru.Bytes() != 12 {
+		t.Fatalf("shrinking should evict the oldest entry, len=%d bytes=%d", lru.Len(), lru.Bytes())
+	}
+	if v, _ := lru.Get("k2"); v == nil {
+		t.Fatalf("k2 should survive the resize")
+	}
+}
+
+func TestPeek(t *testing.T) {
+	lru := New(0, nil)
+	lru.ExpireRandom = 0
+	expire := time.Now().Add(time.Hour)
+	lru.Add("k1", String("1"), expire)
+	lru.Add("k2", String("2"), expire)
+	if v, e, ok := lru.Peek("k1"); !ok || v.(String) != "1" || !e.Equal(expire) {
+		t.Fatalf("peek k1 = %v %v %v", v, e, ok)
+	}
+	lru.RemoveOldest()
+	if _, _, ok := lru.Peek("k1"); ok {
+		t.Fatalf("peek should not make k1 the most recently used entry")
+	}
+	lru.Add("old", String("x"), time.Now().Add(-time.Second))
+	if _, _, ok := lru.Peek("old"); ok {
+		t.Fatalf("expired entries should be reported as missing")
+	}
+}
@@ -1,166 +1,121 @@
 package main
 
 import (
+	"NexusCache/api"
+	cachepb "NexusCache/cachepb/v1"
+	"NexusCache/config"
 	"NexusCache/connect"
+	"NexusCache/consistenthash"
+	"NexusCache/memcache"
 	"NexusCache/metrics"
 	"NexusCache/nexuscache"
+	"NexusCache/node"
+	"NexusCache/origin"
+	"NexusCache/resp"
 	"context"
 	"flag"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 )
 
-var store = map[string]string{
-	"Tom":  "630",
-	"Jack": "589",
-	"Sam":  "567",
-}
+// drainTimeout bounds the key handoff and the wait for in-flight RPCs on shutdown
+const drainTimeout = 20 * time.Second
 
-// startAPIServer starts the HTTP API server for cache operations
-func startAPIServer(apiAddr string, group *nexuscache.Group, svr *nexuscache.Server) {
-	getHandle := func(w http.ResponseWriter, r *http.Request) {
-		key := r.URL.Query().Get("key")
-		view, err := group.Get(key)
-		if err != nil {
-			if err == context.DeadlineExceeded {
-				// If timeout, the remote node is unavailable
-				// Remove the node from hash ring and request from database
-				svr.RemovePeerByKey(key)
-				view, err = group.Load(key)
-				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				w.Header().Set("Content-Type", "application/octet-stream")
-				value := fmt.Sprintf("value=%v\n", string(view.ByteSlice()))
-				w.Write([]byte(value))
-				return
-			}
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		w.Header().Set("Content-Type", "application/octet-stream")
-		value := fmt.Sprintf("value=%v\n", string(view.ByteSlice()))
-		w.Write([]byte(value))
-	}
-
-	setPeerHandle := func(w http.ResponseWriter, r *http.Request) {
-		err := r.ParseForm()
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		peer := r.FormValue("peer")
-		if peer == "" {
-			http.Error(w, "peer is not allow empty!", http.StatusInternalServerError)
-			return
-		}
-		svr.SetPeers(peer)
-		w.Header().Set("Content-Type", "application/octet-stream")
-		w.Write([]byte(fmt.Sprintf("set peer %v successful\n", peer)))
-	}
-
-	setHandle := func(w http.ResponseWriter, r *http.Request) {
-		err := r.ParseForm()
-		if err != nil {
-			http.Error(w, "Error ParseForm", http.StatusInternalServerError)
-			return
-		}
-		key := r.FormValue("key")
-		value := r.FormValue("value")
-		expire := r.FormValue("expire")
-		hot := r.FormValue("hot")
-		expireTime, err := strconv.Atoi(expire)
-		if err != nil {
-			w.Write([]byte("Please set expire time correctly, unit: minutes"))
-			http.Error(w, "", http.StatusBadRequest)
-			return
-		}
-		if expireTime < 0 || expireTime > 4321 {
-			w.Write([]byte("Expire time error, unit is minutes, max 4320 minutes (3 days)"))
-			http.Error(w, "", http.StatusBadRequest)
-			return
-		}
-		ishot := false
-		if hot == "true" {
-			ishot = true
-		}
-		if hot != "true" && hot != "false" && hot != "" {
-			w.Write([]byte("Invalid Param \"hot\" "))
-			http.Error(w, "", http.StatusBadRequest)
-			return
-		}
-		exp := time.Duration(expireTime) * time.Minute
-		exptime := time.Now().Add(exp)
-		byteView := nexuscache.NewByteView([]byte(value), exptime)
-		if err := group.Set(key, byteView, ishot); err != nil {
-			log.Println(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		w.Write([]byte("done\n"))
-	}
-
-	http.HandleFunc("/api/get", getHandle)
-	http.HandleFunc("/setpeer", setPeerHandle)
-	http.HandleFunc("/api/set", setHandle)
-	log.Println("frontend server is running at", apiAddr[7:])
-	log.Fatal(http.ListenAndServe(apiAddr[7:], nil))
-}
+// configPollInterval is how often the config file is checked for edits
+const configPollInterval = 5 * time.Second
 
 func main() {
+	defaults := config.Default()
 	var (
-		addr           = os.Getenv("IP_ADDRESS")
-		svrName        = flag.String("name", "", "server name")
-		port           = flag.String("port", "8888", "server port")
-		peers          = flag.String("peer", "", "peers name")
-		etcdAddr       = flag.String("etcd", "127.0.0.1:2379", "etcd address")
-		defaultApiAddr = "http://0.0.0.0:9999"
+		addr          = os.Getenv("IP_ADDRESS")
+		configPath    = flag.String("config", "", "path to a YAML config file, flags and NEXUSCACHE_* env override it")
+		svrName       = flag.String("name", "", "server name")
+		port          = flag.String("port", defaults.Node.Port, "server port")
+		peers         = flag.String("peer", "", "peers name")
+		etcdAddr      = flag.String("etcd", strings.Join(defaults.Discovery.Etcd, ","), "etcd address")
+		weight        = flag.Int("weight", defaults.Node.Weight, "relative capacity of this node, scales its share of keys")
+		placement     = flag.String("placement", defaults.Node.Placement, "key placement algorithm: ring, rendezvous, jump or maglev; with jump, adding or removing a node whose name does not sort last renumbers buckets and moves many keys")
+		boundedLoad   = flag.Float64("bounded-load", 0, "epsilon for consistent hashing with bounded loads, 0 disables it")
+		grpcAddr      = flag.String("grpc-addr", "", "gRPC bind address, host:port or unix:///path (default 0.0.0.0:<port>)")
+		apiAddr       = flag.String("api-addr", defaults.Node.ApiAddr, "HTTP API bind address, host:port or unix:///path")
+		metricsAddr   = flag.String("metrics-addr", defaults.Node.MetricsAddr, "Prometheus metrics bind address, host:port or unix:///path")
+		memcacheAddr  = flag.String("memcache-addr", "", "memcached protocol bind address, host:port or unix:///path (default off)")
+		respAddr      = flag.String("resp-addr", "", "Redis protocol bind address, host:port or unix:///path (default off)")
+		advertiseAddr = flag.String("advertise-addr", "", "gRPC address registered in etcd for peers to dial (default $IP_ADDRESS:<port>)")
+		publishGroups = flag.Bool("publish-groups", false, "publish the configured groups to etcd, creating or updating them on every node")
 	)
 	flag.Parse()
 
-	if *svrName == "" {
-		log.Fatal("--name is required")
-	}
-	if *peers == "" {
-		log.Fatal("--peer is required")
+	// loadConfig reads the config file, if any, then applies NEXUSCACHE_* env
+	// and the flags given on the command line on top of it
+	loadConfig := func() (*config.Config, error) {
+		cfg := config.Default()
+		if *configPath != "" {
+			var err error
+			if cfg, err = config.Load(*configPath); err != nil {
+				return nil, err
+			}
+		}
+		cfg.ApplyEnv(os.LookupEnv)
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "name":
+				cfg.Node.Name = *svrName
+			case "port":
+				cfg.Node.Port = *port
+			case "peer":
+				cfg.Discovery.Peers = config.SplitList(*peers)
+			case "etcd":
+				cfg.Discovery.Etcd = config.SplitList(*etcdAddr)
+			case "weight":
+				cfg.Node.Weight = *weight
+			case "placement":
+				cfg.Node.Placement = *placement
+			case "bounded-load":
+				cfg.Node.BoundedLoad = *boundedLoad
+			case "grpc-addr":
+				cfg.Node.GrpcAddr = *grpcAddr
+			case "api-addr":
+				cfg.Node.ApiAddr = *apiAddr
+			case "metrics-addr":
+				cfg.Node.MetricsAddr = *metricsAddr
+			case "memcache-addr":
+				cfg.Node.MemcacheAddr = *memcacheAddr
+			case "resp-addr":
+				cfg.Node.RespAddr = *respAddr
+			case "advertise-addr":
+				cfg.Node.AdvertiseAddr = *advertiseAddr
+			}
+		})
+		return cfg, cfg.Validate()
 	}
-	if !strings.Contains(*peers, *svrName) {
-		log.Fatal("--peers must contain " + *svrName)
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
 	}
-	if addr == "" {
-		log.Fatal("please set env IP_ADDRESS")
+	nexuscache.SetLogLevel(cfg.Node.LogLevel)
+	if cfg.Node.AdvertiseAddr == "" && addr == "" {
+		log.Fatal("please set env IP_ADDRESS or --advertise-addr")
 	}
 
-	// Start Prometheus metrics server
-	metrics.ServeMetrics(":9100")
-	log.Println("Metrics server started on :9100/metrics")
-
-	// Create cache group
-	group := nexuscache.NewGroup("scores", 2<<10, 2<<7, nexuscache.GetterFunc(
-		func(key string) ([]byte, error) {
-			log.Printf("Searching \"%v\" from database", key)
-			if v, ok := store[key]; ok {
-				return []byte(v), nil
-			}
-			return nil, fmt.Errorf("%s not exist", key)
-		}))
-
 	// Create etcd client
-	etcd, err := connect.NewEtcd([]string{*etcdAddr})
+	etcd, err := connect.NewEtcd(cfg.Discovery.Etcd)
 	if err != nil {
 		log.Println("etcd connect err:", err)
 		panic(err)
 	}
 
-	log.Println("server name:", *svrName)
-	address := fmt.Sprintf("%s:%s", addr, *port)
-	err = etcd.RegisterServer(*svrName, address)
+	log.Println("server name:", cfg.Node.Name)
+	address := cfg.Node.AdvertiseAddr
+	if address == "" {
+		address = fmt.Sprintf("%s:%s", addr, cfg.Node.Port)
+	}
+	err = etcd.RegisterServer(cfg.Node.Name, address, cfg.Node.Weight)
 	if err != nil {
 		log.Fatal("register server error:", err)
 	}
@@ -168,11 +123,26 @@ func main() {
 
 	log.Println("grpc server address:", address)
 	// Create gRPC Server
-	svr := nexuscache.NewServer(*svrName, address, etcd)
+	svr := nexuscache.NewServer(cfg.Node.Name, address, etcd)
+	if cfg.Node.GrpcAddr != "" {
+		svr.SetListenAddr(cfg.Node.GrpcAddr)
+	}
+	// Applications use the public API on the same port as peers
+	cachepb.RegisterCacheServiceServer(svr, api.NewCacheService())
+	keyPlacement, err := consistenthash.NewPlacement(cfg.Node.Placement, cfg.Node.Replicas)
+	if err != nil {
+		log.Fatal(err)
+	}
+	svr.SetPlacement(keyPlacement)
+	if cfg.Node.BoundedLoad > 0 {
+		if err := svr.EnableBoundedLoad(cfg.Node.BoundedLoad); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	// Add nodes to hash ring
 	// Check if other nodes are registered in etcd, wait if not
-	peer := strings.Split(*peers, ",")
+	peer := cfg.Discovery.Peers
 	if len(peer) != 1 {
 		timer := 0
 		log.Println("waiting for other servers to register")
@@ -194,17 +164,99 @@ func main() {
 	}
 	log.Println("other servers are registered")
 	svr.SetPeers(peer...)
-	// Bind service with group
-	group.RegisterPeers(svr)
-	// Start API server
-	go startAPIServer(defaultApiAddr, group, svr)
+	svr.WatchPeers(peer...)
+	// Create the configured cache groups bound to the service, then publish
+	// them if asked to and follow the cluster-wide definitions in etcd
+	registry := origin.NewRegistry(svr)
+	for _, gc := range cfg.Groups {
+		if _, err := registry.Apply(gc); err != nil {
+			log.Fatal(err)
+		}
+		if *publishGroups {
+			if err := origin.PublishGroup(context.Background(), etcd, gc); err != nil {
+				log.Fatal("publish group error:", err)
+			}
+		}
+	}
+	groupsCtx, stopGroups := context.WithCancel(context.Background())
+	defer stopGroups()
+	if err := registry.Watch(groupsCtx, etcd); err != nil {
+		log.Fatal("watch groups error:", err)
+	}
 
-	// Start gRPC server
-	err = svr.StartServer()
-	if err != nil {
-		log.Println("grpc server start err:", err)
+	// Start gRPC server, API server and Prometheus metrics server, and the
+	// Redis and memcached protocol front-ends when they are enabled
+	services := []node.Service{
+		svr,
+		&node.HTTPServer{Name: "frontend", Addr: cfg.Node.ApiAddr, Handler: api.NewHandler(nexuscache.GetGroup(cfg.Groups[0].Name), svr)},
+		&node.HTTPServer{Name: "metrics", Addr: cfg.Node.MetricsAddr, Handler: metrics.Handler()},
+	}
+	if cfg.Node.RespAddr != "" {
+		groupNames := make([]string, len(cfg.Groups))
+		for i, g := range cfg.Groups {
+			groupNames[i] = g.Name
+		}
+		services = append(services, &resp.Server{Addr: cfg.Node.RespAddr, Groups: groupNames, KeyPrefix: cfg.Node.KeyPrefix})
+	}
+	if cfg.Node.MemcacheAddr != "" {
+		group := cfg.Node.MemcacheGroup
+		if group == "" {
+			group = cfg.Groups[0].Name
+		}
+		services = append(services, &memcache.Server{Addr: cfg.Node.MemcacheAddr, Group: group, KeyPrefix: cfg.Node.KeyPrefix})
+	}
+	n := node.New(services...)
+	if err := n.Start(context.Background()); err != nil {
+		log.Println("node start err:", err)
 		panic(err)
 	}
+
+	// Apply edits of the config file without a restart
+	if *configPath != "" {
+		watchCtx, stopWatch := context.WithCancel(context.Background())
+		defer stopWatch()
+		running := cfg
+		config.Watch(watchCtx, *configPath, configPollInterval, loadConfig, func(next *config.Config) {
+			changes, err := config.Diff(running, next)
+			if err != nil {
+				log.Println("config reload rejected:", err)
+				return
+			}
+			applyConfig(registry, next)
+			for _, c := range changes {
+				log.Println("config reloaded:", c)
+			}
+			running = next
+		})
+	}
+
+	// Drain on SIGTERM: leave etcd, hand off keys, finish in-flight RPCs
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, os.Interrupt)
+	<-sig
+	log.Println("received shutdown signal, draining")
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	if err := svr.Drain(ctx); err != nil {
+		log.Println("drain err:", err)
+	}
+	if err := n.Shutdown(ctx); err != nil {
+		log.Println("shutdown err:", err)
+	}
+	if err := nexuscache.CloseWriters(ctx); err != nil {
+		log.Println("flush writes err:", err)
+	}
+}
+
+// applyConfig applies the reloadable settings of cfg to the running node.
+// Groups defined in etcd keep that definition, see origin.Registry.
+func applyConfig(registry *origin.Registry, cfg *config.Config) {
+	nexuscache.SetLogLevel(cfg.Node.LogLevel)
+	for _, gc := range cfg.Groups {
+		if _, err := registry.Apply(gc); err != nil {
+			log.Println("config reload:", err)
+		}
+	}
 }
 
 func IfAllRegistered(etcd *connect.Etcd, peer []string) bool {
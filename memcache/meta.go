@@ -0,0 +1,321 @@
+package memcache
+
+import (
+	"NexusCache/nexuscache"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metaFlags are the flags of a meta command, each a letter with an optional token
+type metaFlags struct {
+	list []string // In request order, for the flags echoed back
+	set  map[byte]string
+}
+
+// parseMetaFlags parses flags, refusing any letter not in allowed
+func parseMetaFlags(args []string, allowed string) (metaFlags, bool) {
+	f := metaFlags{list: args, set: make(map[byte]string, len(args))}
+	for _, arg := range args {
+		if arg == "" || !strings.ContainsRune(allowed, rune(arg[0])) {
+			return f, false
+		}
+		f.set[arg[0]] = arg[1:]
+	}
+	return f, true
+}
+
+func (f metaFlags) has(flag byte) bool {
+	_, ok := f.set[flag]
+	return ok
+}
+
+// int returns the numeric token of flag, def when the flag is absent
+func (f metaFlags) int(flag byte, def int64) (int64, bool) {
+	tok, ok := f.set[flag]
+	if !ok {
+		return def, true
+	}
+	n, err := strconv.ParseInt(tok, 10, 64)
+	return n, err == nil
+}
+
+// metaKey decodes the key of a meta command, base64 encoded with the b flag
+func (ss *session) metaKey(key string, f metaFlags) (*nexuscache.Group, string, bool) {
+	if f.has('b') {
+		decoded, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			ss.reply("CLIENT_ERROR error decoding key")
+			return nil, "", false
+		}
+		key = string(decoded)
+	}
+	g, k, err := ss.resolve(key)
+	if err != nil {
+		ss.replyError(err)
+		return nil, "", false
+	}
+	return g, k, true
+}
+
+// metaReply writes a status line with the flags the request asked to get back.
+// view is nil when there is no value to describe.
+func (ss *session) metaReply(code, key string, f metaFlags, view *nexuscache.ByteView) {
+	ss.w.WriteString(code)
+	for _, arg := range f.list {
+		switch arg[0] {
+		case 'O', 'k', 'b':
+			if arg[0] == 'k' {
+				arg = "k" + key
+			}
+		case 'f':
+			if view == nil {
+				continue
+			}
+			arg = "f" + strconv.FormatUint(uint64(view.Flags()), 10)
+		case 's':
+			if view == nil {
+				continue
+			}
+			arg = "s" + strconv.Itoa(view.Len())
+		case 'c':
+			if view == nil || view.Version() == 0 {
+				continue
+			}
+			arg = "c" + strconv.FormatUint(view.Version(), 10)
+		case 't':
+			if view == nil {
+				continue
+			}
+			ttl := int64(-1)
+			if !view.Expire().IsZero() {
+				ttl = int64(max(time.Until(view.Expire()), 0).Round(time.Second) / time.Second)
+			}
+			arg = "t" + strconv.FormatInt(ttl, 10)
+		default:
+			continue
+		}
+		ss.w.WriteString(" " + arg)
+	}
+	ss.reply("")
+}
+
+// metaValue writes a VA reply carrying the value of view
+func (ss *session) metaValue(key string, f metaFlags, view *nexuscache.ByteView) {
+	ss.metaReply("VA "+strconv.Itoa(view.Len()), key, f, view)
+	ss.w.Write(view.ByteSlice())
+	ss.reply("")
+}
+
+// metaGet answers mg <key> <flags>*, loading the key from the origin when it
+// is not cached. T<ttl> also gives the key a new exptime.
+func (ss *session) metaGet(args []string) {
+	if len(args) < 2 {
+		ss.reply("CLIENT_ERROR bad command line format")
+		return
+	}
+	f, ok := parseMetaFlags(args[2:], "bcfkOqstTv")
+	exptime, okT := f.int('T', 0)
+	if !ok || !okT {
+		ss.reply("CLIENT_ERROR invalid flag")
+		return
+	}
+	g, key, ok := ss.metaKey(args[1], f)
+	if !ok {
+		return
+	}
+	view, err := g.Get(key)
+	if isNotFound(err) {
+		if !f.has('q') {
+			ss.reply("EN")
+		}
+		return
+	}
+	if err != nil {
+		ss.replyError(err)
+		return
+	}
+	if f.has('T') {
+		if _, err := touch(g, key, exptime); err != nil {
+			ss.replyError(err)
+			return
+		}
+		if expire, live := expiry(g, exptime); live {
+			view = nexuscache.NewByteViewFlags(view.ByteSlice(), expire, view.Flags())
+		}
+	}
+	if f.has('v') {
+		ss.metaValue(args[1], f, view)
+		return
+	}
+	ss.metaReply("HD", args[1], f, view)
+}
+
+// metaSet answers ms <key> <datalen> <flags>* followed by the data block.
+// F sets the client flags, T the exptime and M the mode: S set (default),
+// E add or R replace. C<cas> only stores the value over the version cas.
+func (ss *session) metaSet(args []string) error {
+	if len(args) < 3 {
+		ss.reply("CLIENT_ERROR bad command line format")
+		return ErrorBadFormat
+	}
+	size, err := strconv.Atoi(args[2])
+	if err != nil || size < 0 {
+		ss.reply("CLIENT_ERROR bad data chunk")
+		return ErrorBadFormat
+	}
+	if size > MaxValueBytes {
+		if _, err := ss.r.Discard(size + 2); err != nil {
+			return err
+		}
+		ss.reply("SERVER_ERROR object too large for cache")
+		return nil
+	}
+	value, err := ss.readData(size)
+	if err != nil {
+		ss.reply("CLIENT_ERROR bad data chunk")
+		return err
+	}
+	f, ok := parseMetaFlags(args[3:], "bcCFkMOqT")
+	flags, okF := f.int('F', 0)
+	exptime, okT := f.int('T', 0)
+	cas, errC := strconv.ParseUint(f.set['C'], 10, 64)
+	if !ok || !okF || !okT || flags < 0 || flags > 1<<32-1 || f.has('C') && errC != nil {
+		ss.reply("CLIENT_ERROR invalid flag")
+		return nil
+	}
+	mode := "set"
+	switch f.set['M'] {
+	case "", "S", "s":
+	case "E", "e":
+		mode = "add"
+	case "R", "r":
+		mode = "replace"
+	default:
+		ss.reply("CLIENT_ERROR invalid mode for ms")
+		return nil
+	}
+	if f.has('C') {
+		if mode != "set" {
+			ss.reply("CLIENT_ERROR invalid mode for ms")
+			return nil
+		}
+		mode = "cas"
+	}
+	g, key, ok := ss.metaKey(args[1], f)
+	if !ok {
+		return nil
+	}
+	stored, err := store(g, key, mode, value, uint32(flags), exptime, cas)
+	switch {
+	case isNotFound(err):
+		ss.metaReply("NF", args[1], f, nil)
+	case err != nil:
+		ss.replyError(err)
+	case !stored && mode == "cas":
+		ss.metaReply("EX", args[1], f, nil)
+	case !stored:
+		ss.metaReply("NS", args[1], f, nil)
+	case !f.has('q'):
+		ss.metaReply("HD", args[1], f, nexuscache.NewByteViewFlags(value, time.Time{}, uint32(flags)))
+	}
+	return nil
+}
+
+// metaDelete answers md <key> <flags>*
+func (ss *session) metaDelete(args []string) {
+	if len(args) < 2 {
+		ss.reply("CLIENT_ERROR bad command line format")
+		return
+	}
+	f, ok := parseMetaFlags(args[2:], "bkOq")
+	if !ok {
+		ss.reply("CLIENT_ERROR invalid flag")
+		return
+	}
+	g, key, ok := ss.metaKey(args[1], f)
+	if !ok {
+		return
+	}
+	deleted, err := g.Delete(key)
+	switch {
+	case err != nil:
+		ss.replyError(err)
+	case f.has('q'):
+	case deleted:
+		ss.metaReply("HD", args[1], f, nil)
+	default:
+		ss.metaReply("NF", args[1], f, nil)
+	}
+}
+
+// metaArithmetic answers ma <key> <flags>*. D is the delta (1), M the mode:
+// I or + to increment (default), D or - to decrement. N<ttl> creates missing
+// keys with the value J (0) and that exptime; T gives the key a new exptime.
+func (ss *session) metaArithmetic(args []string) {
+	if len(args) < 2 {
+		ss.reply("CLIENT_ERROR bad command line format")
+		return
+	}
+	f, ok := parseMetaFlags(args[2:], "bcDJkMNOqtTv")
+	delta, okD := f.int('D', 1)
+	initial, okJ := f.int('J', 0)
+	autoviv, okN := f.int('N', 0)
+	exptime, okT := f.int('T', 0)
+	if !ok {
+		ss.reply("CLIENT_ERROR invalid flag")
+		return
+	}
+	if !okD || !okJ || !okN || !okT || delta < 0 || initial < 0 {
+		ss.reply("CLIENT_ERROR invalid numeric delta argument")
+		return
+	}
+	var decr bool
+	switch f.set['M'] {
+	case "", "I", "i", "+":
+	case "D", "d", "-":
+		decr = true
+	default:
+		ss.reply("CLIENT_ERROR invalid mode for ma")
+		return
+	}
+	g, key, ok := ss.metaKey(args[1], f)
+	if !ok {
+		return
+	}
+	n, err := incr(g, key, uint64(delta), decr)
+	if isNotFound(err) && f.has('N') {
+		n = uint64(initial)
+		var added bool
+		added, err = store(g, key, "add", []byte(strconv.FormatUint(n, 10)), 0, autoviv, 0)
+		if err == nil && !added {
+			// Created by another client in the meantime
+			n, err = incr(g, key, uint64(delta), decr)
+		}
+	}
+	if err == nil && f.has('T') {
+		_, err = touch(g, key, exptime)
+	}
+	switch {
+	case isNotFound(err):
+		if !f.has('q') {
+			ss.metaReply("NF", args[1], f, nil)
+		}
+		return
+	case err != nil:
+		ss.replyError(err)
+		return
+	}
+	view, err := g.Peek(key)
+	if err != nil {
+		// Expired or evicted right away, describe the value without its state
+		view = nexuscache.NewByteView([]byte(strconv.FormatUint(n, 10)), time.Time{})
+	}
+	switch {
+	case f.has('v'):
+		ss.metaValue(args[1], f, view)
+	case !f.has('q'):
+		ss.metaReply("HD", args[1], f, view)
+	}
+}
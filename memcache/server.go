@@ -0,0 +1,510 @@
+// Package memcache serves the cache over the memcached text and meta
+// protocols, so that services using a memcached client can read and write a
+// group unchanged.
+package memcache
+
+import (
+	"NexusCache/nexuscache"
+	"NexusCache/node"
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Limits of the protocol, as in memcached
+const (
+	MaxKeyLength  = 250
+	MaxValueBytes = 1 << 20
+	maxLineBytes  = 64 << 10
+	// Exptimes up to 30 days are relative, larger ones are a Unix time
+	maxRelativeExptime = 30 * 24 * 60 * 60
+)
+
+// version is reported by the version command
+const version = "1.6.0-nexuscache"
+
+var (
+	ErrorBadFormat  = errors.New("bad command line format")
+	ErrorNonNumeric = errors.New("cannot increment or decrement non-numeric value")
+	errorLineLength = errors.New("line too long")
+)
+
+// Server accepts memcached connections and maps their commands onto Group.
+// With KeyPrefix set, a key "name:rest" addresses key "rest" of group "name"
+// whenever such a group exists.
+//
+// Values keep the client flags they were stored with. An exptime of 0 stores
+// the value for the group's TTL, as every cached value expires. The cas unique
+// of a value is its version: add and cas are checked on the owner of the key,
+// replace, incr and decr start over when another write comes in between.
+type Server struct {
+	Addr      string
+	Group     string
+	KeyPrefix bool
+
+	srv node.ConnServer
+}
+
+func (s *Server) Start(ctx context.Context) error {
+	if s.Group == "" {
+		return errors.New("memcache server needs a group")
+	}
+	s.srv.Name, s.srv.Addr, s.srv.Handle = "memcache", s.Addr, s.handle
+	return s.srv.Start(ctx)
+}
+
+// Shutdown stops accepting connections, closes the open ones and waits for
+// their commands to finish or ctx to be done
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+// BoundAddr returns the address the server listens on, "" when it is not running
+func (s *Server) BoundAddr() string {
+	return s.srv.BoundAddr()
+}
+
+// session is the state of one client connection
+type session struct {
+	*Server
+	r    *bufio.Reader
+	w    *bufio.Writer
+	quit bool
+}
+
+func (s *Server) handle(c net.Conn) {
+	ss := &session{Server: s, r: bufio.NewReader(c), w: bufio.NewWriter(c)}
+	for !ss.quit {
+		line, err := readLine(ss.r)
+		if err == errorLineLength {
+			ss.reply("CLIENT_ERROR line too long")
+			ss.w.Flush()
+			return
+		}
+		if err != nil {
+			return
+		}
+		if err := ss.exec(strings.Fields(string(line))); err != nil {
+			// The connection can't be read in step with the client anymore
+			ss.w.Flush()
+			return
+		}
+		// Pipelined commands are answered together
+		if ss.r.Buffered() == 0 {
+			if err := ss.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+	ss.w.Flush()
+}
+
+// readLine reads a line terminated by CRLF or a bare LF, without the terminator
+func readLine(r *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		part, err := r.ReadSlice('\n')
+		line = append(line, part...)
+		if len(line) > maxLineBytes {
+			return nil, errorLineLength
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return bytes.TrimSuffix(line[:len(line)-1], []byte{'\r'}), nil
+	}
+}
+
+// readData reads a data block of n bytes and its CRLF
+func (ss *session) readData(n int) ([]byte, error) {
+	data := make([]byte, n+2)
+	if _, err := io.ReadFull(ss.r, data); err != nil {
+		return nil, err
+	}
+	if data[n] != '\r' || data[n+1] != '\n' {
+		return nil, errors.New("bad data chunk")
+	}
+	return data[:n], nil
+}
+
+func (ss *session) reply(line string) {
+	ss.w.WriteString(line)
+	ss.w.WriteString("\r\n")
+}
+
+// exec runs one command. Only errors leaving the connection out of step, such
+// as a data block that can't be read, are returned.
+func (ss *session) exec(args []string) error {
+	if len(args) == 0 {
+		ss.reply("ERROR")
+		return nil
+	}
+	switch args[0] {
+	case "get", "gets":
+		ss.get(args)
+	case "set", "add", "replace", "cas":
+		return ss.store(args)
+	case "delete":
+		ss.delete(args)
+	case "touch":
+		ss.touch(args)
+	case "incr", "decr":
+		ss.incr(args)
+	case "mg":
+		ss.metaGet(args)
+	case "ms":
+		return ss.metaSet(args)
+	case "md":
+		ss.metaDelete(args)
+	case "ma":
+		ss.metaArithmetic(args)
+	case "mn":
+		ss.reply("MN")
+	case "version":
+		ss.reply("VERSION " + version)
+	case "verbosity":
+		ss.reply("OK")
+	case "quit":
+		ss.quit = true
+	default:
+		ss.reply("ERROR")
+	}
+	return nil
+}
+
+// resolve returns the group and the key within it addressed by key
+func (ss *session) resolve(key string) (*nexuscache.Group, string, error) {
+	if len(key) > MaxKeyLength || strings.ContainsFunc(key, func(r rune) bool { return r <= ' ' || r == 0x7f }) {
+		return nil, "", ErrorBadFormat
+	}
+	if ss.KeyPrefix {
+		if name, rest, ok := strings.Cut(key, ":"); ok && rest != "" {
+			if g := nexuscache.GetGroup(name); g != nil {
+				return g, rest, nil
+			}
+		}
+	}
+	g := nexuscache.GetGroup(ss.Group)
+	if g == nil {
+		return nil, "", errors.Errorf("group %q not found", ss.Group)
+	}
+	return g, key, nil
+}
+
+// replyError answers with a CLIENT_ERROR for bad requests and a SERVER_ERROR
+// for failed group operations
+func (ss *session) replyError(err error) {
+	switch errors.Cause(err) {
+	case ErrorBadFormat, ErrorNonNumeric:
+		ss.reply("CLIENT_ERROR " + errors.Cause(err).Error())
+		return
+	}
+	msg := strings.NewReplacer("\r", " ", "\n", " ").Replace(err.Error())
+	ss.reply("SERVER_ERROR " + msg)
+}
+
+func isNotFound(err error) bool {
+	return errors.Cause(err) == nexuscache.ErrorNotFound
+}
+
+// noreply strips a trailing "noreply" from args and reports whether it was there
+func noreply(args []string) ([]string, bool) {
+	if n := len(args); n > 0 && args[n-1] == "noreply" {
+		return args[:n-1], true
+	}
+	return args, false
+}
+
+// expiry translates a memcached exptime into an expiry: 0 is the group's
+// TTL, up to 30 days it is relative, beyond it a Unix time. live is false for
+// negative and past times, which have already expired.
+func expiry(g *nexuscache.Group, exptime int64) (expire time.Time, live bool) {
+	now := time.Now()
+	switch {
+	case exptime == 0:
+		return now.Add(g.TTL()), true
+	case exptime < 0:
+		return time.Time{}, false
+	case exptime <= maxRelativeExptime:
+		return now.Add(time.Duration(exptime) * time.Second), true
+	}
+	expire = time.Unix(exptime, 0)
+	return expire, expire.After(now)
+}
+
+// get answers get and gets, loading keys that are not cached from the origin
+func (ss *session) get(args []string) {
+	if len(args) < 2 {
+		ss.reply("ERROR")
+		return
+	}
+	for _, arg := range args[1:] {
+		g, key, err := ss.resolve(arg)
+		if err != nil {
+			ss.replyError(err)
+			return
+		}
+		view, err := g.Get(key)
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			ss.replyError(err)
+			return
+		}
+		fmt.Fprintf(ss.w, "VALUE %s %d %d", arg, view.Flags(), view.Len())
+		if args[0] == "gets" {
+			fmt.Fprintf(ss.w, " %d", view.Version())
+		}
+		ss.reply("")
+		ss.w.Write(view.ByteSlice())
+		ss.reply("")
+	}
+	ss.reply("END")
+}
+
+// store answers set, add, replace and cas:
+// <command> <key> <flags> <exptime> <bytes> [<cas unique>] [noreply]
+func (ss *session) store(args []string) error {
+	args, quiet := noreply(args)
+	want := 5
+	if args[0] == "cas" {
+		want = 6
+	}
+	if len(args) != want {
+		ss.reply("ERROR")
+		return nil
+	}
+	flags, err1 := strconv.ParseUint(args[2], 10, 32)
+	exptime, err2 := strconv.ParseInt(args[3], 10, 64)
+	size, err3 := strconv.Atoi(args[4])
+	var cas uint64
+	var err4 error
+	if args[0] == "cas" {
+		cas, err4 = strconv.ParseUint(args[5], 10, 64)
+	}
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || size < 0 {
+		ss.reply("CLIENT_ERROR bad command line format")
+		return ErrorBadFormat
+	}
+	if size > MaxValueBytes {
+		// Skip the data block to stay in step with the client
+		if _, err := ss.r.Discard(size + 2); err != nil {
+			return err
+		}
+		ss.reply("SERVER_ERROR object too large for cache")
+		return nil
+	}
+	value, err := ss.readData(size)
+	if err != nil {
+		ss.reply("CLIENT_ERROR bad data chunk")
+		return err
+	}
+	g, key, err := ss.resolve(args[1])
+	if err != nil {
+		ss.replyError(err)
+		return nil
+	}
+	stored, err := store(g, key, args[0], value, uint32(flags), exptime, cas)
+	switch {
+	case isNotFound(err):
+		if !quiet {
+			ss.reply("NOT_FOUND")
+		}
+	case err != nil:
+		ss.replyError(err)
+	case quiet:
+	case stored:
+		ss.reply("STORED")
+	case args[0] == "cas":
+		ss.reply("EXISTS")
+	default:
+		ss.reply("NOT_STORED")
+	}
+	return nil
+}
+
+// store sets key with mode "set", "add" (only when it isn't cached),
+// "replace" (only when it is) or "cas" (only when its version is cas) and
+// reports whether it was stored. cas fails with ErrorNotFound when key is not
+// cached.
+func store(g *nexuscache.Group, key, mode string, value []byte, flags uint32, exptime int64, cas uint64) (bool, error) {
+	expire, live := expiry(g, exptime)
+	if !live {
+		// Storing a value that already expired drops the key, when the
+		// condition of the mode holds
+		if mode != "set" {
+			old, err := g.Peek(key)
+			switch {
+			case err != nil && !isNotFound(err):
+				return false, err
+			case mode == "cas" && err != nil:
+				return false, err
+			case mode == "cas" && old.Version() != cas:
+				return false, nil
+			case (err == nil) != (mode != "add"):
+				return false, nil
+			}
+		}
+		_, err := g.Delete(key)
+		return true, err
+	}
+	view := nexuscache.NewByteViewFlags(value, expire, flags)
+	var err error
+	switch mode {
+	case "add":
+		_, err = g.Add(key, view)
+	case "replace":
+		_, err = g.Update(key, func(*nexuscache.ByteView) (*nexuscache.ByteView, error) {
+			return view, nil
+		})
+		if isNotFound(err) {
+			return false, nil
+		}
+	case "cas":
+		if cas == 0 {
+			// Version 0 would add the key, no cached value has it
+			if _, err := g.Peek(key); err != nil {
+				return false, err
+			}
+			return false, nil
+		}
+		_, err = g.CompareAndSet(key, cas, view)
+	default:
+		err = g.Set(key, view, false, false)
+	}
+	if errors.Cause(err) == nexuscache.ErrorVersionMismatch {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// delete answers delete <key> [0] [noreply]
+func (ss *session) delete(args []string) {
+	args, quiet := noreply(args)
+	if len(args) == 3 && args[2] == "0" {
+		args = args[:2]
+	}
+	if len(args) != 2 {
+		ss.reply("CLIENT_ERROR bad command line format.  Usage: delete <key> [noreply]")
+		return
+	}
+	g, key, err := ss.resolve(args[1])
+	if err != nil {
+		ss.replyError(err)
+		return
+	}
+	deleted, err := g.Delete(key)
+	switch {
+	case err != nil:
+		ss.replyError(err)
+	case quiet:
+	case deleted:
+		ss.reply("DELETED")
+	default:
+		ss.reply("NOT_FOUND")
+	}
+}
+
+// touch answers touch <key> <exptime> [noreply]
+func (ss *session) touch(args []string) {
+	args, quiet := noreply(args)
+	if len(args) != 3 {
+		ss.reply("ERROR")
+		return
+	}
+	exptime, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		ss.reply("CLIENT_ERROR invalid exptime argument")
+		return
+	}
+	g, key, err := ss.resolve(args[1])
+	if err != nil {
+		ss.replyError(err)
+		return
+	}
+	touched, err := touch(g, key, exptime)
+	switch {
+	case err != nil:
+		ss.replyError(err)
+	case quiet:
+	case touched:
+		ss.reply("TOUCHED")
+	default:
+		ss.reply("NOT_FOUND")
+	}
+}
+
+// touch gives a cached key a new exptime and reports whether it was cached
+func touch(g *nexuscache.Group, key string, exptime int64) (bool, error) {
+	expire, live := expiry(g, exptime)
+	if !live {
+		return g.Delete(key)
+	}
+	return g.Touch(key, expire)
+}
+
+// incr answers incr and decr: <command> <key> <delta> [noreply]
+func (ss *session) incr(args []string) {
+	args, quiet := noreply(args)
+	if len(args) != 3 {
+		ss.reply("ERROR")
+		return
+	}
+	delta, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil {
+		ss.reply("CLIENT_ERROR invalid numeric delta argument")
+		return
+	}
+	g, key, err := ss.resolve(args[1])
+	if err != nil {
+		ss.replyError(err)
+		return
+	}
+	n, err := incr(g, key, delta, args[0] == "decr")
+	switch {
+	case isNotFound(err):
+		if !quiet {
+			ss.reply("NOT_FOUND")
+		}
+	case err != nil:
+		ss.replyError(err)
+	case !quiet:
+		ss.reply(strconv.FormatUint(n, 10))
+	}
+}
+
+// incr adds delta to, or with decr subtracts it from, the decimal value of a
+// cached key, keeping its flags, tags and expiry. Like memcached, incr wraps around
+// at 2^64 and decr stops at 0.
+func incr(g *nexuscache.Group, key string, delta uint64, decr bool) (uint64, error) {
+	var n uint64
+	_, err := g.Update(key, func(old *nexuscache.ByteView) (*nexuscache.ByteView, error) {
+		cur, err := strconv.ParseUint(old.String(), 10, 64)
+		if err != nil {
+			return nil, ErrorNonNumeric
+		}
+		switch {
+		case !decr:
+			n = cur + delta
+		case delta > cur:
+			n = 0
+		default:
+			n = cur - delta
+		}
+		value := nexuscache.NewByteViewFlags([]byte(strconv.FormatUint(n, 10)), old.Expire(), old.Flags())
+		return value.WithTags(old.Tags()...), nil
+	})
+	return n, err
+}
@@ -0,0 +1,222 @@
+package memcache
+
+import (
+	"NexusCache/connect"
+	"NexusCache/nexuscache"
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// localPeers makes every key owned by this node
+type localPeers struct{}
+
+func (localPeers) PickPeer(key string) (connect.PeerGetter, bool) { return nil, false }
+
+// client speaks the memcached protocol to the server under test
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (c *client) send(lines ...string) {
+	c.t.Helper()
+	if _, err := c.conn.Write([]byte(strings.Join(lines, "\r\n") + "\r\n")); err != nil {
+		c.t.Fatalf("write %q: %v", lines, err)
+	}
+}
+
+func (c *client) line() string {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("read: %v", err)
+	}
+	return strings.TrimSuffix(line, "\r\n")
+}
+
+// expect sends a command and checks the reply lines that follow
+func (c *client) expect(cmd string, want ...string) {
+	c.t.Helper()
+	c.send(cmd)
+	for _, w := range want {
+		if got := c.line(); got != w {
+			c.t.Fatalf("%q: got %q, want %q", cmd, got, w)
+		}
+	}
+}
+
+func startServer(t *testing.T, s *Server) *client {
+	t.Helper()
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+	conn, err := net.Dial("tcp", s.BoundAddr())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+func newGroup(name string) *nexuscache.Group {
+	g := nexuscache.NewGroup(name, 1<<20, 1<<20, nexuscache.GetterFunc(func(key string) ([]byte, error) {
+		if key == "origin" {
+			return []byte("loaded"), nil
+		}
+		return nil, nexuscache.ErrorNotFound
+	}))
+	g.RegisterPeers(localPeers{})
+	g.SetExpireJitter(0) // Exact TTLs
+	return g
+}
+
+func TestTextCommands(t *testing.T) {
+	newGroup("mc-text")
+	newGroup("mc-other")
+	c := startServer(t, &Server{Addr: "127.0.0.1:0", Group: "mc-text", KeyPrefix: true})
+
+	c.expect("get missing", "END")
+	c.expect("get origin", "VALUE origin 0 6", "loaded", "END")
+	c.expect("set k 42 0 5\r\nhello", "STORED")
+	c.expect("get k missing origin", "VALUE k 42 5", "hello", "VALUE origin 0 6", "loaded", "END")
+
+	c.send("gets k")
+	first := c.line()
+	if fields := strings.Fields(first); len(fields) != 5 || fields[2] != "42" {
+		t.Fatalf("gets k = %q", first)
+	}
+	c.line()
+	c.line()
+	c.expect("set k 42 0 5\r\nworld", "STORED")
+	c.send("gets k")
+	if second := c.line(); second == first {
+		t.Fatalf("cas unique unchanged after set: %q", second)
+	}
+	c.line()
+	c.line()
+
+	c.expect("add k 0 0 1\r\nx", "NOT_STORED")
+	c.expect("add fresh 0 0 1\r\nx", "STORED")
+	c.expect("replace absent 0 0 1\r\nx", "NOT_STORED")
+	c.expect("replace fresh 7 0 1\r\ny", "STORED")
+	c.expect("get fresh", "VALUE fresh 7 1", "y", "END")
+
+	c.expect("set n 3 0 2\r\n10", "STORED")
+	c.expect("incr n 5", "15")
+	c.expect("decr n 20", "0")
+	c.expect("incr k 1", "CLIENT_ERROR cannot increment or decrement non-numeric value")
+	c.expect("incr absent 1", "NOT_FOUND")
+	c.expect("get n", "VALUE n 3 1", "0", "END")
+
+	c.expect("touch n 100", "TOUCHED")
+	c.expect("touch absent 100", "NOT_FOUND")
+	c.expect("delete n", "DELETED")
+	c.expect("delete n", "NOT_FOUND")
+
+	// Negative and past exptimes have already expired
+	c.expect("set gone 0 -1 1\r\nx", "STORED")
+	c.expect("get gone", "END")
+	c.expect("set gone 0 "+strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)+" 1\r\nx", "STORED")
+	c.expect("get gone", "END")
+
+	c.expect("set q 0 0 1 noreply\r\nx\r\nget q", "VALUE q 0 1", "x", "END")
+	c.expect("set mc-other:p 0 0 1\r\nz", "STORED")
+	c.expect("get p mc-other:p", "VALUE mc-other:p 0 1", "z", "END")
+	c.expect("bogus", "ERROR")
+	c.expect("get "+strings.Repeat("x", MaxKeyLength+1), "CLIENT_ERROR bad command line format")
+	c.expect("version", "VERSION "+version)
+}
+
+func TestExptime(t *testing.T) {
+	g := newGroup("mc-exptime")
+	c := startServer(t, &Server{Addr: "127.0.0.1:0", Group: "mc-exptime"})
+
+	ttl := func(key string) time.Duration {
+		view, err := g.Peek(key)
+		if err != nil {
+			t.Fatalf("peek %s: %v", key, err)
+		}
+		return time.Until(view.Expire())
+	}
+	c.expect("set rel 0 100 1\r\nx", "STORED")
+	if d := ttl("rel"); d < 99*time.Second || d > 100*time.Second {
+		t.Fatalf("relative exptime: ttl %v", d)
+	}
+	abs := time.Now().Add(time.Hour).Unix()
+	c.expect("set abs 0 "+strconv.FormatInt(abs, 10)+" 1\r\nx", "STORED")
+	if d := ttl("abs"); d < 59*time.Minute || d > time.Hour {
+		t.Fatalf("absolute exptime: ttl %v", d)
+	}
+	c.expect("set zero 0 0 1\r\nx", "STORED")
+	if d := ttl("zero"); d <= 0 || d > g.TTL() {
+		t.Fatalf("exptime 0: ttl %v, want the group TTL %v", d, g.TTL())
+	}
+	c.expect("touch zero 3600", "TOUCHED")
+	if d := ttl("zero"); d < 59*time.Minute {
+		t.Fatalf("touch: ttl %v", d)
+	}
+}
+
+func TestMetaCommands(t *testing.T) {
+	newGroup("mc-meta")
+	c := startServer(t, &Server{Addr: "127.0.0.1:0", Group: "mc-meta"})
+
+	c.expect("mg missing v", "EN")
+	c.expect("mg missing v q\r\nmn", "MN")
+	c.expect("ms k 5 F9 T100 Oabc\r\nhello", "HD Oabc")
+	c.expect("mg k v f t s k Oxyz", "VA 5 f9 t100 s5 kk Oxyz", "hello")
+	c.expect("mg k", "HD")
+	c.expect("ms k 1 ME\r\nx", "NS")
+	c.expect("ms new 1 MR\r\nx", "NS")
+	c.expect("ms k 1 MR q\r\nx\r\nmn", "MN")
+	c.expect("mg k v", "VA 1", "x")
+	c.expect("mg aw== b v k", "VA 1 b kaw==", "x")
+
+	c.expect("ma cnt", "NF")
+	c.expect("ma cnt N100 J10 v", "VA 2", "10")
+	c.expect("ma cnt D5 v t", "VA 2 t100", "15")
+	c.expect("ma cnt MD D20 v", "VA 1", "0")
+	c.expect("ma k", "CLIENT_ERROR cannot increment or decrement non-numeric value")
+
+	c.expect("md k", "HD")
+	c.expect("md k", "NF")
+	c.expect("md k q\r\nmn", "MN")
+	c.expect("mg k Z", "CLIENT_ERROR invalid flag")
+}
+
+func TestCas(t *testing.T) {
+	newGroup("mc-cas")
+	c := startServer(t, &Server{Addr: "127.0.0.1:0", Group: "mc-cas"})
+
+	c.expect("set k 0 0 2\r\nv1", "STORED")
+	c.send("gets k")
+	fields := strings.Fields(c.line())
+	c.line()
+	c.line()
+	if len(fields) != 5 {
+		t.Fatalf("gets k = %q", fields)
+	}
+	unique := fields[4]
+	c.expect("cas k 5 0 2 "+unique+"\r\nv2", "STORED")
+	c.expect("cas k 0 0 2 "+unique+"\r\nv3", "EXISTS")
+	c.expect("get k", "VALUE k 5 2", "v2", "END")
+	c.expect("cas absent 0 0 1 1\r\nx", "NOT_FOUND")
+
+	c.send("mg k c")
+	reply := strings.Fields(c.line())
+	if len(reply) != 2 || !strings.HasPrefix(reply[1], "c") || reply[1] == "c"+unique {
+		t.Fatalf("mg k c = %q", reply)
+	}
+	c.expect("ms k 2 "+"C"+reply[1][1:]+"\r\nv4", "HD")
+	c.expect("ms k 2 "+"C"+reply[1][1:]+"\r\nv5", "EX")
+	c.expect("ms absent 1 C1\r\nx", "NF")
+	c.expect("mg k v", "VA 2", "v4")
+}
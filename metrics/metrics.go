@@ -48,6 +48,26 @@ var (
 		[]string{"cache_type"},
 	)
 
+	// CachePinnedBytes tracks the memory used by pinned (non-evictable) entries
+	CachePinnedBytes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "nexuscache",
+			Name:      "cache_pinned_bytes",
+			Help:      "Current size of pinned cache entries in bytes",
+		},
+		[]string{"cache_type"},
+	)
+
+	// CachePinnedItems tracks the number of pinned entries
+	CachePinnedItems = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "nexuscache",
+			Name:      "cache_pinned_items",
+			Help:      "Number of pinned items in the cache",
+		},
+		[]string{"cache_type"},
+	)
+
 	// PeerRequestsTotal counts requests to peer nodes
 	PeerRequestsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -69,13 +89,14 @@ var (
 		[]string{"peer"},
 	)
 
-	// CacheEvictionsTotal counts cache evictions
-	CacheEvictionsTotal = promauto.NewCounter(
+	// CacheEvictionsTotal counts cache evictions by reason (capacity, expired, removed)
+	CacheEvictionsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: "nexuscache",
 			Name:      "cache_evictions_total",
 			Help:      "Total number of cache evictions",
 		},
+		[]string{"cache_type", "reason"},
 	)
 
 	// CacheExpirations counts cache expirations (TTL)
@@ -87,6 +108,55 @@ var (
 		},
 	)
 
+	// RebalanceKeysTotal counts entries moved between nodes after ring changes
+	RebalanceKeysTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "nexuscache",
+			Name:      "rebalance_keys_total",
+			Help:      "Total number of entries handed over after membership changes",
+		},
+		[]string{"status"},
+	)
+
+	// RebalancePendingKeys tracks entries still waiting to be handed over
+	RebalancePendingKeys = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "nexuscache",
+			Name:      "rebalance_pending_keys",
+			Help:      "Number of entries of the running rebalance not yet handed over",
+		},
+	)
+
+	// RebalanceDuration measures how long a rebalance takes
+	RebalanceDuration = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "nexuscache",
+			Name:      "rebalance_duration_seconds",
+			Help:      "Duration of rebalances in seconds",
+			Buckets:   []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60},
+		},
+	)
+
+	// OriginWritesTotal counts writes to the backing store by mode and outcome
+	OriginWritesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "nexuscache",
+			Name:      "origin_writes_total",
+			Help:      "Total number of writes to the backing store",
+		},
+		[]string{"mode", "status"},
+	)
+
+	// WriteBehindQueueLength tracks writes waiting to reach the backing store
+	WriteBehindQueueLength = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "nexuscache",
+			Name:      "write_behind_queue_length",
+			Help:      "Number of queued write-behind writes",
+		},
+		[]string{"group"},
+	)
+
 	// SingleflightDedup counts deduplicated requests
 	SingleflightDedupTotal = promauto.NewCounter(
 		prometheus.CounterOpts{
@@ -123,8 +193,49 @@ func RecordPeerRequest(peer, status string, durationSeconds float64) {
 	PeerRequestDuration.WithLabelValues(peer).Observe(durationSeconds)
 }
 
+// RecordEviction records an entry leaving the cache. TTL expirations are also
+// counted in CacheExpirationsTotal.
+func RecordEviction(cacheType, reason string) {
+	CacheEvictionsTotal.WithLabelValues(cacheType, reason).Inc()
+	if reason == "expired" {
+		CacheExpirationsTotal.Inc()
+	}
+}
+
 // UpdateCacheStats updates cache size and item count metrics
 func UpdateCacheStats(cacheType string, sizeBytes float64, itemCount float64) {
 	CacheSize.WithLabelValues(cacheType).Set(sizeBytes)
 	CacheItems.WithLabelValues(cacheType).Set(itemCount)
 }
+
+// UpdatePinnedStats updates pinned size and item count metrics
+func UpdatePinnedStats(cacheType string, sizeBytes float64, itemCount float64) {
+	CachePinnedBytes.WithLabelValues(cacheType).Set(sizeBytes)
+	CachePinnedItems.WithLabelValues(cacheType).Set(itemCount)
+}
+
+// RecordRebalanceKeys records entries sent, failed or received during a rebalance
+func RecordRebalanceKeys(status string, count int) {
+	RebalanceKeysTotal.WithLabelValues(status).Add(float64(count))
+}
+
+// UpdateRebalancePending sets the number of entries waiting to be handed over
+func UpdateRebalancePending(count int) {
+	RebalancePendingKeys.Set(float64(count))
+}
+
+// RecordRebalanceDuration records the duration of a finished rebalance
+func RecordRebalanceDuration(seconds float64) {
+	RebalanceDuration.Observe(seconds)
+}
+
+// RecordOriginWrites records count writes to the backing store, status is
+// success, error (will be retried) or dropped
+func RecordOriginWrites(mode, status string, count int) {
+	OriginWritesTotal.WithLabelValues(mode, status).Add(float64(count))
+}
+
+// UpdateWriteBehindQueue sets the number of queued writes of a group
+func UpdateWriteBehindQueue(group string, length int) {
+	WriteBehindQueueLength.WithLabelValues(group).Set(float64(length))
+}
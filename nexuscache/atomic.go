@@ -0,0 +1,204 @@
+package nexuscache
+
+import (
+	"NexusCache/connect"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorVersionMismatch is returned by CompareAndSet when the key was stored
+// again since the expected version was read, or is cached when adding it
+var ErrorVersionMismatch = errors.New("nexuscache: version mismatch")
+
+// ErrorNotInteger is returned by Incr when the value is not a decimal 64-bit
+// integer or the result would overflow
+var ErrorNotInteger = errors.New("nexuscache: value is not an integer or out of range")
+
+// The atomic operations below always run on the node owning the key, even
+// with bounded loads, under the key's write lock, so that no other write to
+// the key comes in between. Like Set they write the new value back to the
+// backend when the group has a writer before caching it: a failed write
+// leaves the cached value as it was, and the backend gets the writes in the
+// order they are cached.
+
+// CompareAndSet stores value if key is cached with the given version, or if
+// key is not cached when version is 0, and returns the stored value with its
+// new version. It fails with ErrorVersionMismatch when the version differs
+// and with ErrorNotFound when version is not 0 and key is not cached. A zero
+// expiry uses the group's TTL.
+func (g *Group) CompareAndSet(key string, version uint64, value *ByteView) (*ByteView, error) {
+	if key == "" {
+		return nil, errors.New("key is empty")
+	}
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(key); ok {
+			return g.compareAndSetFromPeer(peer, key, version, value)
+		}
+	}
+	return g.compareAndSetOwned(key, version, value)
+}
+
+// Add stores value only if key is not cached, see CompareAndSet
+func (g *Group) Add(key string, value *ByteView) (*ByteView, error) {
+	return g.CompareAndSet(key, 0, value)
+}
+
+// compareAndSetOwned is CompareAndSet for a peer that picked this node as the owner
+func (g *Group) compareAndSetOwned(key string, version uint64, value *ByteView) (*ByteView, error) {
+	if key == "" {
+		return nil, errors.New("key is empty")
+	}
+	if value.e.IsZero() {
+		value = NewByteViewFlags(value.b, time.Now().Add(g.TTL()), value.flags).WithTags(value.tags...)
+	}
+	return g.updateOwned(key, func(old *ByteView) (*ByteView, error) {
+		switch {
+		case old == nil && version != 0:
+			return nil, ErrorNotFound
+		case old != nil && old.version != version:
+			return nil, ErrorVersionMismatch
+		}
+		return value, nil
+	})
+}
+
+func (g *Group) compareAndSetFromPeer(peer connect.PeerGetter, key string, version uint64, value *ByteView) (*ByteView, error) {
+	stored, err := peer.CompareAndSet(g.name, key, version, value.b, value.e, value.flags, value.tags)
+	if status.Code(err) == codes.FailedPrecondition {
+		return nil, errors.Wrap(ErrorVersionMismatch, err.Error())
+	}
+	if err != nil {
+		return nil, fromPeerError(err)
+	}
+	return value.withVersion(stored), nil
+}
+
+// maxUpdateAttempts bounds how often Update starts over when other writes
+// keep coming in between
+const maxUpdateAttempts = 16
+
+// Update replaces the cached value of key with the one fn derives from it.
+// It reads the key and stores the result with CompareAndSet, starting over
+// when another write came in between, so fn may run several times. It fails
+// with ErrorNotFound when key is not cached, and with ErrorVersionMismatch
+// when it lost the race too often.
+func (g *Group) Update(key string, fn func(old *ByteView) (*ByteView, error)) (*ByteView, error) {
+	for attempt := 1; ; attempt++ {
+		old, err := g.peekMain(key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := fn(old)
+		if err != nil {
+			return nil, err
+		}
+		stored, err := g.CompareAndSet(key, old.version, value)
+		if errors.Cause(err) != ErrorVersionMismatch || attempt == maxUpdateAttempts {
+			return stored, err
+		}
+	}
+}
+
+// peekMain is Peek without this node's hot cache, whose copies carry versions
+// of their own that CompareAndSet never matches
+func (g *Group) peekMain(key string) (*ByteView, error) {
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(key); ok {
+			resp, err := peer.Peek(g.name, key)
+			if err != nil {
+				return nil, fromPeerError(err)
+			}
+			return fromPeerResponse(resp), nil
+		}
+	}
+	if value, ok := g.mainCache.peek(key); ok {
+		return value, nil
+	}
+	return nil, ErrorNotFound
+}
+
+// Incr adds delta to the decimal integer value of key and returns the result.
+// A key that is not cached is created with the value delta, expiring at
+// expire, or after the group's TTL if expire is zero. Existing keys keep
+// their expiry and flags. Use a negative delta to decrement.
+func (g *Group) Incr(key string, delta int64, expire time.Time) (int64, error) {
+	if key == "" {
+		return 0, errors.New("key is empty")
+	}
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(key); ok {
+			n, err := peer.Incr(g.name, key, delta, expire)
+			if status.Code(err) == codes.InvalidArgument {
+				return 0, errors.Wrap(ErrorNotInteger, err.Error())
+			}
+			if err != nil {
+				return 0, fromPeerError(err)
+			}
+			return n, nil
+		}
+	}
+	return g.incrOwned(key, delta, expire)
+}
+
+// Decr subtracts delta from the value of key, see Incr
+func (g *Group) Decr(key string, delta int64, expire time.Time) (int64, error) {
+	if delta == math.MinInt64 {
+		return 0, ErrorNotInteger
+	}
+	return g.Incr(key, -delta, expire)
+}
+
+// incrOwned is Incr for a peer that picked this node as the owner
+func (g *Group) incrOwned(key string, delta int64, expire time.Time) (int64, error) {
+	if key == "" {
+		return 0, errors.New("key is empty")
+	}
+	var n int64
+	_, err := g.updateOwned(key, func(old *ByteView) (*ByteView, error) {
+		if old == nil {
+			if expire.IsZero() {
+				expire = time.Now().Add(g.TTL())
+			}
+			n = delta
+			return &ByteView{b: strconv.AppendInt(nil, n, 10), e: expire}, nil
+		}
+		cur, err := strconv.ParseInt(string(old.b), 10, 64)
+		if err != nil || (delta > 0 && cur > math.MaxInt64-delta) || (delta < 0 && cur < math.MinInt64-delta) {
+			return nil, ErrorNotInteger
+		}
+		n = cur + delta
+		return &ByteView{b: strconv.AppendInt(nil, n, 10), e: old.e, flags: old.flags, tags: old.tags}, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// updateOwned stores the value fn derives from the cached value of key, nil
+// if it is not cached. Holding the key's write lock, it writes the value back
+// to the backend first and only caches and reports it once that succeeded.
+func (g *Group) updateOwned(key string, fn func(old *ByteView) (*ByteView, error)) (*ByteView, error) {
+	defer g.writes.lock(key)()
+	old, _ := g.mainCache.peek(key)
+	value, err := fn(old)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.writeBack(key, value); err != nil {
+		return nil, err
+	}
+	stored, err := g.mainCache.update(key, func(*ByteView) (*ByteView, error) {
+		return value, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	g.publishChange(key, stored)
+	return stored, nil
+}
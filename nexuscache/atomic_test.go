@@ -0,0 +1,163 @@
+package nexuscache
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func newAtomicGroup(name string) *Group {
+	g := NewGroup(name, 1<<20, 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrorNotFound
+	}))
+	g.RegisterPeers(localPeers{})
+	g.SetExpireJitter(0)
+	return g
+}
+
+func TestCompareAndSet(t *testing.T) {
+	g := newAtomicGroup("atomic-cas")
+	expire := time.Now().Add(time.Minute)
+
+	first, err := g.Add("k", NewByteViewFlags([]byte("v1"), expire, 4))
+	if err != nil || first.Version() == 0 {
+		t.Fatalf("Add = %v, %v", first, err)
+	}
+	if _, err := g.Add("k", NewByteView([]byte("again"), expire)); errors.Cause(err) != ErrorVersionMismatch {
+		t.Fatalf("Add of a cached key: expected ErrorVersionMismatch, got %v", err)
+	}
+	view, err := g.Get("k")
+	if err != nil || view.Version() != first.Version() || view.Flags() != 4 {
+		t.Fatalf("Get = %v, %v, want version %d", view, err, first.Version())
+	}
+
+	second, err := g.CompareAndSet("k", first.Version(), NewByteView([]byte("v2"), expire))
+	if err != nil || second.Version() <= first.Version() {
+		t.Fatalf("CompareAndSet = %v, %v", second, err)
+	}
+	if _, err := g.CompareAndSet("k", first.Version(), NewByteView([]byte("v3"), expire)); errors.Cause(err) != ErrorVersionMismatch {
+		t.Fatalf("stale CompareAndSet: expected ErrorVersionMismatch, got %v", err)
+	}
+	if _, err := g.CompareAndSet("missing", 1, NewByteView([]byte("x"), expire)); errors.Cause(err) != ErrorNotFound {
+		t.Fatalf("CompareAndSet of a missing key: expected ErrorNotFound, got %v", err)
+	}
+	// Set hands out a new version as well
+	g.Set("k", NewByteView([]byte("v4"), expire), false, false)
+	if view, _ := g.Peek("k"); view.String() != "v4" || view.Version() <= second.Version() {
+		t.Fatalf("Peek after Set = %v", view)
+	}
+
+	updated, err := g.Update("k", func(old *ByteView) (*ByteView, error) {
+		return NewByteView(append(old.ByteSlice(), '!'), old.Expire()), nil
+	})
+	if err != nil || updated.String() != "v4!" {
+		t.Fatalf("Update = %v, %v", updated, err)
+	}
+	if _, err := g.Update("missing", nil); errors.Cause(err) != ErrorNotFound {
+		t.Fatalf("Update of a missing key: expected ErrorNotFound, got %v", err)
+	}
+}
+
+func TestIncr(t *testing.T) {
+	g := newAtomicGroup("atomic-incr")
+	expire := time.Now().Add(time.Minute)
+
+	if n, err := g.Incr("n", 5, expire); err != nil || n != 5 {
+		t.Fatalf("Incr of a missing key = %d, %v", n, err)
+	}
+	if n, err := g.Decr("n", 7, time.Time{}); err != nil || n != -2 {
+		t.Fatalf("Decr = %d, %v", n, err)
+	}
+	if view, _ := g.Peek("n"); view.String() != "-2" || view.Expire().Sub(expire).Abs() > time.Millisecond {
+		t.Fatalf("Incr should keep the expiry, got %v", view)
+	}
+
+	g.Set("s", NewByteView([]byte("abc"), expire), false, false)
+	if _, err := g.Incr("s", 1, expire); errors.Cause(err) != ErrorNotInteger {
+		t.Fatalf("Incr of a string: expected ErrorNotInteger, got %v", err)
+	}
+	g.Set("max", NewByteView([]byte("9223372036854775807"), expire), false, false)
+	if _, err := g.Incr("max", 1, expire); errors.Cause(err) != ErrorNotInteger {
+		t.Fatalf("overflowing Incr: expected ErrorNotInteger, got %v", err)
+	}
+
+	// Concurrent increments are not lost
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, err := g.Incr("c", 1, expire); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if view, _ := g.Peek("c"); view.String() != "800" {
+		t.Fatalf("expected 800 after concurrent increments, got %v", view)
+	}
+}
+
+func TestIncrWritesBackInOrder(t *testing.T) {
+	g := newAtomicGroup("atomic-incr-write-back")
+	setter := &recordingSetter{}
+	g.SetWriteThrough(setter)
+	expire := time.Now().Add(time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, err := g.Incr("c", 1, expire); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	// The backend must see the counts in the order they were cached, so that
+	// it ends up with the cached count
+	var want [][]string
+	for n := 1; n <= 400; n++ {
+		want = append(want, []string{"c=" + strconv.Itoa(n)})
+	}
+	if got := setter.keys(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("writes reached the backend out of order: %v", got)
+	}
+	if view, _ := g.Peek("c"); view.String() != "400" {
+		t.Fatalf("expected 400 cached, got %v", view)
+	}
+}
+
+func TestIncrFailedWriteBack(t *testing.T) {
+	g := newAtomicGroup("atomic-incr-failed-write")
+	setter := &recordingSetter{}
+	g.SetWriteThrough(setter)
+	expire := time.Now().Add(time.Minute)
+	if err := g.Set("n", NewByteView([]byte("5"), expire), false, false); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := g.Peek("n")
+
+	setter.mu.Lock()
+	setter.fail = 1
+	setter.mu.Unlock()
+	if _, err := g.Incr("n", 1, expire); err == nil {
+		t.Fatalf("Incr should fail when the backend refuses the write")
+	}
+	// The backend refused 6, so the cache must keep serving 5
+	if view, err := g.Peek("n"); err != nil || view.String() != "5" || view.Version() != before.Version() {
+		t.Fatalf("a failed write-back should leave the old value, got %v, %v", view, err)
+	}
+	if n, err := g.Incr("n", 1, expire); err != nil || n != 6 {
+		t.Fatalf("Incr after the backend recovered = %d, %v", n, err)
+	}
+}
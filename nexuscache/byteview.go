@@ -6,8 +6,14 @@ import "time"
 // ByteView represents a cache value and is the storage unit of NexusCache.
 // It implements the lru.Value interface, allowing direct storage in the LRU cache.
 type ByteView struct {
-	b []byte
-	e time.Time
+	b     []byte
+	e     time.Time
+	flags uint32   // Opaque to the cache, e.g. memcached client flags
+	tags  []string // Names the value can be invalidated by, see Group.InvalidateTag
+	// version changes whenever the owner stores the key, 0 until it is stored
+	version uint64
+	// generation is the generation of the cache holding the value, see cache.flush
+	generation uint64
 }
 
 func (v *ByteView) Len() int {
@@ -19,6 +25,36 @@ func (v ByteView) Expire() time.Time {
 	return v.e
 }
 
+// Flags returns the client flags stored with the value
+func (v ByteView) Flags() uint32 {
+	return v.flags
+}
+
+// Version returns the version the owner stored the value with, see
+// Group.CompareAndSet
+func (v ByteView) Version() uint64 {
+	return v.version
+}
+
+// Tags returns the tags the value was set with
+func (v ByteView) Tags() []string {
+	return v.tags
+}
+
+// WithTags returns a copy of v carrying tags, replacing those it had
+func (v *ByteView) WithTags(tags ...string) *ByteView {
+	c := *v
+	c.tags = tags
+	return &c
+}
+
+// withVersion returns a copy of v with the given version
+func (v *ByteView) withVersion(version uint64) *ByteView {
+	c := *v
+	c.version = version
+	return &c
+}
+
 func (v *ByteView) ByteSlice() []byte {
 	return cloneBytes(v.b)
 }
@@ -36,3 +72,8 @@ func cloneBytes(b []byte) []byte {
 func NewByteView(b []byte, e time.Time) *ByteView {
 	return &ByteView{b: b, e: e}
 }
+
+// NewByteViewFlags returns a value carrying client flags
+func NewByteViewFlags(b []byte, e time.Time, flags uint32) *ByteView {
+	return &ByteView{b: b, e: e, flags: flags}
+}
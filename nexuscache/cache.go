@@ -2,39 +2,459 @@ package nexuscache
 
 import (
 	"NexusCache/lru"
+	"NexusCache/metrics"
+	"strings"
 	"sync"
+	"time"
 )
 
+// eviction records an entry dropped by the lru so that listeners can be
+// notified once the cache lock is released
+type eviction struct {
+	key    string
+	value  *ByteView
+	reason lru.EvictReason
+}
+
 // Concurrent-safe cache wrapper
 type cache struct {
-	mu         sync.Mutex
-	lru        *lru.Cache
-	cacheBytes int64
+	mu          sync.Mutex
+	lru         *lru.Cache
+	cacheBytes  int64
+	pinnedBytes int64          // Budget for pinned entries, 0 keeps the lru default
+	jitter      *time.Duration // Expiry jitter, nil keeps the lru default
+	cacheType   string         // Label used when reporting metrics, e.g. "main" or "hot"
+
+	// onEvicted is called outside the lock for every entry the lru drops
+	onEvicted func(key string, value *ByteView, reason lru.EvictReason)
+	evicted   []eviction // Evictions collected while holding mu
+
+	// version is the last version handed out. It starts at the clock in
+	// nanoseconds, so that versions keep growing across restarts and keys
+	// handed over from other nodes.
+	version uint64
+
+	// tagged maps each tag to the keys whose value carries it, and keyTags
+	// the keys to their tags, so that the index follows evictions
+	tagged  map[string]map[string]struct{}
+	keyTags map[string][]string
+
+	// generation is bumped by flush: entries stored in an earlier generation
+	// are no longer visible and are dropped when next found
+	generation uint64
+
+	// written records the keys written or deleted here while entries may be
+	// migrated in from their previous owner, nil when no migration is expected
+	written map[string]struct{}
 }
 
-// add uses a lock to ensure data consistency, calls the underlying LRU Add method
-func (c *cache) add(key string, value *ByteView) {
+// add uses a lock to ensure data consistency, calls the underlying LRU Add method,
+// and returns the value stored with its new version.
+// Pinned entries are exempt from capacity eviction but may fail with
+// lru.ErrPinnedBudgetExceeded when the pinned budget is used up.
+func (c *cache) add(key string, value *ByteView, pinned bool) (*ByteView, error) {
+	c.mu.Lock()
+	c.lazyInit()
+	value = value.withVersion(c.nextVersionLocked(key))
+	c.markWrittenLocked(key)
+	err := c.storeLocked(key, value, func() error {
+		if pinned {
+			return c.lru.AddPinned(key, value, value.Expire())
+		}
+		c.lru.Add(key, value, value.Expire())
+		return nil
+	})
+	c.updateStats()
+	c.unlockAndNotify()
+	return value, err
+}
+
+// fill is add for a value loaded from the origin after a miss: when key was
+// stored in the meantime, the cached value is kept and returned instead
+func (c *cache) fill(key string, value *ByteView) *ByteView {
+	c.mu.Lock()
+	c.lazyInit()
+	if cur, expire, ok := c.peekLocked(key); ok {
+		value = &ByteView{b: cur.b, e: expire, flags: cur.flags, tags: cur.tags, version: cur.version}
+	} else {
+		value = value.withVersion(c.nextVersionLocked(key))
+		c.storeLocked(key, value, func() error {
+			c.lru.Add(key, value, value.Expire())
+			return nil
+		})
+		c.updateStats()
+	}
+	c.unlockAndNotify()
+	return value
+}
+
+// nextVersionLocked returns a version greater than any handed out by this
+// cache and than the current version of key, must be called with c.mu held
+func (c *cache) nextVersionLocked(key string) uint64 {
+	if old, _, ok := c.peekLocked(key); ok {
+		c.version = max(c.version, old.version)
+	}
+	c.version++
+	return c.version
+}
+
+// update stores the value fn returns for the current value of key, nil if it
+// is not cached, while holding the lock, so that no other write comes in
+// between. The entry stays pinned if it was, and its expiry is kept exactly
+// as fn returns it, without jitter. Errors of fn are returned as is.
+func (c *cache) update(key string, fn func(old *ByteView) (*ByteView, error)) (*ByteView, error) {
+	c.mu.Lock()
+	c.lazyInit()
+	var old *ByteView
+	if v, expire, ok := c.peekLocked(key); ok {
+		cur := *v
+		cur.e = expire
+		old = &cur
+	}
+	value, err := fn(old)
+	if err == nil {
+		value = value.withVersion(c.nextVersionLocked(key))
+		c.markWrittenLocked(key)
+		err = c.storeLocked(key, value, func() error {
+			return c.lru.Import(key, value, value.Expire(), c.lru.IsPinned(key))
+		})
+		c.updateStats()
+	}
+	c.unlockAndNotify()
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// storeLocked runs store, which puts value under key into the lru, and keeps
+// the tag index in step, must be called with c.mu held. The index is updated
+// first so that an eviction of key during store removes it again. value must
+// not be shared yet, it is stamped with the current generation.
+func (c *cache) storeLocked(key string, value *ByteView, store func() error) error {
+	value.generation = c.generation
+	old := c.keyTags[key]
+	c.setTagsLocked(key, value.tags)
+	if err := store(); err != nil {
+		c.setTagsLocked(key, old)
+		return err
+	}
+	return nil
+}
+
+// setTagsLocked indexes key under tags instead of its previous tags
+func (c *cache) setTagsLocked(key string, tags []string) {
+	for _, tag := range c.keyTags[key] {
+		delete(c.tagged[tag], key)
+		if len(c.tagged[tag]) == 0 {
+			delete(c.tagged, tag)
+		}
+	}
+	delete(c.keyTags, key)
+	if len(tags) == 0 {
+		return
+	}
+	if c.tagged == nil {
+		c.tagged = make(map[string]map[string]struct{})
+		c.keyTags = make(map[string][]string)
+	}
+	c.keyTags[key] = tags
+	for _, tag := range tags {
+		if c.tagged[tag] == nil {
+			c.tagged[tag] = make(map[string]struct{})
+		}
+		c.tagged[tag][key] = struct{}{}
+	}
+}
+
+// removeTag drops the keys whose value carries tag and returns those that
+// had not expired
+func (c *cache) removeTag(tag string) []string {
+	c.mu.Lock()
+	if c.lru == nil {
+		c.mu.Unlock()
+		return nil
+	}
+	var keys []string
+	for key := range c.tagged[tag] {
+		keys = append(keys, key)
+	}
+	removed := c.removeKeysLocked(keys)
+	c.unlockAndNotify()
+	return removed
+}
+
+// removePrefix drops the keys starting with prefix and returns them
+func (c *cache) removePrefix(prefix string) []string {
 	c.mu.Lock()
-	defer c.mu.Unlock()
 	if c.lru == nil {
-		if lru.DefaultMaxBytes > c.cacheBytes {
-			c.lru = lru.New(lru.DefaultMaxBytes, nil)
-		} else {
-			c.lru = lru.New(c.cacheBytes, nil)
+		c.mu.Unlock()
+		return nil
+	}
+	var keys []string
+	c.lru.Range(func(key string, value lru.Value, expire time.Time, pinned bool) bool {
+		if value.(*ByteView).generation == c.generation && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	removed := c.removeKeysLocked(keys)
+	c.unlockAndNotify()
+	return removed
+}
+
+// removeKeysLocked drops keys and returns those that had not expired
+func (c *cache) removeKeysLocked(keys []string) []string {
+	var removed []string
+	for _, key := range keys {
+		if _, _, ok := c.peekLocked(key); ok {
+			removed = append(removed, key)
 		}
+		c.lru.Remove(key)
+		c.markWrittenLocked(key)
+	}
+	c.updateStats()
+	return removed
+}
+
+// removeVersion drops key if it still has the given version
+func (c *cache) removeVersion(key string, version uint64) {
+	c.mu.Lock()
+	if c.lru == nil {
+		c.mu.Unlock()
+		return
+	}
+	if v, _, ok := c.peekLocked(key); ok && v.version == version {
+		c.lru.Remove(key)
+		c.updateStats()
 	}
-	c.lru.Add(key, value, value.Expire())
+	c.unlockAndNotify()
+}
+
+// lazyInit creates the lru on first use, must be called with c.mu held
+func (c *cache) lazyInit() {
+	if c.lru != nil {
+		return
+	}
+	if lru.DefaultMaxBytes > c.cacheBytes {
+		c.lru = lru.New(lru.DefaultMaxBytes, c.recordEviction)
+	} else {
+		c.lru = lru.New(c.cacheBytes, c.recordEviction)
+	}
+	if c.pinnedBytes != 0 {
+		c.lru.SetMaxPinnedBytes(c.pinnedBytes)
+	}
+	if c.jitter != nil {
+		c.lru.ExpireRandom = *c.jitter
+	}
+	c.version = uint64(time.Now().UnixNano())
 }
 
 // get acquires lock and calls the underlying Get
 func (c *cache) get(key string) (value *ByteView, ok bool) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
 	if c.lru == nil {
+		c.mu.Unlock()
 		return
 	}
-	if v, ok := c.lru.Get(key); ok {
-		return v.(*ByteView), ok
+	if v, hit := c.lru.Get(key); hit {
+		value, ok = v.(*ByteView), true
+		if value.generation != c.generation {
+			c.lru.Remove(key)
+			c.updateStats()
+			value, ok = nil, false
+		}
 	}
+	c.unlockAndNotify()
 	return
 }
+
+// cacheEntry is a copy of an entry taken out of the lru, e.g. for migration
+type cacheEntry struct {
+	key    string
+	value  *ByteView
+	expire time.Time // Expiry as tracked by the lru, including jitter
+	pinned bool
+}
+
+// entries returns a copy of all unexpired entries for which keep returns true
+func (c *cache) entries(keep func(key string) bool) []cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return nil
+	}
+	var out []cacheEntry
+	c.lru.Range(func(key string, value lru.Value, expire time.Time, pinned bool) bool {
+		if value.(*ByteView).generation == c.generation && keep(key) {
+			out = append(out, cacheEntry{key, value.(*ByteView), expire, pinned})
+		}
+		return true
+	})
+	return out
+}
+
+// importEntry stores an entry taken over from another node, keeping its
+// expiry, and reports whether it was stored. Keys written or deleted here
+// since the membership change, see trackWrites, keep their local state.
+func (c *cache) importEntry(key string, value *ByteView, expire time.Time, pinned bool) (bool, error) {
+	c.mu.Lock()
+	c.lazyInit()
+	if _, ok := c.written[key]; ok {
+		c.mu.Unlock()
+		return false, nil
+	}
+	c.version = max(c.version, value.version)
+	err := c.storeLocked(key, value, func() error {
+		return c.lru.Import(key, value, expire, pinned)
+	})
+	c.updateStats()
+	c.unlockAndNotify()
+	return err == nil, err
+}
+
+// remove drops key from the cache and reports whether it was cached
+func (c *cache) remove(key string) bool {
+	c.mu.Lock()
+	if c.lru == nil {
+		c.mu.Unlock()
+		return false
+	}
+	_, _, ok := c.peekLocked(key)
+	c.lru.Remove(key)
+	c.markWrittenLocked(key)
+	c.updateStats()
+	c.unlockAndNotify()
+	return ok
+}
+
+// trackWrites starts recording the keys written to the cache afresh, or stops
+// recording them
+func (c *cache) trackWrites(on bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.written = nil
+	if on {
+		c.written = make(map[string]struct{})
+	}
+}
+
+// markWrittenLocked records a write of key if writes are tracked, must be
+// called with c.mu held
+func (c *cache) markWrittenLocked(key string) {
+	if c.written != nil {
+		c.written[key] = struct{}{}
+	}
+}
+
+// stats returns the number of entries and their size
+func (c *cache) stats() (items int64, bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return 0, 0
+	}
+	return int64(c.lru.Len()), c.lru.Bytes()
+}
+
+// peek returns the value of key with its expiry as tracked by the lru,
+// without refreshing it
+func (c *cache) peek(key string) (value *ByteView, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return nil, false
+	}
+	value, expire, ok := c.peekLocked(key)
+	if !ok {
+		return nil, false
+	}
+	return &ByteView{b: value.b, e: expire, flags: value.flags, tags: value.tags, version: value.version}, true
+}
+
+// peekLocked is lru.Peek for entries of the current generation, it drops an
+// entry stored before the last flush. Must be called with c.mu held.
+func (c *cache) peekLocked(key string) (*ByteView, time.Time, bool) {
+	v, expire, ok := c.lru.Peek(key)
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	value := v.(*ByteView)
+	if value.generation != c.generation {
+		c.lru.Remove(key)
+		return nil, time.Time{}, false
+	}
+	return value, expire, true
+}
+
+// flush makes every entry invisible at once by starting a new generation.
+// The entries are reclaimed as they are found or evicted.
+func (c *cache) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+}
+
+// setPinnedBytes changes the pinned-bytes budget of the cache
+func (c *cache) setPinnedBytes(n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pinnedBytes = n
+	if c.lru != nil {
+		c.lru.SetMaxPinnedBytes(n)
+	}
+}
+
+// setCacheBytes changes the capacity of the cache, evicting entries that no
+// longer fit
+func (c *cache) setCacheBytes(n int64) {
+	c.mu.Lock()
+	c.cacheBytes = n
+	if c.lru == nil {
+		c.mu.Unlock()
+		return
+	}
+	c.lru.SetMaxBytes(max(n, lru.DefaultMaxBytes))
+	c.updateStats()
+	c.unlockAndNotify()
+}
+
+// setExpireJitter changes the random jitter added to expiry times
+func (c *cache) setExpireJitter(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.jitter = &d
+	if c.lru != nil {
+		c.lru.ExpireRandom = d
+	}
+}
+
+// recordEviction is the lru OnEvicted callback, it runs with c.mu held
+func (c *cache) recordEviction(key string, value lru.Value, reason lru.EvictReason) {
+	metrics.RecordEviction(c.cacheType, reason.String())
+	c.setTagsLocked(key, nil)
+	// Entries of an earlier generation were already reported flushed
+	if c.onEvicted != nil && value.(*ByteView).generation == c.generation {
+		c.evicted = append(c.evicted, eviction{key, value.(*ByteView), reason})
+	}
+}
+
+// unlockAndNotify releases c.mu and then hands pending evictions to onEvicted,
+// so that listeners may safely call back into the cache
+func (c *cache) unlockAndNotify() {
+	evicted := c.evicted
+	c.evicted = nil
+	c.mu.Unlock()
+	for _, e := range evicted {
+		c.onEvicted(e.key, e.value, e.reason)
+	}
+}
+
+// updateStats reports size metrics, must be called with c.mu held
+func (c *cache) updateStats() {
+	if c.cacheType == "" {
+		return
+	}
+	metrics.UpdateCacheStats(c.cacheType, float64(c.lru.Bytes()), float64(c.lru.Len()))
+	metrics.UpdatePinnedStats(c.cacheType, float64(c.lru.PinnedBytes()), float64(c.lru.PinnedLen()))
+}
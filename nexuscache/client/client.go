@@ -0,0 +1,652 @@
+// Package client is a Go client for NexusCache. It follows node registrations
+// in etcd, places keys with the same consistent hashing as the servers and
+// sends each request straight to the node owning the key, saving the hop an
+// application pays when it talks to a single node's HTTP API.
+package client
+
+import (
+	cachepb "NexusCache/cachepb/v1"
+	"NexusCache/connect"
+	"NexusCache/consistenthash"
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrorNotFound is returned for keys that are neither cached nor in the origin
+	ErrorNotFound = errors.New("client: key not found")
+	// ErrorNoNodes is returned when no node of the cluster is registered
+	ErrorNoNodes = errors.New("client: no registered nodes")
+	// ErrorVersionMismatch is returned by CompareAndSet when the key was
+	// written since its version was read, or by Add when it is cached
+	ErrorVersionMismatch = errors.New("client: version mismatch")
+	// ErrorNotInteger is returned by Incr for values that are not integers
+	ErrorNotInteger = errors.New("client: value is not an integer or out of range")
+)
+
+// Defaults of the Config fields left zero
+const (
+	defaultTimeout      = 2 * time.Second
+	defaultRetries      = 2
+	defaultRetryBackoff = 50 * time.Millisecond
+	defaultDownPeriod   = 5 * time.Second
+)
+
+// Config describes the cluster a Client talks to
+type Config struct {
+	Etcd       []string         // etcd endpoints, used when EtcdClient is nil
+	EtcdClient *clientv3.Client // Shared etcd client, not closed by Close
+	Peers      []string         // Names of the nodes, as in discovery.peers
+	// Placement and Replicas must match the servers' node.placement and
+	// node.replicas, "ring" and consistenthash.DefaultReplicas by default
+	Placement string
+	Replicas  int
+	// Timeout bounds each attempt, Retries is the number of extra attempts
+	// after an unreachable node, waiting RetryBackoff doubled each time
+	Timeout      time.Duration
+	Retries      int
+	RetryBackoff time.Duration
+	// DownPeriod is how long a node that failed is routed around
+	DownPeriod  time.Duration
+	DialOptions []grpc.DialOption
+	// NearCacheBytes enables a cache of the values read by this process,
+	// kept coherent by the invalidations of the nodes they were read from,
+	// 0 disables it. NearCacheTTL bounds how long a value is served from it,
+	// 1 minute by default.
+	NearCacheBytes int64
+	NearCacheTTL   time.Duration
+}
+
+// node is a registered node and its connection
+type node struct {
+	name string
+	addr string
+	conn *grpc.ClientConn
+	api  cachepb.CacheServiceClient
+}
+
+// Client routes requests to the node owning each key. Nodes answer for any
+// key, so when the owner can't be reached the request fails over to the node
+// the key moves to once the owner leaves the ring. With bounded loads enabled
+// on the servers the owner may still forward a request to a less loaded node.
+type Client struct {
+	cfg     Config
+	etcd    *clientv3.Client
+	ownEtcd bool
+	cancel  context.CancelFunc
+
+	mu    sync.RWMutex
+	ring  consistenthash.Placement
+	nodes map[string]*node
+	down  map[string]time.Time // nodes routed around until the given time
+
+	near *nearCache // nil if disabled
+}
+
+// New connects to the cluster described by cfg and keeps following its
+// membership until Close. It fails if none of the peers is registered.
+func New(cfg Config) (*Client, error) {
+	c, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	c.etcd = cfg.EtcdClient
+	if c.etcd == nil {
+		etcd, err := connect.NewEtcd(cfg.Etcd)
+		if err != nil {
+			return nil, err
+		}
+		c.etcd, c.ownEtcd = etcd.EtcdCli, true
+	}
+	for _, name := range cfg.Peers {
+		info, err := connect.GetNodeByName(c.etcd, name)
+		if err != nil {
+			log.Printf("client: %v", err)
+			continue
+		}
+		c.setNode(name, info)
+	}
+	if len(c.Nodes()) == 0 {
+		c.Close()
+		return nil, ErrorNoNodes
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	connect.WatchNodes(ctx, c.etcd, cfg.Peers, func(name string, info connect.NodeInfo, deleted bool) {
+		if deleted {
+			c.removeNode(name)
+			return
+		}
+		c.setNode(name, info)
+	})
+	return c, nil
+}
+
+// newClient fills the defaults of cfg and creates a client without nodes
+func newClient(cfg Config) (*Client, error) {
+	if cfg.Replicas == 0 {
+		cfg.Replicas = consistenthash.DefaultReplicas
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.Retries == 0 {
+		cfg.Retries = defaultRetries
+	}
+	if cfg.RetryBackoff == 0 {
+		cfg.RetryBackoff = defaultRetryBackoff
+	}
+	if cfg.DownPeriod == 0 {
+		cfg.DownPeriod = defaultDownPeriod
+	}
+	if len(cfg.DialOptions) == 0 {
+		cfg.DialOptions = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	ring, err := consistenthash.NewPlacement(cfg.Placement, cfg.Replicas)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{cfg: cfg, ring: ring, nodes: make(map[string]*node), down: make(map[string]time.Time)}
+	if cfg.NearCacheBytes > 0 {
+		c.near = newNearCache(cfg.NearCacheBytes, cfg.NearCacheTTL)
+	}
+	return c, nil
+}
+
+// setNode puts a registered node on the ring, reconnecting if its address changed
+func (c *Client) setNode(name string, info connect.NodeInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resetNear()
+	if n, ok := c.nodes[name]; ok && n.addr == info.Addr {
+		c.ring.AddWeightedNode(name, info.Weight)
+		return
+	}
+	conn, err := grpc.NewClient(info.Addr, c.cfg.DialOptions...)
+	if err != nil {
+		log.Printf("client: dial %s at %s: %v", name, info.Addr, err)
+		return
+	}
+	if old, ok := c.nodes[name]; ok {
+		old.conn.Close()
+	}
+	c.nodes[name] = &node{name: name, addr: info.Addr, conn: conn, api: cachepb.NewCacheServiceClient(conn)}
+	c.ring.AddWeightedNode(name, info.Weight)
+	delete(c.down, name)
+}
+
+// removeNode takes a node whose registration disappeared off the ring
+func (c *Client) removeNode(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resetNear()
+	if n, ok := c.nodes[name]; ok {
+		n.conn.Close()
+		delete(c.nodes, name)
+	}
+	c.ring.Remove(name)
+	delete(c.down, name)
+}
+
+// resetNear empties the near cache when keys may have moved to other nodes,
+// whose invalidations it doesn't follow
+func (c *Client) resetNear() {
+	if c.near != nil {
+		c.near.reset()
+	}
+}
+
+// Nodes returns the names of the nodes requests are sent to, sorted
+func (c *Client) Nodes() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	names := make([]string, 0, len(c.nodes))
+	for name := range c.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Owner returns the node a request for key is sent to, skipping the nodes
+// that recently failed and those in skip, or "" if none is left
+func (c *Client) Owner(key string, skip ...string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ownerLocked(key, skip)
+}
+
+func (c *Client) ownerLocked(key string, skip []string) string {
+	var avoid []string
+	now := time.Now()
+	for name, until := range c.down {
+		if now.Before(until) {
+			avoid = append(avoid, name)
+		}
+	}
+	avoid = append(avoid, skip...)
+	owner := c.ring.Get(key)
+	if !contains(avoid, owner) {
+		return owner
+	}
+	// Place the key as the servers will once the avoided nodes leave. If every
+	// node is down, try the real owner again rather than nobody.
+	ring := c.ring.Clone()
+	for _, name := range avoid {
+		ring.Remove(name)
+	}
+	if next := ring.Get(key); next != "" {
+		return next
+	}
+	if contains(skip, owner) {
+		return ""
+	}
+	return owner
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// markDown routes requests around name for the configured DownPeriod
+func (c *Client) markDown(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.nodes[name]; ok {
+		c.down[name] = time.Now().Add(c.cfg.DownPeriod)
+	}
+}
+
+// retryable reports whether an error means the node, rather than the
+// request, failed, so another node may answer
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// do calls fn on the owner of key, failing over to the next node on errors
+// telling that the node is unreachable
+func (c *Client) do(ctx context.Context, key string, fn func(ctx context.Context, n *node) error) error {
+	var (
+		tried   []string
+		lastErr error
+	)
+	backoff := c.cfg.RetryBackoff
+	for attempt := 0; attempt <= c.cfg.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+				backoff *= 2
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		c.mu.RLock()
+		name := c.ownerLocked(key, tried)
+		n := c.nodes[name]
+		c.mu.RUnlock()
+		if n == nil {
+			if lastErr != nil {
+				return lastErr
+			}
+			return ErrorNoNodes
+		}
+		attemptCtx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+		err := fn(attemptCtx, n)
+		cancel()
+		if err == nil || !retryable(err) || ctx.Err() != nil {
+			return toError(err)
+		}
+		log.Printf("client: node %s failed, retrying: %v", name, err)
+		c.markDown(name)
+		tried = append(tried, name)
+		lastErr = err
+	}
+	return lastErr
+}
+
+// toError turns the statuses documented in cache.proto into the errors of
+// this package and keeps other statuses
+func toError(err error) error {
+	switch status.Code(err) {
+	case codes.NotFound:
+		return errors.Wrap(ErrorNotFound, status.Convert(err).Message())
+	case codes.FailedPrecondition:
+		return errors.Wrap(ErrorVersionMismatch, status.Convert(err).Message())
+	case codes.InvalidArgument:
+		if strings.Contains(status.Convert(err).Message(), "not an integer") {
+			return errors.Wrap(ErrorNotInteger, status.Convert(err).Message())
+		}
+	}
+	return err
+}
+
+// Item is a cached value with its flags, remaining time to live and version
+type Item struct {
+	Key     string
+	Value   []byte
+	Flags   uint32
+	TTL     time.Duration // 0 if unknown
+	Version uint64        // Changes on every write, see CompareAndSet
+}
+
+// Get returns the value of key, loading it from the origin on its owner when
+// it is not cached
+func (c *Client) Get(ctx context.Context, group, key string) ([]byte, error) {
+	item, err := c.GetItem(ctx, group, key)
+	if err != nil {
+		return nil, err
+	}
+	return item.Value, nil
+}
+
+// GetItem is Get returning the flags and TTL as well
+func (c *Client) GetItem(ctx context.Context, group, key string) (*Item, error) {
+	if c.near != nil {
+		if item, ok := c.near.get(group, key); ok {
+			return item, nil
+		}
+	}
+	var item *Item
+	err := c.do(ctx, key, func(ctx context.Context, n *node) error {
+		read := c.beginNear(n, group)
+		resp, err := n.api.Get(ctx, &cachepb.GetRequest{Group: group, Key: key})
+		if err != nil {
+			return err
+		}
+		item = &Item{
+			Key:     key,
+			Value:   resp.GetValue(),
+			Flags:   resp.GetFlags(),
+			TTL:     time.Duration(resp.GetTtlMs()) * time.Millisecond,
+			Version: resp.GetVersion(),
+		}
+		c.storeNear(read, item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// beginNear prepares caching a value about to be read from n, see nearCache.begin
+func (c *Client) beginNear(n *node, group string) nearRead {
+	if c.near == nil {
+		return nearRead{}
+	}
+	return c.near.begin(n, group)
+}
+
+func (c *Client) storeNear(read nearRead, item *Item) {
+	if c.near != nil {
+		c.near.store(read, item)
+	}
+}
+
+// invalidateNear drops a key this process changed, without waiting for the
+// owner's invalidation
+func (c *Client) invalidateNear(group, key string) {
+	if c.near != nil {
+		c.near.invalidate(group, key)
+	}
+}
+
+// SetOptions are the optional settings of a write
+type SetOptions struct {
+	Flags uint32
+	// Hot keeps the value in the hot cache of the node receiving the write
+	// instead of storing it on the owner
+	Hot    bool
+	Pinned bool     // Never evict under memory pressure
+	Tags   []string // Names to drop the key by, see InvalidateTag
+}
+
+// Set stores value under key, ttl 0 uses the group's TTL
+func (c *Client) Set(ctx context.Context, group, key string, value []byte, ttl time.Duration) error {
+	return c.SetWithOptions(ctx, group, key, value, ttl, SetOptions{})
+}
+
+// SetWithOptions is Set with flags, hot or pinned
+func (c *Client) SetWithOptions(ctx context.Context, group, key string, value []byte, ttl time.Duration, opts SetOptions) error {
+	defer c.invalidateNear(group, key)
+	return c.do(ctx, key, func(ctx context.Context, n *node) error {
+		_, err := n.api.Set(ctx, &cachepb.SetRequest{
+			Group:  group,
+			Key:    key,
+			Value:  value,
+			TtlMs:  ttl.Milliseconds(),
+			Flags:  opts.Flags,
+			Hot:    opts.Hot,
+			Pinned: opts.Pinned,
+			Tags:   opts.Tags,
+		})
+		return err
+	})
+}
+
+// Delete removes key and reports whether it was cached
+func (c *Client) Delete(ctx context.Context, group, key string) (bool, error) {
+	defer c.invalidateNear(group, key)
+	var deleted bool
+	err := c.do(ctx, key, func(ctx context.Context, n *node) error {
+		resp, err := n.api.Delete(ctx, &cachepb.DeleteRequest{Group: group, Key: key})
+		deleted = resp.GetDeleted()
+		return err
+	})
+	return deleted, err
+}
+
+// Touch gives a cached key a new TTL, 0 uses the group's TTL
+func (c *Client) Touch(ctx context.Context, group, key string, ttl time.Duration) error {
+	defer c.invalidateNear(group, key)
+	return c.do(ctx, key, func(ctx context.Context, n *node) error {
+		_, err := n.api.Touch(ctx, &cachepb.TouchRequest{Group: group, Key: key, TtlMs: ttl.Milliseconds()})
+		return err
+	})
+}
+
+// CompareAndSet stores value only if key still has the version read with
+// GetItem, and returns the new version. It fails with ErrorVersionMismatch
+// when the key was written since, and with ErrorNotFound when it is not
+// cached. Version 0 adds a key that is not cached, see Add.
+func (c *Client) CompareAndSet(ctx context.Context, group, key string, version uint64, value []byte, ttl time.Duration, flags uint32) (uint64, error) {
+	defer c.invalidateNear(group, key)
+	var stored uint64
+	err := c.do(ctx, key, func(ctx context.Context, n *node) error {
+		resp, err := n.api.CompareAndSet(ctx, &cachepb.CompareAndSetRequest{
+			Group:   group,
+			Key:     key,
+			Value:   value,
+			Version: version,
+			TtlMs:   ttl.Milliseconds(),
+			Flags:   flags,
+		})
+		stored = resp.GetVersion()
+		return err
+	})
+	return stored, err
+}
+
+// Add stores value only if key is not cached, failing with
+// ErrorVersionMismatch otherwise
+func (c *Client) Add(ctx context.Context, group, key string, value []byte, ttl time.Duration) (uint64, error) {
+	return c.CompareAndSet(ctx, group, key, 0, value, ttl, 0)
+}
+
+// Incr adds delta to the integer value of key on its owner and returns the
+// result. A key that is not cached is created with the value delta, expiring
+// after ttl, 0 for the group's TTL. A timeout retried on another node may
+// apply the delta twice.
+func (c *Client) Incr(ctx context.Context, group, key string, delta int64, ttl time.Duration) (int64, error) {
+	defer c.invalidateNear(group, key)
+	var n int64
+	err := c.do(ctx, key, func(ctx context.Context, nd *node) error {
+		resp, err := nd.api.Incr(ctx, &cachepb.IncrRequest{Group: group, Key: key, Delta: delta, TtlMs: ttl.Milliseconds()})
+		n = resp.GetValue()
+		return err
+	})
+	return n, err
+}
+
+// InvalidateTag drops the keys set with tag from every node and returns how
+// many cached entries were dropped
+func (c *Client) InvalidateTag(ctx context.Context, group, tag string) (int64, error) {
+	return c.invalidate(ctx, &cachepb.InvalidateRequest{Group: group, Tag: tag})
+}
+
+// InvalidatePrefix drops the keys starting with prefix from every node
+func (c *Client) InvalidatePrefix(ctx context.Context, group, prefix string) (int64, error) {
+	return c.invalidate(ctx, &cachepb.InvalidateRequest{Group: group, Prefix: prefix})
+}
+
+// invalidate asks any node to invalidate in, it fans out to the others. The
+// near cache is dropped for the group, the keys it held are not known.
+func (c *Client) invalidate(ctx context.Context, in *cachepb.InvalidateRequest) (int64, error) {
+	if c.near != nil {
+		defer c.near.purgeGroup(in.GetGroup())
+	}
+	var removed int64
+	err := c.do(ctx, in.GetTag()+in.GetPrefix(), func(ctx context.Context, n *node) error {
+		resp, err := n.api.Invalidate(ctx, in)
+		removed = resp.GetRemoved()
+		return err
+	})
+	return removed, err
+}
+
+// TTL returns the remaining lifetime of a cached key, 0 if unknown
+func (c *Client) TTL(ctx context.Context, group, key string) (time.Duration, error) {
+	var ttl time.Duration
+	err := c.do(ctx, key, func(ctx context.Context, n *node) error {
+		resp, err := n.api.TTL(ctx, &cachepb.TTLRequest{Group: group, Key: key})
+		ttl = time.Duration(resp.GetTtlMs()) * time.Millisecond
+		return err
+	})
+	return ttl, err
+}
+
+// MultiGet gets several keys of a group with one request per owning node,
+// sent in parallel. Missing keys are left out of the result.
+func (c *Client) MultiGet(ctx context.Context, group string, keys []string) (map[string][]byte, error) {
+	out := make(map[string][]byte, len(keys))
+	byOwner := make(map[string][]string)
+	for _, key := range keys {
+		if c.near != nil {
+			if item, ok := c.near.get(group, key); ok {
+				out[key] = item.Value
+				continue
+			}
+		}
+		owner := c.Owner(key)
+		byOwner[owner] = append(byOwner[owner], key)
+	}
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	for _, batch := range byOwner {
+		wg.Add(1)
+		go func(batch []string) {
+			defer wg.Done()
+			// Every key of the batch has the same owner, route by the first
+			var resp *cachepb.MultiGetResponse
+			err := c.do(ctx, batch[0], func(ctx context.Context, n *node) (err error) {
+				read := c.beginNear(n, group)
+				if resp, err = n.api.MultiGet(ctx, &cachepb.MultiGetRequest{Group: group, Keys: batch}); err != nil {
+					return err
+				}
+				for _, item := range resp.GetItems() {
+					if item.GetFound() {
+						c.storeNear(read, &Item{
+							Key:     item.GetKey(),
+							Value:   item.GetValue(),
+							Flags:   item.GetFlags(),
+							TTL:     time.Duration(item.GetTtlMs()) * time.Millisecond,
+							Version: item.GetVersion(),
+						})
+					}
+				}
+				return nil
+			})
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			for _, item := range resp.GetItems() {
+				if item.GetFound() {
+					out[item.GetKey()] = item.GetValue()
+				}
+			}
+		}(batch)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return out, nil
+}
+
+// Stats returns the statistics of a group, or of all groups if group is
+// empty, as seen by each node
+func (c *Client) Stats(ctx context.Context, group string) (map[string][]*cachepb.GroupStats, error) {
+	c.mu.RLock()
+	nodes := make(map[string]*node, len(c.nodes))
+	for name, n := range c.nodes {
+		nodes[name] = n
+	}
+	c.mu.RUnlock()
+	out := make(map[string][]*cachepb.GroupStats, len(nodes))
+	for name, n := range nodes {
+		attemptCtx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+		resp, err := n.api.Stats(attemptCtx, &cachepb.StatsRequest{Group: group})
+		cancel()
+		if err != nil {
+			return nil, errors.Wrapf(toError(err), "stats of %s", name)
+		}
+		out[name] = resp.GetGroups()
+	}
+	return out, nil
+}
+
+// Close stops following the membership and closes all connections
+func (c *Client) Close() error {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.mu.Lock()
+	c.resetNear()
+	for name, n := range c.nodes {
+		n.conn.Close()
+		delete(c.nodes, name)
+	}
+	c.mu.Unlock()
+	if c.ownEtcd {
+		return c.etcd.Close()
+	}
+	return nil
+}
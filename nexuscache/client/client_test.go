@@ -0,0 +1,223 @@
+package client
+
+import (
+	"NexusCache/api"
+	cachepb "NexusCache/cachepb/v1"
+	"NexusCache/connect"
+	"NexusCache/consistenthash"
+	"NexusCache/nexuscache"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeNode is a CacheService keeping values in a map and recording the keys
+// it was asked for
+type fakeNode struct {
+	cachepb.UnimplementedCacheServiceServer
+	mu     sync.Mutex
+	values map[string][]byte
+	seen   map[string]int
+}
+
+func (f *fakeNode) Get(ctx context.Context, in *cachepb.GetRequest) (*cachepb.GetResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seen[in.GetKey()]++
+	v, ok := f.values[in.GetKey()]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "not cached")
+	}
+	return &cachepb.GetResponse{Value: v}, nil
+}
+
+func (f *fakeNode) Set(ctx context.Context, in *cachepb.SetRequest) (*cachepb.SetResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seen[in.GetKey()]++
+	f.values[in.GetKey()] = in.GetValue()
+	return &cachepb.SetResponse{}, nil
+}
+
+func (f *fakeNode) MultiGet(ctx context.Context, in *cachepb.MultiGetRequest) (*cachepb.MultiGetResponse, error) {
+	out := &cachepb.MultiGetResponse{}
+	for _, key := range in.GetKeys() {
+		resp, err := f.Get(ctx, &cachepb.GetRequest{Group: in.GetGroup(), Key: key})
+		out.Items = append(out.Items, &cachepb.Item{Key: key, Found: err == nil, Value: resp.GetValue()})
+	}
+	return out, nil
+}
+
+func (f *fakeNode) count(key string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.seen[key]
+}
+
+func startFake(t *testing.T) (*fakeNode, *grpc.Server, string) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeNode{values: make(map[string][]byte), seen: make(map[string]int)}
+	srv := grpc.NewServer()
+	cachepb.RegisterCacheServiceServer(srv, f)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return f, srv, lis.Addr().String()
+}
+
+func TestRoutingAndFailover(t *testing.T) {
+	c, err := newClient(Config{Timeout: time.Second, RetryBackoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	// The servers' ring, built as in main.go
+	ring, _ := consistenthash.NewPlacement("ring", 50)
+	fakes := make(map[string]*fakeNode)
+	servers := make(map[string]*grpc.Server)
+	for _, name := range []string{"a", "b", "c"} {
+		f, srv, addr := startFake(t)
+		fakes[name], servers[name] = f, srv
+		c.setNode(name, connect.NodeInfo{Addr: addr, Weight: 1})
+		ring.AddWeightedNode(name, 1)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	keys := make([]string, 30)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+		if err := c.Set(ctx, "g", keys[i], []byte(keys[i]), 0); err != nil {
+			t.Fatalf("Set %s: %v", keys[i], err)
+		}
+		if owner := ring.Get(keys[i]); fakes[owner].count(keys[i]) != 1 {
+			t.Fatalf("%s should have been sent to its owner %s", keys[i], owner)
+		}
+	}
+	if _, err := c.Get(ctx, "g", "missing"); errors.Cause(err) != ErrorNotFound {
+		t.Fatalf("expected ErrorNotFound, got %v", err)
+	}
+	got, err := c.MultiGet(ctx, "g", append(keys, "missing"))
+	if err != nil || len(got) != len(keys) || string(got["key-7"]) != "key-7" {
+		t.Fatalf("MultiGet = %v, %v", got, err)
+	}
+
+	// Stop one node: its keys go to the node they move to once it leaves
+	servers["a"].Stop()
+	without := ring.Clone()
+	without.Remove("a")
+	var moved string
+	for _, key := range keys {
+		if ring.Get(key) == "a" {
+			moved = key
+			break
+		}
+	}
+	if moved == "" {
+		t.Fatal("no key owned by a")
+	}
+	if err := c.Set(ctx, "g", moved, []byte("again"), 0); err != nil {
+		t.Fatalf("Set should fail over, got %v", err)
+	}
+	if next := without.Get(moved); fakes[next].count(moved) != 1 {
+		t.Fatalf("%s should have failed over to %s", moved, next)
+	}
+	if owner := c.Owner(moved); owner == "a" {
+		t.Fatalf("a failed node should be routed around for a while")
+	}
+
+	// A node whose registration disappears leaves the ring
+	c.removeNode("b")
+	if nodes := c.Nodes(); len(nodes) != 2 || nodes[0] != "a" || nodes[1] != "c" {
+		t.Fatalf("unexpected nodes %v", nodes)
+	}
+}
+
+// localPeers makes every key owned by this node
+type localPeers struct{}
+
+func (localPeers) PickPeer(key string) (connect.PeerGetter, bool) { return nil, false }
+
+func TestNearCache(t *testing.T) {
+	g := nexuscache.NewGroup("client-near", 1<<20, 1<<20, nexuscache.GetterFunc(func(key string) ([]byte, error) {
+		return nil, nexuscache.ErrorNotFound
+	}))
+	g.RegisterPeers(localPeers{})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	cachepb.RegisterCacheServiceServer(srv, api.NewCacheService())
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	c, err := newClient(Config{NearCacheBytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.setNode("a", connect.NodeInfo{Addr: lis.Addr().String(), Weight: 1})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.Set(ctx, "client-near", "k", []byte("v1"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	// waitFor polls until cond holds, the subscription is set up asynchronously
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		for !cond() {
+			if ctx.Err() != nil {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor("the value to be cached near", func() bool {
+		c.Get(ctx, "client-near", "k")
+		_, ok := c.near.get("client-near", "k")
+		return ok
+	})
+	gets := g.Stats().Gets
+	if v, err := c.Get(ctx, "client-near", "k"); err != nil || string(v) != "v1" || g.Stats().Gets != gets {
+		t.Fatalf("Get should be served near, got %q %v", v, err)
+	}
+
+	// A write by another client reaches the near cache as an invalidation
+	if err := g.Set("k", nexuscache.NewByteView([]byte("v2"), time.Now().Add(time.Minute)), false, false); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("the invalidation", func() bool {
+		v, err := c.Get(ctx, "client-near", "k")
+		return err == nil && string(v) == "v2"
+	})
+	g.Delete("k")
+	waitFor("the delete", func() bool {
+		_, err := c.Get(ctx, "client-near", "k")
+		return errors.Cause(err) == ErrorNotFound
+	})
+
+	// Losing the subscription drops what was read from the node
+	c.Set(ctx, "client-near", "k", []byte("v3"), time.Minute)
+	waitFor("the value to be cached near", func() bool {
+		c.Get(ctx, "client-near", "k")
+		_, ok := c.near.get("client-near", "k")
+		return ok
+	})
+	srv.Stop()
+	waitFor("the near cache to be purged", func() bool {
+		_, ok := c.near.get("client-near", "k")
+		return !ok
+	})
+}
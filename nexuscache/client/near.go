@@ -0,0 +1,211 @@
+package client
+
+import (
+	cachepb "NexusCache/cachepb/v1"
+	"NexusCache/lru"
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// defaultNearCacheTTL bounds how long a value is served from the near cache
+const defaultNearCacheTTL = time.Minute
+
+// maxResubscribeBackoff caps the wait between attempts to resubscribe
+const maxResubscribeBackoff = 5 * time.Second
+
+// nearValue is a value kept in the near cache
+type nearValue struct {
+	item   Item
+	group  string
+	node   string    // Node the value was read from, its invalidations cover it
+	expire time.Time // When the value leaves the near cache
+	ttlEnd time.Time // When the value expires on the node, zero if unknown
+}
+
+func (v *nearValue) Len() int {
+	return len(v.item.Value)
+}
+
+// subKey identifies the invalidations of a group on a node
+type subKey struct {
+	node  string
+	group string
+}
+
+// subscription follows the invalidations of a group on a node
+type subscription struct {
+	ready  bool   // The node confirmed the subscription
+	epoch  uint64 // Bumped on every invalidation, see nearCache.begin
+	cancel context.CancelFunc
+}
+
+// nearRead is a read whose value may be cached, see nearCache.begin
+type nearRead struct {
+	key   subKey
+	sub   *subscription
+	epoch uint64
+}
+
+// nearCache keeps values read by this process. A value is only cached while
+// the subscription to the invalidations of the node it was read from is up,
+// and is dropped when that node reports the key set or deleted, when the
+// subscription breaks and when the membership changes.
+type nearCache struct {
+	mu   sync.Mutex
+	lru  *lru.Cache
+	ttl  time.Duration
+	subs map[subKey]*subscription
+}
+
+func newNearCache(maxBytes int64, ttl time.Duration) *nearCache {
+	if ttl <= 0 {
+		ttl = defaultNearCacheTTL
+	}
+	l := lru.New(maxBytes, nil)
+	l.ExpireRandom = 0
+	return &nearCache{lru: l, ttl: ttl, subs: make(map[subKey]*subscription)}
+}
+
+func nearKey(group, key string) string {
+	return group + "\x00" + key
+}
+
+// get returns the cached item of key, with its TTL counted down
+func (nc *nearCache) get(group, key string) (*Item, bool) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	v, ok := nc.lru.Get(nearKey(group, key))
+	if !ok {
+		return nil, false
+	}
+	value := v.(*nearValue)
+	now := time.Now()
+	if now.After(value.expire) {
+		nc.lru.Remove(nearKey(group, key))
+		return nil, false
+	}
+	item := value.item
+	if !value.ttlEnd.IsZero() {
+		item.TTL = value.ttlEnd.Sub(now)
+	}
+	return &item, true
+}
+
+// begin subscribes to the invalidations of group on n if needed, before a
+// value is read from n
+func (nc *nearCache) begin(n *node, group string) nearRead {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	key := subKey{n.name, group}
+	sub, ok := nc.subs[key]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		sub = &subscription{cancel: cancel}
+		nc.subs[key] = sub
+		go nc.follow(ctx, key, sub, n.api)
+	}
+	return nearRead{key: key, sub: sub, epoch: sub.epoch}
+}
+
+// store caches an item of read unless the subscription was not confirmed yet,
+// was replaced or reported any key since begin, in which case the item may be
+// older than an invalidation already applied
+func (nc *nearCache) store(read nearRead, item *Item) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	if nc.subs[read.key] != read.sub || !read.sub.ready || read.sub.epoch != read.epoch {
+		return
+	}
+	now := time.Now()
+	value := &nearValue{item: *item, group: read.key.group, node: read.key.node, expire: now.Add(nc.ttl)}
+	if item.TTL > 0 {
+		value.ttlEnd = now.Add(item.TTL)
+		if value.ttlEnd.Before(value.expire) {
+			value.expire = value.ttlEnd
+		}
+	}
+	nc.lru.Add(nearKey(read.key.group, item.Key), value, value.expire)
+}
+
+// invalidate drops keys of group
+func (nc *nearCache) invalidate(group string, keys ...string) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	for _, key := range keys {
+		nc.lru.Remove(nearKey(group, key))
+	}
+}
+
+// purgeGroup drops the values of group
+func (nc *nearCache) purgeGroup(group string) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	nc.purgeLocked(func(v *nearValue) bool { return v.group == group })
+}
+
+// follow receives the invalidations of a subscription until ctx is done,
+// resubscribing after failures
+func (nc *nearCache) follow(ctx context.Context, key subKey, sub *subscription, api cachepb.CacheServiceClient) {
+	backoff := defaultRetryBackoff
+	for ctx.Err() == nil {
+		stream, err := api.Invalidations(ctx, &cachepb.InvalidationsRequest{Group: key.group})
+		for err == nil {
+			var msg *cachepb.Invalidation
+			if msg, err = stream.Recv(); err != nil {
+				break
+			}
+			nc.mu.Lock()
+			sub.ready = true
+			sub.epoch++
+			for _, k := range msg.GetKeys() {
+				nc.lru.Remove(nearKey(key.group, k))
+			}
+			if msg.GetFlush() {
+				nc.purgeLocked(func(v *nearValue) bool { return v.node == key.node && v.group == key.group })
+			}
+			nc.mu.Unlock()
+			backoff = defaultRetryBackoff
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("client: invalidations of %s on %s: %v", key.group, key.node, err)
+		nc.mu.Lock()
+		sub.ready = false
+		sub.epoch++
+		nc.purgeLocked(func(v *nearValue) bool { return v.node == key.node && v.group == key.group })
+		nc.mu.Unlock()
+		select {
+		case <-time.After(backoff):
+			backoff = min(2*backoff, maxResubscribeBackoff)
+		case <-ctx.Done():
+		}
+	}
+}
+
+// purgeLocked drops the values for which match returns true
+func (nc *nearCache) purgeLocked(match func(v *nearValue) bool) {
+	var keys []string
+	nc.lru.Range(func(key string, value lru.Value, expire time.Time, pinned bool) bool {
+		if match(value.(*nearValue)) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	for _, key := range keys {
+		nc.lru.Remove(key)
+	}
+}
+
+// reset drops every value and subscription, used when keys change owners
+func (nc *nearCache) reset() {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	for key, sub := range nc.subs {
+		sub.cancel()
+		delete(nc.subs, key)
+	}
+	nc.purgeLocked(func(*nearValue) bool { return true })
+}
@@ -0,0 +1,38 @@
+package nexuscache
+
+import (
+	"context"
+)
+
+// Drain takes this node out of the cluster without dropping its cache:
+//  1. deregister from etcd, so peers watching the registration stop routing here
+//  2. take itself off its own ring and hand the entries it owned over to
+//     their successors
+//  3. wait for in-flight RPCs to finish and stop the gRPC server
+//
+// If ctx expires before the in-flight RPCs finish, the server is stopped hard.
+func (s *Server) Drain(ctx context.Context) error {
+	s.Log("draining")
+	s.mu.Lock()
+	cancel := s.watchCancel
+	s.watchCancel = nil
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	if s.etcd != nil {
+		if err := s.etcd.Deregister(ctx); err != nil {
+			s.Log("drain: deregister failed: %v", err)
+		}
+	}
+
+	// Requests still coming in are sent on to the successors from now on
+	s.peersMu.Lock()
+	old := s.peers.Clone()
+	s.peers.Remove(s.selfNode())
+	next := s.peers.Clone()
+	s.peersMu.Unlock()
+	s.rebalance(old, next)
+
+	return s.Shutdown(ctx)
+}
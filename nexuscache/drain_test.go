@@ -0,0 +1,72 @@
+package nexuscache
+
+import (
+	"NexusCache/connect"
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	g := NewGroup("drain", 1<<20, 0, GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrorNotFound
+	}))
+	remote, addr := startRecordingPeer(t)
+	s := NewServer("svc1", "127.0.0.1:8001", nil)
+	s.SetListenAddr("127.0.0.1:0")
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s.addPeer("svc1", connect.NodeInfo{Addr: s.Addr(), Weight: 1})
+	s.addPeer("svc2", connect.NodeInfo{Addr: addr, Weight: 1})
+	g.RegisterPeers(s)
+
+	expire := time.Now().Add(time.Hour)
+	var owned []string
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		if s.peers.Get(key) == "svc1" {
+			g.mainCache.add(key, NewByteView([]byte("v"), expire), false)
+			owned = append(owned, key)
+		}
+	}
+	if len(owned) == 0 {
+		t.Fatalf("expected svc1 to own some keys")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.peers.Distribution()["svc1"]; ok {
+		t.Fatalf("the drained node should be off the ring")
+	}
+	for _, key := range owned {
+		if _, ok := s.PickPeer(key); !ok {
+			t.Fatalf("%s should be routed to the remaining node", key)
+		}
+		if _, ok := g.mainCache.get(key); ok {
+			t.Fatalf("%s should have been handed over", key)
+		}
+	}
+	var migrated []string
+	remote.mu.Lock()
+	for _, e := range remote.migrated {
+		if e.GetGroup() == "drain" {
+			migrated = append(migrated, e.GetKey())
+		}
+	}
+	remote.mu.Unlock()
+	sort.Strings(migrated)
+	sort.Strings(owned)
+	if !reflect.DeepEqual(migrated, owned) {
+		t.Fatalf("expected %v on the remaining node, got %v", owned, migrated)
+	}
+	if s.Running() || s.Addr() != "" {
+		t.Fatalf("the drained node should be shut down")
+	}
+}
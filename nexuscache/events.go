@@ -0,0 +1,233 @@
+package nexuscache
+
+import (
+	"NexusCache/lru"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrorWatcherBehind ends a watch whose buffer filled up. The watcher may
+// resume after the last event it received.
+var ErrorWatcherBehind = errors.New("nexuscache: watcher fell behind")
+
+// ErrorEventsCompacted is returned when resuming after an event that is no
+// longer kept in the history
+var ErrorEventsCompacted = errors.New("nexuscache: events to resume from are no longer kept")
+
+// DefaultEventHistory is how many events a node keeps for watchers to resume
+const DefaultEventHistory = 4096
+
+// EventType tells what happened to a key
+type EventType int
+
+const (
+	EventSet    EventType = iota + 1 // Set on this node
+	EventDelete                      // Deleted on this node, whether it was cached or not
+	EventExpire                      // Dropped after its TTL passed, noticed lazily
+	EventEvict                       // Dropped under memory pressure
+	EventFlush                       // Every key of the group dropped, Key is empty
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventSet:
+		return "set"
+	case EventDelete:
+		return "delete"
+	case EventExpire:
+		return "expire"
+	case EventEvict:
+		return "evict"
+	case EventFlush:
+		return "flush"
+	}
+	return "unknown"
+}
+
+// Event is a change of a key on this node. Seq numbers the events of all
+// groups of the node, starting at 1 in every EventEpoch.
+type Event struct {
+	Seq   uint64
+	Type  EventType
+	Group string
+	Key   string
+	Value *ByteView // The value set, nil for other events
+	Time  time.Time
+}
+
+// Watcher receives the events of the keys it watches, see Group.Watch
+type Watcher struct {
+	// C receives the events in order. It is closed by Close, or when the
+	// watcher fell behind, see Err.
+	C <-chan Event
+	c chan Event
+
+	group  string
+	key    string
+	prefix bool
+	err    error
+}
+
+func (w *Watcher) matches(e *Event) bool {
+	if e.Group != w.group {
+		return false
+	}
+	if e.Type == EventFlush {
+		return true
+	}
+	if w.prefix {
+		return strings.HasPrefix(e.Key, w.key)
+	}
+	return e.Key == w.key
+}
+
+// eventLog numbers the events of the node, keeps the latest for watchers to
+// resume from and fans them out to the watchers
+type eventLog struct {
+	mu       sync.Mutex
+	seq      uint64
+	history  []Event // Ring of the latest events, oldest at start
+	start    int
+	size     int
+	watchers map[*Watcher]struct{}
+}
+
+var events = &eventLog{history: make([]Event, DefaultEventHistory), watchers: make(map[*Watcher]struct{})}
+
+// SetEventHistory sets how many events are kept for watchers to resume,
+// dropping the history
+func SetEventHistory(n int) {
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	events.history = make([]Event, max(n, 1))
+	events.start, events.size = 0, 0
+}
+
+// eventEpoch tells the event sequences of different runs of the node apart
+var eventEpoch = uint64(time.Now().UnixNano())
+
+// EventEpoch identifies the sequence of events of this run of the node.
+// Sequence numbers of another epoch can't be resumed from.
+func EventEpoch() uint64 {
+	return eventEpoch
+}
+
+// LastEventSeq returns the sequence number of the latest event of the node
+func LastEventSeq() uint64 {
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	return events.seq
+}
+
+// Watch returns a watcher of key, or of every key starting with key if prefix
+// is true. With after > 0 it first receives the kept events following the
+// event numbered after, or fails with ErrorEventsCompacted if some are gone.
+// Up to buffer events wait for the receiver; a watcher that lets the buffer
+// fill up is dropped with ErrorWatcherBehind rather than slowing down writes.
+func (g *Group) Watch(key string, prefix bool, after uint64, buffer int) (*Watcher, error) {
+	l := events
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w := &Watcher{group: g.name, key: key, prefix: prefix}
+	var backlog []Event
+	if after > 0 {
+		oldest := l.seq - uint64(l.size) + 1
+		if after > l.seq || after+1 < oldest {
+			return nil, ErrorEventsCompacted
+		}
+		for i := 0; i < l.size; i++ {
+			e := &l.history[(l.start+i)%len(l.history)]
+			if e.Seq > after && w.matches(e) {
+				backlog = append(backlog, *e)
+			}
+		}
+	}
+	c := make(chan Event, len(backlog)+max(buffer, 1))
+	for _, e := range backlog {
+		c <- e
+	}
+	w.C, w.c = c, c
+	l.watchers[w] = struct{}{}
+	return w, nil
+}
+
+// Close ends the watch and closes C
+func (w *Watcher) Close() {
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	events.dropLocked(w, nil)
+}
+
+// Err returns why C was closed: nil after Close, ErrorWatcherBehind when the
+// watcher fell behind
+func (w *Watcher) Err() error {
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	return w.err
+}
+
+func (l *eventLog) dropLocked(w *Watcher, err error) {
+	if _, ok := l.watchers[w]; ok {
+		delete(l.watchers, w)
+		w.err = err
+		close(w.c)
+	}
+}
+
+// publish numbers e, keeps it in the history and hands it to the watchers
+func (l *eventLog) publish(e Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+	e.Seq = l.seq
+	if l.size < len(l.history) {
+		l.history[(l.start+l.size)%len(l.history)] = e
+		l.size++
+	} else {
+		l.history[l.start] = e
+		l.start = (l.start + 1) % len(l.history)
+	}
+	for w := range l.watchers {
+		if !w.matches(&e) {
+			continue
+		}
+		select {
+		case w.c <- e:
+		default:
+			l.dropLocked(w, ErrorWatcherBehind)
+		}
+	}
+}
+
+// publishChange records that key was set to value, or deleted if value is nil
+func (g *Group) publishChange(key string, value *ByteView) {
+	e := Event{Type: EventSet, Group: g.name, Key: key, Value: value, Time: time.Now()}
+	if value == nil {
+		e.Type = EventDelete
+	}
+	events.publish(e)
+}
+
+// publishFlush records that every key of the group was dropped
+func (g *Group) publishFlush() {
+	events.publish(Event{Type: EventFlush, Group: g.name, Time: time.Now()})
+}
+
+// publishEviction records entries dropped by the caches. Removals are left
+// out: deletes are recorded by publishChange, and keys handed off to their new
+// owner don't change.
+func (g *Group) publishEviction(key string, reason lru.EvictReason) {
+	e := Event{Group: g.name, Key: key, Time: time.Now()}
+	switch reason {
+	case lru.EvictExpired:
+		e.Type = EventExpire
+	case lru.EvictCapacity:
+		e.Type = EventEvict
+	default:
+		return
+	}
+	events.publish(e)
+}
@@ -0,0 +1,28 @@
+package nexuscache
+
+import (
+	"NexusCache/connect"
+	"log"
+)
+
+// Flush drops every key of the group from every node, hot copies included.
+// Each node starts a new generation of its caches, so the old entries are
+// invisible at once without walking them, and are reclaimed as they are found
+// or evicted. Watchers get an EventFlush. Like the invalidations, it leaves
+// the backend of a group with a writer untouched; when some nodes can't be
+// reached the others are still flushed and the error names the first that
+// failed.
+func (g *Group) Flush() error {
+	g.flushOwned()
+	return g.forEachPeer(func(peer connect.PeerGetter) error {
+		return peer.Flush(g.name)
+	})
+}
+
+// flushOwned is Flush for a peer fanning it out: it flushes this node only
+func (g *Group) flushOwned() {
+	g.mainCache.flush()
+	g.hotCache.flush()
+	g.publishFlush()
+	log.Printf("nexuscache: flushed group %s", g.name)
+}
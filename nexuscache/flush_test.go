@@ -0,0 +1,60 @@
+package nexuscache
+
+import (
+	"NexusCache/connect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// flushingPeer records the groups it is asked to flush
+type flushingPeer struct {
+	connect.PeerGetter
+	calls *[]string
+}
+
+func (p flushingPeer) Flush(group string) error {
+	*p.calls = append(*p.calls, group)
+	return nil
+}
+
+func TestFlush(t *testing.T) {
+	g := NewGroup("flush", 1<<20, 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrorNotFound
+	}))
+	var calls []string
+	g.RegisterPeers(listedPeers{map[string]connect.PeerGetter{"b": flushingPeer{calls: &calls}}})
+	expire := time.Now().Add(time.Minute)
+	g.Set("a", NewByteView([]byte("a"), expire).WithTags("t"), false, false)
+	g.Set("b", NewByteView([]byte("b"), expire), true, false)
+
+	w, err := g.Watch("", true, LastEventSeq(), 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := g.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 1 || calls[0] != "flush" {
+		t.Fatalf("unexpected peer calls %v", calls)
+	}
+	for _, key := range []string{"a", "b"} {
+		if _, err := g.Peek(key); errors.Cause(err) != ErrorNotFound {
+			t.Fatalf("%s should be flushed, got %v", key, err)
+		}
+	}
+	if e := <-w.C; e.Type != EventFlush || e.Group != "flush" {
+		t.Fatalf("expected a flush event, got %v", e)
+	}
+	if removed, _ := g.invalidateOwned("t", ""); removed != 0 {
+		t.Fatalf("flushed entries should not be invalidated again, removed %d", removed)
+	}
+
+	// Keys set after the flush are visible again
+	g.Set("a", NewByteView([]byte("a2"), expire), false, false)
+	if view, err := g.Peek("a"); err != nil || view.String() != "a2" {
+		t.Fatalf("Peek after the flush = %v, %v", view, err)
+	}
+}
@@ -2,18 +2,34 @@ package nexuscache
 
 import (
 	"NexusCache/connect"
+	"NexusCache/lru"
 	"NexusCache/metrics"
-	"golang.org/x/sync/singleflight"
+	pb "NexusCache/nexuscachepb"
+	"context"
 	"fmt"
+	"golang.org/x/sync/singleflight"
 	"log"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 var DefaultExpireTime = 30 * time.Second // Short expiration time for testing
 
+// ErrorNotFound is returned for keys that are neither cached nor found in the
+// origin. Getters should wrap it for missing keys, peers report it as the
+// gRPC NotFound status.
+var ErrorNotFound = errors.New("nexuscache: key not found")
+
+// ErrorLoadRateLimited is returned when a miss would exceed the group's origin load rate limit
+var ErrorLoadRateLimited = errors.New("nexuscache: origin load rate limit exceeded")
+
 // Group is the core data structure of NexusCache, responsible for user interaction
 // and controlling the cache storage and retrieval process.
 type Group struct {
@@ -25,8 +41,22 @@ type Group struct {
 	// use singleflight.Group to make sure that
 	// each key is only fetched once
 	loader *singleflight.Group // Controls concurrent request deduplication
+	ttl    atomic.Int64        // TTL of values loaded from the getter, DefaultExpireTime if 0
+
+	limiter atomic.Pointer[rate.Limiter] // Limits loads from the getter, nil if unlimited
+	writer  atomic.Pointer[writer]       // Writes set values to the backend, nil if Set only caches
+	writes  keyLocks                     // Serializes the writes of each key, apart from loads
+	stats   groupStats
+
+	listenersMu sync.RWMutex
+	listeners   []EvictionListener // Called whenever an entry leaves mainCache or hotCache
 }
 
+// EvictionListener is notified when an entry leaves the cache, with the
+// reason it was dropped (capacity, TTL expiry or explicit removal).
+// Listeners run outside the cache lock and may call back into the Group.
+type EvictionListener func(key string, value *ByteView, reason lru.EvictReason)
+
 var (
 	mu     sync.RWMutex
 	groups = make(map[string]*Group) // Global variable that records all created groups
@@ -41,10 +71,12 @@ func NewGroup(name string, cacheBytes int64, hotcacheBytes int64, getter Getter)
 	g := &Group{
 		name:      name,
 		getter:    getter,
-		mainCache: cache{cacheBytes: cacheBytes},
-		hotCache:  cache{cacheBytes: hotcacheBytes},
+		mainCache: cache{cacheBytes: cacheBytes, cacheType: "main"},
+		hotCache:  cache{cacheBytes: hotcacheBytes, cacheType: "hot"},
 		loader:    &singleflight.Group{},
 	}
+	g.mainCache.onEvicted = g.notifyEvicted
+	g.hotCache.onEvicted = g.notifyEvicted
 	groups[name] = g
 	return g
 }
@@ -56,6 +88,159 @@ func (g *Group) RegisterPeers(peers connect.PeerPicker) {
 	g.peers = peers
 }
 
+// forEachPeer calls fn for every other node in parallel, when the registered
+// picker knows them, and returns the first error naming its node
+func (g *Group) forEachPeer(fn func(peer connect.PeerGetter) error) error {
+	lister, ok := g.peers.(connect.PeerLister)
+	if !ok {
+		return nil
+	}
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	for name, peer := range lister.AllPeers() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(peer); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = errors.Wrapf(err, "node %s", name)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// AddEvictionListener registers fn to be called for every evicted entry
+func (g *Group) AddEvictionListener(fn EvictionListener) {
+	g.listenersMu.Lock()
+	defer g.listenersMu.Unlock()
+	g.listeners = append(g.listeners, fn)
+}
+
+func (g *Group) notifyEvicted(key string, value *ByteView, reason lru.EvictReason) {
+	g.publishEviction(key, reason)
+	g.listenersMu.RLock()
+	listeners := g.listeners
+	g.listenersMu.RUnlock()
+	for _, fn := range listeners {
+		fn(key, value, reason)
+	}
+}
+
+// SetPinnedBytes sets the budget for pinned entries in the main cache.
+// Pinned entries are charged against this budget instead of cacheBytes.
+func (g *Group) SetPinnedBytes(n int64) {
+	g.mainCache.setPinnedBytes(n)
+}
+
+// SetTTL sets how long values loaded from the getter stay cached,
+// a non-positive ttl restores DefaultExpireTime
+func (g *Group) SetTTL(ttl time.Duration) {
+	if ttl < 0 {
+		ttl = 0
+	}
+	g.ttl.Store(int64(ttl))
+}
+
+// TTL returns how long values loaded from the getter stay cached
+func (g *Group) TTL() time.Duration {
+	if ttl := time.Duration(g.ttl.Load()); ttl > 0 {
+		return ttl
+	}
+	return DefaultExpireTime
+}
+
+// SetCacheBytes resizes the main and hot caches, evicting entries that no longer fit
+func (g *Group) SetCacheBytes(cacheBytes, hotCacheBytes int64) {
+	g.mainCache.setCacheBytes(cacheBytes)
+	g.hotCache.setCacheBytes(hotCacheBytes)
+}
+
+// SetExpireJitter sets the upper bound of the random jitter added to the
+// expiry of cached values, which spreads out reloads of keys cached together
+func (g *Group) SetExpireJitter(d time.Duration) {
+	g.mainCache.setExpireJitter(d)
+	g.hotCache.setExpireJitter(d)
+}
+
+// SetLoadRateLimit caps loads from the getter at limit per second with the
+// given burst. Misses beyond the limit fail with ErrorLoadRateLimited instead
+// of hitting the origin. A non-positive limit removes the cap.
+func (g *Group) SetLoadRateLimit(limit float64, burst int) {
+	if limit <= 0 {
+		g.limiter.Store(nil)
+		return
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	if l := g.limiter.Load(); l != nil {
+		l.SetLimit(rate.Limit(limit))
+		l.SetBurst(burst)
+		return
+	}
+	g.limiter.Store(rate.NewLimiter(rate.Limit(limit), burst))
+}
+
+// SetWriteThrough makes Set write values to s before caching them. A failed
+// write fails the Set and leaves the cache untouched.
+func (g *Group) SetWriteThrough(s Setter) {
+	g.swapWriter(&writer{setter: s, mode: WriteThrough, group: g.name})
+}
+
+// SetWriteBehind makes Set cache values right away and queue them for s.
+// Queued writes are batched, coalesced per key and retried in the background;
+// Set fails with ErrorWriteQueueFull when the queue is full.
+func (g *Group) SetWriteBehind(s Setter, opts WriteBehindOptions) {
+	g.swapWriter(newWriteBehind(g.name, s, opts))
+}
+
+func (g *Group) swapWriter(w *writer) {
+	if old := g.writer.Swap(w); old != nil {
+		old.close(context.Background())
+	}
+}
+
+// CloseWriter stops writing values to the backend and waits until the queued
+// writes got there or ctx is done. Later Sets fail with ErrorWriterClosed.
+func (g *Group) CloseWriter(ctx context.Context) error {
+	if w := g.writer.Load(); w != nil {
+		return w.close(ctx)
+	}
+	return nil
+}
+
+// CloseWriters calls CloseWriter on every group, e.g. on shutdown
+func CloseWriters(ctx context.Context) error {
+	var firstErr error
+	for _, g := range Groups() {
+		if err := g.CloseWriter(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// writeBack hands a value set in the group to the backend, if there is one
+func (g *Group) writeBack(key string, value *ByteView) error {
+	if w := g.writer.Load(); w != nil {
+		return w.write(key, value.ByteSlice())
+	}
+	return nil
+}
+
+// Name returns the name of the group
+func (g *Group) Name() string {
+	return g.name
+}
+
 func GetGroup(name string) *Group {
 	mu.RLock()
 	g := groups[name]
@@ -63,24 +248,61 @@ func GetGroup(name string) *Group {
 	return g
 }
 
+// Groups returns every group created on this node, sorted by name
+func Groups() []*Group {
+	mu.RLock()
+	out := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		out = append(out, g)
+	}
+	mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out
+}
+
 func (g *Group) Get(key string) (*ByteView, error) {
 	start := time.Now()
 	defer func() {
 		metrics.RecordRequestDuration("get", time.Since(start).Seconds())
 	}()
 
+	if v, ok, err := g.getCached(key); ok || err != nil {
+		return v, err
+	}
+	return g.Load(key)
+}
+
+// getCached looks key up in this node's caches, counting the hit or miss
+func (g *Group) getCached(key string) (*ByteView, bool, error) {
+	g.stats.gets.Add(1)
 	if key == "" {
 		metrics.RecordCacheError("get")
-		return &ByteView{}, fmt.Errorf("nexuscache: key is empty")
+		return &ByteView{}, false, fmt.Errorf("nexuscache: key is empty")
 	}
 	if v, ok := g.lookupCache(key); ok {
-		log.Println("NexusCache hit")
+		debugf("NexusCache hit")
 		metrics.RecordCacheHit("get")
-		return v, nil
+		g.stats.hits.Add(1)
+		return v, true, nil
 	}
-	log.Println("NexusCache miss, try to add it")
+	debugf("NexusCache miss, try to add it")
 	metrics.RecordCacheMiss("get")
-	return g.Load(key)
+	return nil, false, nil
+}
+
+// getOwned gets key for a peer that picked this node as the owner: unlike
+// Get it never forwards to another peer, even when the rings disagree
+func (g *Group) getOwned(key string) (*ByteView, error) {
+	if v, ok, err := g.getCached(key); ok || err != nil {
+		return v, err
+	}
+	view, err, _ := g.loader.Do(key, func() (interface{}, error) {
+		return g.getLocally(key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return view.(*ByteView), nil
 }
 
 // Load fetches the key from a remote peer or local database if cache miss.
@@ -89,8 +311,8 @@ func (g *Group) Load(key string) (value *ByteView, err error) {
 	// Wrap the actual load operation with DoOnce to ensure concurrent safety
 	view, err, _ := g.loader.Do(key, func() (interface{}, error) {
 		if g.peers != nil {
-			log.Println("try to search from peers")
-			if peer, ok := g.peers.PickPeer(key); ok {
+			debugf("try to search from peers")
+			if peer, ok := g.pickLoadPeer(key); ok {
 				if value, err = g.getFromPeer(peer, key); err != nil {
 					log.Println("nexuscache: get from peer error:", err)
 					return nil, err
@@ -106,29 +328,137 @@ func (g *Group) Load(key string) (value *ByteView, err error) {
 	return
 }
 
+// pickLoadPeer returns the node to load key from, which with bounded loads
+// may be another than the owner
+func (g *Group) pickLoadPeer(key string) (connect.PeerGetter, bool) {
+	if p, ok := g.peers.(connect.LoadPeerPicker); ok {
+		return p.PickLoadPeer(key)
+	}
+	return g.peers.PickPeer(key)
+}
+
 func (g *Group) getFromPeer(peer connect.PeerGetter, key string) (*ByteView, error) {
-	bytes, err := peer.Get(g.name, key)
+	resp, err := peer.Get(g.name, key)
 	if err != nil {
-		return nil, err
+		return nil, fromPeerError(err)
 	}
-	return &ByteView{b: bytes}, nil
+	g.stats.peerLoads.Add(1)
+	return fromPeerResponse(resp), nil
+}
+
+// fromPeerResponse returns the value a peer answered with, expiring after its TTL
+func fromPeerResponse(resp *pb.GetResponse) *ByteView {
+	value := &ByteView{b: resp.GetValue(), flags: resp.GetFlags(), tags: resp.GetTags(), version: resp.GetVersion()}
+	if resp.GetTtlMs() != 0 {
+		value.e = time.Now().Add(time.Duration(resp.GetTtlMs()) * time.Millisecond)
+	}
+	return value
+}
+
+// fromPeerError turns the NotFound status of a peer back into ErrorNotFound
+func fromPeerError(err error) error {
+	if status.Code(err) == codes.NotFound {
+		return errors.Wrap(ErrorNotFound, err.Error())
+	}
+	return err
+}
+
+// Peek returns the cached value of key with its remaining lifetime as expiry,
+// asking the owner when another node owns the key. Unlike Get it never loads
+// from the origin: keys that are not cached fail with ErrorNotFound.
+func (g *Group) Peek(key string) (*ByteView, error) {
+	if value, err := g.peekOwned(key); err == nil {
+		return value, nil
+	}
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(key); ok {
+			resp, err := peer.Peek(g.name, key)
+			if err != nil {
+				return nil, fromPeerError(err)
+			}
+			return fromPeerResponse(resp), nil
+		}
+	}
+	return nil, ErrorNotFound
+}
+
+// peekOwned is Peek for a peer that picked this node as the owner
+func (g *Group) peekOwned(key string) (*ByteView, error) {
+	if value, ok := g.mainCache.peek(key); ok {
+		return value, nil
+	}
+	if value, ok := g.hotCache.peek(key); ok {
+		return value, nil
+	}
+	return nil, ErrorNotFound
+}
+
+// Touch gives a cached key a new expiry, keeping its value and flags, and
+// reports whether it was cached. Like Set it writes the value back to the
+// backend when the group has a writer.
+func (g *Group) Touch(key string, expire time.Time) (bool, error) {
+	value, err := g.Peek(key)
+	if errors.Cause(err) == ErrorNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, g.Set(key, NewByteViewFlags(value.b, expire, value.flags).WithTags(value.tags...), false, false)
+}
+
+// Delete drops key from the node owning it and from this node's hot cache,
+// reporting whether it was cached
+func (g *Group) Delete(key string) (bool, error) {
+	if key == "" {
+		return false, errors.New("key is empty")
+	}
+	deleted := g.hotCache.remove(key)
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(key); ok {
+			remote, err := peer.Delete(g.name, key)
+			if err != nil {
+				return deleted, fromPeerError(err)
+			}
+			return remote || deleted, nil
+		}
+	}
+	owned, err := g.deleteOwned(key)
+	return owned || deleted, err
+}
+
+// deleteOwned is Delete for a peer that picked this node as the owner
+func (g *Group) deleteOwned(key string) (bool, error) {
+	if key == "" {
+		return false, errors.New("key is empty")
+	}
+	deleted := g.hotCache.remove(key)
+	deleted = g.mainCache.remove(key) || deleted
+	g.publishChange(key, nil)
+	return deleted, nil
 }
 
 // getLocally fetches data from the database and adds it to the cache
 func (g *Group) getLocally(key string) (*ByteView, error) {
+	if l := g.limiter.Load(); l != nil && !l.Allow() {
+		metrics.RecordCacheError("load")
+		return &ByteView{}, ErrorLoadRateLimited
+	}
 	// Call the getter function stored when creating the Group
+	g.stats.loads.Add(1)
 	bytes, err := g.getter.Get(key)
 	if err != nil {
 		return &ByteView{}, err
 	}
-	value := &ByteView{b: cloneBytes(bytes), e: time.Now().Add(DefaultExpireTime)}
-	g.populateCache(key, value)
-	return value, nil
+	value := &ByteView{b: cloneBytes(bytes), e: time.Now().Add(g.TTL())}
+	return g.populateCache(key, value), nil
 }
 
-// populateCache adds the source data to the mainCache
-func (g *Group) populateCache(key string, value *ByteView) {
-	g.mainCache.add(key, value)
+// populateCache adds the source data to the mainCache and returns it with
+// the version it was stored with. A value written while it was loaded wins
+// over the loaded one, which may predate the write.
+func (g *Group) populateCache(key string, value *ByteView) *ByteView {
+	return g.mainCache.fill(key, value)
 }
 
 func (g *Group) lookupCache(key string) (value *ByteView, ok bool) {
@@ -140,7 +470,9 @@ func (g *Group) lookupCache(key string) (value *ByteView, ok bool) {
 	return
 }
 
-func (g *Group) Set(key string, value *ByteView, ishot bool) error {
+// Set stores the value on the node owning the key. Pinned values are never
+// evicted by LRU pressure but still expire, see lru.Cache.AddPinned.
+func (g *Group) Set(key string, value *ByteView, ishot bool, pinned bool) error {
 	start := time.Now()
 	defer func() {
 		metrics.RecordRequestDuration("set", time.Since(start).Seconds())
@@ -151,37 +483,59 @@ func (g *Group) Set(key string, value *ByteView, ishot bool) error {
 		return errors.New("key is empty")
 	}
 	if ishot {
-		return g.setHotCache(key, value)
+		return g.setHotCache(key, value, pinned)
 	}
-	_, err, _ := g.loader.Do(key, func() (interface{}, error) {
-		if peer, ok := g.peers.PickPeer(key); ok {
-			err := g.setFromPeer(peer, key, value, ishot)
-			if err != nil {
-				log.Println("nexuscache: set from peer error:", err)
-				return nil, err
-			}
-			return value, nil
+	if peer, ok := g.peers.PickPeer(key); ok {
+		err := g.setFromPeer(peer, key, value, ishot, pinned)
+		if err != nil {
+			log.Println("nexuscache: set from peer error:", err)
 		}
-		// If !ok, it means the current node is selected
-		g.mainCache.add(key, value)
-		return value, nil
-	})
-	return err
+		return err
+	}
+	// The current node is selected
+	return g.setOwned(key, value, ishot, pinned)
+}
+
+// setOwned is Set for a peer that picked this node as the owner. Writes of a
+// key are serialized but, unlike loads, never shared: each one reaches the
+// backend and the cache.
+func (g *Group) setOwned(key string, value *ByteView, ishot bool, pinned bool) error {
+	if key == "" {
+		return errors.New("key is empty")
+	}
+	if ishot {
+		return g.setHotCache(key, value, pinned)
+	}
+	defer g.writes.lock(key)()
+	if err := g.writeBack(key, value); err != nil {
+		return err
+	}
+	stored, err := g.mainCache.add(key, value, pinned)
+	if err != nil {
+		return err
+	}
+	g.publishChange(key, stored)
+	return nil
 }
 
-func (g *Group) setFromPeer(peer connect.PeerGetter, key string, value *ByteView, ishot bool) error {
-	return peer.Set(g.name, key, value.ByteSlice(), value.Expire(), ishot)
+func (g *Group) setFromPeer(peer connect.PeerGetter, key string, value *ByteView, ishot bool, pinned bool) error {
+	return peer.Set(g.name, key, value.ByteSlice(), value.Expire(), value.Flags(), value.Tags(), ishot, pinned)
 }
 
 // setHotCache sets a hot/frequently accessed cache entry
-func (g *Group) setHotCache(key string, value *ByteView) error {
+func (g *Group) setHotCache(key string, value *ByteView, pinned bool) error {
 	if key == "" {
 		return errors.New("key is empty")
 	}
-	g.loader.Do(key, func() (interface{}, error) {
-		g.hotCache.add(key, value)
-		log.Printf("NexusCache set hot cache %v \n", value.ByteSlice())
-		return nil, nil
-	})
+	defer g.writes.lock(key)()
+	if err := g.writeBack(key, value); err != nil {
+		return err
+	}
+	stored, err := g.hotCache.add(key, value, pinned)
+	if err != nil {
+		return err
+	}
+	g.publishChange(key, stored)
+	debugf("NexusCache set hot cache %v", value.ByteSlice())
 	return nil
 }
@@ -0,0 +1,35 @@
+package nexuscache
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// Log levels accepted by SetLogLevel
+const (
+	LogDebug = "debug" // Also logs every hit, miss and peer pick
+	LogInfo  = "info"
+)
+
+var debugLog atomic.Bool
+
+// SetLogLevel switches per-request logging on ("debug") or off ("info")
+func SetLogLevel(level string) error {
+	switch level {
+	case LogDebug:
+		debugLog.Store(true)
+	case LogInfo, "":
+		debugLog.Store(false)
+	default:
+		return fmt.Errorf("unknown log level %q", level)
+	}
+	return nil
+}
+
+// debugf logs per-request details when the debug level is on
+func debugf(format string, v ...interface{}) {
+	if debugLog.Load() {
+		log.Printf(format, v...)
+	}
+}
@@ -16,3 +16,28 @@ type GetterFunc func(key string) ([]byte, error)
 func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
+
+// A Setter writes data for a key back to the database or other backend,
+// see Group.SetWriteThrough and Group.SetWriteBehind.
+type Setter interface {
+	Set(key string, value []byte) error
+}
+
+// SetterFunc implements Setter interface.
+type SetterFunc func(key string, value []byte) error
+
+func (f SetterFunc) Set(key string, value []byte) error {
+	return f(key, value)
+}
+
+// A BatchSetter writes several keys at once. Write-behind uses it instead of
+// Set when the Setter implements it.
+type BatchSetter interface {
+	SetBatch(writes []Write) error
+}
+
+// Write is a value waiting to be written to the backend
+type Write struct {
+	Key   string
+	Value []byte
+}
@@ -1,8 +1,10 @@
 package nexuscache
 
 import (
+	"NexusCache/lru"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestGetter(t *testing.T) {
@@ -15,3 +17,118 @@ func TestGetter(t *testing.T) {
 		t.Errorf("callback failed")
 	}
 }
+
+func TestEvictionListener(t *testing.T) {
+	g := NewGroup("evictions", 20, 0, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value"), nil
+	}))
+	var evicted []string
+	g.AddEvictionListener(func(key string, value *ByteView, reason lru.EvictReason) {
+		if reason == lru.EvictCapacity {
+			evicted = append(evicted, key)
+		}
+	})
+	for _, key := range []string{"k1", "k2", "k3"} {
+		if _, err := g.Get(key); err != nil {
+			t.Fatalf("get %s failed: %v", key, err)
+		}
+	}
+	if !reflect.DeepEqual(evicted, []string{"k1"}) {
+		t.Fatalf("expect k1 to be evicted for capacity, got %v", evicted)
+	}
+}
+
+func TestReconfigureGroup(t *testing.T) {
+	loads := 0
+	g := NewGroup("reconfigure", 1<<10, 0, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte("value"), nil
+	}))
+	g.SetLoadRateLimit(1, 2)
+	for i, key := range []string{"k1", "k2", "k3"} {
+		_, err := g.Get(key)
+		if i < 2 && err != nil {
+			t.Fatalf("get %s within the burst failed: %v", key, err)
+		}
+		if i == 2 && err != ErrorLoadRateLimited {
+			t.Fatalf("expected the third load to be rate limited, got %v", err)
+		}
+	}
+	if _, err := g.Get("k1"); err != nil {
+		t.Fatalf("hits should not be rate limited: %v", err)
+	}
+	g.SetLoadRateLimit(0, 0)
+	if _, err := g.Get("k3"); err != nil || loads != 3 {
+		t.Fatalf("removing the limit should allow loads, err=%v loads=%d", err, loads)
+	}
+
+	var evicted []string
+	g.AddEvictionListener(func(key string, value *ByteView, reason lru.EvictReason) {
+		evicted = append(evicted, key)
+	})
+	g.SetCacheBytes(10, 0)
+	if !reflect.DeepEqual(evicted, []string{"k2", "k1"}) {
+		t.Fatalf("shrinking should evict the least recently used keys, got %v", evicted)
+	}
+
+	g.SetTTL(time.Hour)
+	if g.TTL() != time.Hour {
+		t.Fatalf("expected the new TTL, got %v", g.TTL())
+	}
+	g.SetTTL(0)
+	if g.TTL() != DefaultExpireTime {
+		t.Fatalf("a zero TTL should restore the default, got %v", g.TTL())
+	}
+}
+
+func TestWatch(t *testing.T) {
+	g := NewGroup("watch", 1<<20, 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("loaded"), nil
+	}))
+	g.RegisterPeers(localPeers{})
+	w, err := g.Watch("user:", true, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	start := LastEventSeq()
+
+	if _, err := g.Get("user:loaded"); err != nil {
+		t.Fatal(err)
+	}
+	expire := time.Now().Add(time.Minute)
+	g.Set("other", NewByteView([]byte("v"), expire), false, false)
+	g.Set("user:1", NewByteView([]byte("v"), expire), false, false)
+	g.Delete("user:1")
+	// Loads from the origin change nothing and other keys are filtered out
+	set, del := <-w.C, <-w.C
+	if set.Type != EventSet || set.Key != "user:1" || set.Value.String() != "v" || del.Type != EventDelete || del.Seq != set.Seq+1 {
+		t.Fatalf("unexpected events %+v %+v", set, del)
+	}
+
+	// A watcher that falls behind is dropped and can resume from its last event
+	for i := 0; i < 3; i++ {
+		g.Delete("user:2")
+	}
+	n := 0
+	for range w.C {
+		n++
+	}
+	if n != 2 || w.Err() != ErrorWatcherBehind {
+		t.Fatalf("expected 2 buffered events and ErrorWatcherBehind, got %d %v", n, w.Err())
+	}
+	resumed, err := g.Watch("user:", true, del.Seq, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Close()
+	if len(resumed.C) != 3 {
+		t.Fatalf("expected the 3 deletes of user:2 to be replayed, got %d", len(resumed.C))
+	}
+
+	SetEventHistory(2)
+	defer SetEventHistory(DefaultEventHistory)
+	if _, err := g.Watch("user:", true, start, 10); err != ErrorEventsCompacted {
+		t.Fatalf("expected ErrorEventsCompacted, got %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package nexuscache
+
+import (
+	"NexusCache/consistenthash"
+	"NexusCache/metrics"
+	pb "NexusCache/nexuscachepb"
+	"io"
+	"log"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// movedEntry is a local entry whose owner changed, together with the group it belongs to
+type movedEntry struct {
+	group *Group
+	cacheEntry
+}
+
+// ownershipDiff returns, per new owner, the entries of the main caches that
+// self owned under old but no longer owns under cur
+func ownershipDiff(self string, old, cur consistenthash.Placement) map[string][]movedEntry {
+	diff := make(map[string][]movedEntry)
+	for _, g := range Groups() {
+		entries := g.mainCache.entries(func(key string) bool {
+			owner := cur.Get(key)
+			return old.Get(key) == self && owner != self && owner != ""
+		})
+		for _, e := range entries {
+			owner := cur.Get(e.key)
+			diff[owner] = append(diff[owner], movedEntry{g, e})
+		}
+	}
+	return diff
+}
+
+// migrationWindow is how long after a membership change the keys written on
+// this node are protected from entries migrated in by their previous owner.
+// It outlasts a migration stream, see connect.Client.Migrate.
+const migrationWindow = time.Minute
+
+// ringChanged starts handing entries over after the ring changed from old,
+// must be called with peersMu held
+func (s *Server) ringChanged(old consistenthash.Placement) {
+	s.expectMigrations()
+	go s.rebalance(old, s.peers.Clone())
+}
+
+// expectMigrations makes the main caches record the keys written from now on,
+// so that entries the previous owners migrate here don't replace them. Which
+// write is newer is decided without comparing the versions of two nodes,
+// whose clocks may disagree. Recording stops migrationWindow after the last
+// membership change.
+func (s *Server) expectMigrations() {
+	for _, g := range Groups() {
+		g.mainCache.trackWrites(true)
+	}
+	n := s.migrations.Add(1)
+	time.AfterFunc(migrationWindow, func() {
+		if s.migrations.Load() != n {
+			return // a later change extended the window
+		}
+		for _, g := range Groups() {
+			g.mainCache.trackWrites(false)
+		}
+	})
+}
+
+// rebalance hands the entries whose owner changed between old and cur over to
+// their new owner, then drops the local copies that were not written since.
+// Rebalances are serialized and report their progress through the rebalance
+// metrics.
+func (s *Server) rebalance(old, cur consistenthash.Placement) {
+	s.rebalanceMu.Lock()
+	defer s.rebalanceMu.Unlock()
+	start := time.Now()
+	diff := ownershipDiff(s.selfNode(), old, cur)
+	pending := 0
+	for _, entries := range diff {
+		pending += len(entries)
+	}
+	if pending == 0 {
+		return
+	}
+	s.Log("rebalance: handing over %d entries to %d peers", pending, len(diff))
+	metrics.UpdateRebalancePending(pending)
+	for node, entries := range diff {
+		if err := s.migrate(node, entries); err != nil {
+			s.Log("rebalance: migrate to %s failed: %v", node, err)
+			metrics.RecordRebalanceKeys("failed", len(entries))
+		} else {
+			metrics.RecordRebalanceKeys("sent", len(entries))
+			// Keys written again since the snapshot keep the newer value
+			for _, e := range entries {
+				e.group.mainCache.removeVersion(e.key, e.value.Version())
+			}
+		}
+		pending -= len(entries)
+		metrics.UpdateRebalancePending(pending)
+	}
+	metrics.RecordRebalanceDuration(time.Since(start).Seconds())
+}
+
+// migrate streams entries to node with their remaining TTL
+func (s *Server) migrate(node string, entries []movedEntry) error {
+	s.peersMu.RLock()
+	client, ok := s.clients[node]
+	s.peersMu.RUnlock()
+	if !ok {
+		return ErrorUnknownPeer
+	}
+	now := time.Now()
+	batch := make([]*pb.MigrateEntry, 0, len(entries))
+	for _, e := range entries {
+		ttl := e.expire.Sub(now)
+		if ttl <= 0 {
+			continue
+		}
+		batch = append(batch, &pb.MigrateEntry{
+			Group:   e.group.name,
+			Key:     e.key,
+			Value:   e.value.ByteSlice(),
+			TtlMs:   ttl.Milliseconds(),
+			Pinned:  e.pinned,
+			Flags:   e.value.Flags(),
+			Tags:    e.value.Tags(),
+			Version: e.value.Version(),
+		})
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	_, err := client.Migrate(batch)
+	return err
+}
+
+// Migrate implements the gRPC Migrate interface - takes over entries streamed
+// by a peer after a membership change made this node their owner
+func (s *Server) Migrate(stream grpc.ClientStreamingServer[pb.MigrateEntry, pb.MigrateResponse]) error {
+	var received int64
+	for {
+		in, err := stream.Recv()
+		if err == io.EOF {
+			metrics.RecordRebalanceKeys("received", int(received))
+			return stream.SendAndClose(&pb.MigrateResponse{Received: received})
+		}
+		if err != nil {
+			return err
+		}
+		group := GetGroup(in.GetGroup())
+		if group == nil || in.GetTtlMs() <= 0 {
+			continue
+		}
+		expire := time.Now().Add(time.Duration(in.GetTtlMs()) * time.Millisecond)
+		value := NewByteViewFlags(cloneBytes(in.GetValue()), expire, in.GetFlags()).WithTags(in.GetTags()...).withVersion(in.GetVersion())
+		imported, err := group.mainCache.importEntry(in.GetKey(), value, expire, in.GetPinned())
+		if err != nil {
+			log.Printf("migrate %s/%s: %v", in.GetGroup(), in.GetKey(), err)
+			continue
+		}
+		if imported {
+			received++
+		}
+	}
+}
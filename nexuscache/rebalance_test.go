@@ -0,0 +1,154 @@
+package nexuscache
+
+import (
+	"NexusCache/connect"
+	"NexusCache/consistenthash"
+	pb "NexusCache/nexuscachepb"
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestOwnershipDiff(t *testing.T) {
+	g := NewGroup("rebalance-diff", 1<<20, 0, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	for i := 0; i < 200; i++ {
+		g.Get(strconv.Itoa(i))
+	}
+	old := consistenthash.New(50, nil)
+	old.AddNodes("self")
+	cur := old.Clone()
+	cur.AddWeightedNode("joiner", 1)
+
+	diff := ownershipDiff("self", old, cur)
+	if len(diff) != 1 || len(diff["joiner"]) == 0 {
+		t.Fatalf("expected entries to move to joiner only, got %d peers", len(diff))
+	}
+	moved := 0
+	for _, e := range diff["joiner"] {
+		if e.group != g {
+			continue // entries of groups created by other tests
+		}
+		moved++
+		if cur.Get(e.key) != "joiner" {
+			t.Fatalf("entry %s does not belong to joiner", e.key)
+		}
+		if ttl := time.Until(e.expire); ttl <= 0 {
+			t.Fatalf("entry %s carries no remaining TTL", e.key)
+		}
+	}
+	if moved == 0 || moved == 200 {
+		t.Fatalf("expected a share of the 200 keys to move, got %d", moved)
+	}
+}
+
+func TestMigrateReceivesEntries(t *testing.T) {
+	g := NewGroup("rebalance-migrate", 1<<20, 0, GetterFunc(func(key string) ([]byte, error) {
+		return nil, context.Canceled
+	}))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := grpc.NewServer()
+	pb.RegisterNexusCacheServer(grpcServer, NewServer("test", lis.Addr().String(), nil))
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	stream, err := pb.NewNexusCacheClient(conn).Migrate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// raced was written here after this node became its owner, the old
+	// owner's copy must not overwrite it even though this node's clock, which
+	// seeds its versions, runs far behind
+	c := &g.mainCache
+	c.mu.Lock()
+	c.lazyInit()
+	c.version = 1
+	c.mu.Unlock()
+	c.trackWrites(true)
+	defer c.trackWrites(false)
+	c.add("raced", NewByteView([]byte("written"), time.Now().Add(time.Hour)), false)
+	c.add("deleted", NewByteView([]byte("written"), time.Now().Add(time.Hour)), false)
+	c.remove("deleted")
+	migratedVersion := uint64(time.Now().UnixNano())
+	entries := []*pb.MigrateEntry{
+		{Group: "rebalance-migrate", Key: "live", Value: []byte("v"), TtlMs: time.Hour.Milliseconds(), Version: migratedVersion},
+		{Group: "rebalance-migrate", Key: "raced", Value: []byte("stale"), TtlMs: time.Hour.Milliseconds(), Version: migratedVersion},
+		{Group: "rebalance-migrate", Key: "deleted", Value: []byte("stale"), TtlMs: time.Hour.Milliseconds(), Version: migratedVersion},
+		{Group: "rebalance-migrate", Key: "dead", Value: []byte("v"), TtlMs: 0},
+		{Group: "no-such-group", Key: "live", Value: []byte("v"), TtlMs: 1000},
+	}
+	for _, e := range entries {
+		if err := stream.Send(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetReceived() != 1 {
+		t.Fatalf("expected 1 entry accepted, got %d", resp.GetReceived())
+	}
+	if v, ok := g.mainCache.get("live"); !ok || v.String() != "v" {
+		t.Fatalf("migrated entry is missing")
+	}
+	if _, ok := g.mainCache.get("dead"); ok {
+		t.Fatalf("expired entry should not be imported")
+	}
+	if v, ok := g.mainCache.get("raced"); !ok || v.String() != "written" {
+		t.Fatalf("migration overwrote a newer write with %v", v)
+	}
+	if _, ok := g.mainCache.get("deleted"); ok {
+		t.Fatalf("migration brought back a deleted key")
+	}
+}
+
+func TestRebalanceKeepsNewerWrites(t *testing.T) {
+	g := NewGroup("rebalance-race", 1<<20, 0, GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrorNotFound
+	}))
+	g.RegisterPeers(localPeers{})
+	remote, addr := startRecordingPeer(t)
+	s := NewServer("svc1", "127.0.0.1:8001", nil)
+	s.addPeer("svc1", connect.NodeInfo{Addr: "127.0.0.1:8001", Weight: 1})
+	old := s.peers.Clone()
+	s.addPeer("svc2", connect.NodeInfo{Addr: addr, Weight: 1})
+
+	expire := time.Now().Add(time.Hour)
+	var moved []string
+	for i := 0; len(moved) < 2; i++ {
+		if key := "k" + strconv.Itoa(i); s.peers.Get(key) == "svc2" {
+			g.mainCache.add(key, NewByteView([]byte("old"), expire), false)
+			moved = append(moved, key)
+		}
+	}
+	// A write of the first key comes in after the entries were read
+	remote.onMigrate = func() {
+		g.mainCache.add(moved[0], NewByteView([]byte("new"), expire), false)
+	}
+	s.rebalance(old, s.peers.Clone())
+
+	if got := remote.Migrated(); len(got) < 2 {
+		t.Fatalf("expected the keys to be migrated, got %v", got)
+	}
+	if v, ok := g.mainCache.get(moved[0]); !ok || v.String() != "new" {
+		t.Fatalf("the write made during the migration was dropped, got %v", v)
+	}
+	if _, ok := g.mainCache.get(moved[1]); ok {
+		t.Fatalf("the migrated copy of %s should be dropped", moved[1])
+	}
+}
@@ -3,17 +3,20 @@ package nexuscache
 import (
 	"NexusCache/connect"
 	"NexusCache/consistenthash"
+	"NexusCache/metrics"
 	pb "NexusCache/nexuscachepb"
 	"fmt"
 	"log"
 	"net"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // Server handles incoming requests from other nodes
@@ -22,147 +25,611 @@ var (
 	ErrorTcpListen        = errors.New("tcp listen error")
 	ErrorRegisterEtcd     = errors.New("register etcd error")
 	ErrorGrpcServerStart  = errors.New("start grpc server error")
+	ErrorUnknownPeer      = errors.New("unknown peer")
 )
 
 var (
 	defaultListenAddr = "0.0.0.0:8888"
 )
 
-const (
-	defaultReplicas = 50
-)
-
 type Server struct {
 	pb.UnimplementedNexusCacheServer
 
-	status  bool   // Indicates whether the server is running
-	self    string // This node's IP address
-	mu      sync.Mutex
-	peers   *consistenthash.Map // Consistent hash ring
-	etcd    *connect.Etcd
-	name    string
-	clients map[string]*connect.Client // Map of [node name] to client
+	status     bool   // Indicates whether the server is running
+	self       string // Address this node advertises to peers
+	listenAddr string // Address the gRPC server binds to
+	mu         sync.Mutex
+	peers      consistenthash.Placement // Key placement, the consistent hash ring by default
+	etcd       *connect.Etcd
+	name       string
+	clients    map[string]*connect.Client // Map of [node name] to client
+	peersMu    sync.RWMutex               // Guards clients and serializes membership changes
+
+	grpcServer  *grpc.Server       // Current gRPC server, nil when stopped; guarded by mu
+	lis         net.Listener       // Listener of grpcServer
+	stopped     chan struct{}      // Closed when grpcServer stops serving
+	serveErr    error              // Error Serve returned, if any
+	watchCancel context.CancelFunc // Stops watching peer registrations; guarded by mu
+	rebalanceMu sync.Mutex         // Serializes rebalances after membership changes
+	migrations  atomic.Uint64      // Counts membership changes, see expectMigrations
+	services    []service          // Served next to the peer service; guarded by mu
 }
 
-// NewServer creates a gRPC server and binds it to etcd
-func NewServer(serverName, selfAddr string, etcd *connect.Etcd) *Server {
+// service is a gRPC service registered with RegisterService
+type service struct {
+	desc *grpc.ServiceDesc
+	impl any
+}
 
+// NewServer creates a gRPC server and binds it to etcd. selfAddr is the
+// address advertised to peers; unless SetListenAddr says otherwise the server
+// binds all interfaces on the same port.
+func NewServer(serverName, selfAddr string, etcd *connect.Etcd) *Server {
+	listenAddr := defaultListenAddr
+	if _, port, err := net.SplitHostPort(selfAddr); err == nil {
+		listenAddr = net.JoinHostPort("0.0.0.0", port)
+	}
 	return &Server{
-		self:    selfAddr,
-		status:  false,
-		peers:   consistenthash.New(defaultReplicas, nil),
-		etcd:    etcd,
-		clients: make(map[string]*connect.Client),
-		name:    serverName,
+		self:       selfAddr,
+		listenAddr: listenAddr,
+		status:     false,
+		peers:      consistenthash.New(consistenthash.DefaultReplicas, nil),
+		etcd:       etcd,
+		clients:    make(map[string]*connect.Client),
+		name:       serverName,
 	}
 }
 
+// The handlers of the peer service act on this node only: a peer calls them
+// after picking this node as the owner of the key, and forwarding again would
+// bounce requests between nodes whose rings briefly disagree.
+
 // Get implements the gRPC Get interface - returns cached value when remote node requests it
 func (s *Server) Get(ctx context.Context, in *pb.GetRequest) (out *pb.GetResponse, err error) {
-	groupName, key := in.GetGroup(), in.GetKey()
-	group := GetGroup(groupName)
-	bytes, err := group.Get(key)
+	s.trackSelf()
+	defer s.untrackSelf()
+	group, err := lookupGroup(in.GetGroup())
 	if err != nil {
 		return nil, err
 	}
+	var bytes *ByteView
+	if in.GetPeek() {
+		bytes, err = group.peekOwned(in.GetKey())
+	} else {
+		bytes, err = group.getOwned(in.GetKey())
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
 	out = &pb.GetResponse{
-		Value: bytes.ByteSlice(),
+		Value:   bytes.ByteSlice(),
+		Flags:   bytes.Flags(),
+		Tags:    bytes.Tags(),
+		Version: bytes.Version(),
+	}
+	if !bytes.Expire().IsZero() {
+		out.TtlMs = time.Until(bytes.Expire()).Milliseconds()
 	}
 	return out, nil
 }
 
+// Delete implements the gRPC Delete interface - drops a key owned by this node
+func (s *Server) Delete(ctx context.Context, in *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	s.trackSelf()
+	defer s.untrackSelf()
+	group, err := lookupGroup(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := group.deleteOwned(in.GetKey())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.DeleteResponse{Deleted: deleted}, nil
+}
+
+// toStatus reports the errors of the group to peers as statuses
+func toStatus(err error) error {
+	switch errors.Cause(err) {
+	case ErrorNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case ErrorVersionMismatch:
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case ErrorNotInteger:
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return err
+}
+
+// expireIn returns the expiry of a ttl given in milliseconds, zero for 0
+func expireIn(ttlMs int64) time.Time {
+	if ttlMs <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(ttlMs) * time.Millisecond)
+}
+
+// CompareAndSet implements the gRPC CompareAndSet interface for a key owned by this node
+func (s *Server) CompareAndSet(ctx context.Context, in *pb.CompareAndSetRequest) (*pb.CompareAndSetResponse, error) {
+	s.trackSelf()
+	defer s.untrackSelf()
+	group, err := lookupGroup(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	value := NewByteViewFlags(in.GetValue(), expireIn(in.GetTtlMs()), in.GetFlags()).WithTags(in.GetTags()...)
+	stored, err := group.compareAndSetOwned(in.GetKey(), in.GetVersion(), value)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.CompareAndSetResponse{Version: stored.Version()}, nil
+}
+
+// Incr implements the gRPC Incr interface for a key owned by this node
+func (s *Server) Incr(ctx context.Context, in *pb.IncrRequest) (*pb.IncrResponse, error) {
+	s.trackSelf()
+	defer s.untrackSelf()
+	group, err := lookupGroup(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	n, err := group.incrOwned(in.GetKey(), in.GetDelta(), expireIn(in.GetTtlMs()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.IncrResponse{Value: n}, nil
+}
+
+// Invalidate implements the gRPC Invalidate interface, dropping tagged or
+// prefixed keys from this node only
+func (s *Server) Invalidate(ctx context.Context, in *pb.InvalidateRequest) (*pb.InvalidateResponse, error) {
+	s.trackSelf()
+	defer s.untrackSelf()
+	group, err := lookupGroup(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	removed, err := group.invalidateOwned(in.GetTag(), in.GetPrefix())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &pb.InvalidateResponse{Removed: int64(removed)}, nil
+}
+
+// Flush implements the gRPC Flush interface, dropping every key of a group
+// from this node only
+func (s *Server) Flush(ctx context.Context, in *pb.FlushRequest) (*pb.FlushResponse, error) {
+	s.trackSelf()
+	defer s.untrackSelf()
+	group, err := lookupGroup(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	group.flushOwned()
+	return &pb.FlushResponse{}, nil
+}
+
 // Set implements the gRPC Set interface - sets cache when remote node requests it
 func (s *Server) Set(ctx context.Context, in *pb.SetRequest) (out *pb.SetResponse, err error) {
-	groupName, key, value, expire := in.GetGroup(), in.GetKey(), in.GetValue(), in.GetExpire()
-	ishot := in.GetIshot()
-	group := GetGroup(groupName)
-	bytes := NewByteView(value, time.Unix(expire, 0))
+	s.trackSelf()
+	defer s.untrackSelf()
+	key, value, expire := in.GetKey(), in.GetValue(), in.GetExpire()
+	ishot, pinned := in.GetIshot(), in.GetPinned()
+	group, err := lookupGroup(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	bytes := NewByteViewFlags(value, time.Unix(expire, 0), in.GetFlags()).WithTags(in.GetTags()...)
 	out = &pb.SetResponse{
 		Ok: false,
 	}
-	err = group.Set(key, bytes, ishot)
+	err = group.setOwned(key, bytes, ishot, pinned)
 	if err != nil {
 		return out, err
 	}
 	return &pb.SetResponse{Ok: true}, nil
 }
 
+// lookupGroup returns the group named name, or a NotFound status when this
+// node does not know it
+func lookupGroup(name string) (*Group, error) {
+	if g := GetGroup(name); g != nil {
+		return g, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "group %q not found", name)
+}
+
 func (s *Server) Log(format string, v ...interface{}) {
 	log.Printf("[Server %s] %s", s.self, fmt.Sprintf(format, v...))
 }
 
-// SetPeers discovers nodes in etcd, adds their IPs to the hash ring, and saves clients for later use
+// SetPeers discovers nodes in etcd, adds them to the hash ring by name, and saves clients for later use
 func (s *Server) SetPeers(names ...string) {
+	s.peersMu.Lock()
+	defer s.peersMu.Unlock()
+	old := s.peers.Clone()
+	defer s.ringChanged(old)
 
 	for _, name := range names {
 		//log.Printf("debug, In server.SetPeers, name:", name)
-		ip, err := connect.GetAddrByName(s.etcd.EtcdCli, name)
+		node, err := connect.GetNodeByName(s.etcd.EtcdCli, name)
 		if err != nil {
 			log.Printf("SetPeers err : %v", err)
 			return
 		}
-		//log.Printf("debug, In server.SetPeers, ip:", ip)
-		addr := strings.Split(ip, ":")[0]
-		s.peers.AddNodes(addr)
-		s.clients[addr] = &connect.Client{name, s.etcd}
+		s.addPeer(name, node)
 	}
+	s.Log("key distribution: %v", s.peers.Distribution())
 	//log.Println("SetPeers success, s.clients =", s.clients)
 }
 
-// PickPeer wraps the consistent hash Get() method to select a node based on the key
-// and returns the corresponding RPC client.
+// addPeer puts a node on the hash ring, must be called with peersMu held.
+// Nodes are identified by their registered name rather than their address, so
+// several nodes may share a host and a node keeps its keys across restarts.
+func (s *Server) addPeer(name string, node connect.NodeInfo) {
+	s.peers.AddWeightedNode(name, node.Weight)
+	s.clients[name] = &connect.Client{Name: name, Addr: node.Addr, Etcd: s.etcd}
+}
+
+// RemovePeer takes the node registered as name off the hash ring
+func (s *Server) RemovePeer(name string) {
+	s.peersMu.Lock()
+	defer s.peersMu.Unlock()
+	client, ok := s.clients[name]
+	if !ok {
+		return
+	}
+	old := s.peers.Clone()
+	s.peers.Remove(name)
+	delete(s.clients, name)
+	s.Log("RemovePeer %s (%s)", name, client.Addr)
+	s.ringChanged(old)
+}
+
+// WatchPeers follows the etcd registrations of names, so that a node leaving
+// the cluster is taken off the ring as soon as its lease is revoked and a
+// node coming back is re-added without calling /setpeer.
+func (s *Server) WatchPeers(names ...string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.watchCancel = cancel
+	s.mu.Unlock()
+	connect.WatchNodes(ctx, s.etcd.EtcdCli, names, func(name string, node connect.NodeInfo, deleted bool) {
+		if name == s.name {
+			return
+		}
+		if deleted {
+			s.RemovePeer(name)
+			return
+		}
+		s.peersMu.Lock()
+		defer s.peersMu.Unlock()
+		old := s.peers.Clone()
+		s.addPeer(name, node)
+		s.Log("peer %s registered at %s", name, node.Addr)
+		s.ringChanged(old)
+	})
+}
+
+// PickPeer returns the RPC client of the node owning key on the hash ring,
+// ok is false when this node owns it. Writes, deletes and peeks use it, so
+// they always reach the owner.
 func (s *Server) PickPeer(key string) (connect.PeerGetter, bool) {
-	//s.mu.Lock()
-	//defer s.mu.Unlock()
-	if peer := s.peers.Get(key); peer != "" {
-		ip := strings.Split(s.self, ":")[0]
-		if peer == ip {
-			log.Println("ops! peek my self! , i am :", peer)
-			return nil, false
+	return s.peerFor(s.peers.Get(key))
+}
+
+// PickLoadPeer returns the node a read-through load of key goes to, which
+// with bounded loads may be another than the owner when the owner is busy
+func (s *Server) PickLoadPeer(key string) (connect.PeerGetter, bool) {
+	return s.peerFor(s.lookupPeer(key))
+}
+
+// peerFor returns the RPC client of peer, ok is false for this node and
+// unknown peers
+func (s *Server) peerFor(peer string) (connect.PeerGetter, bool) {
+	if peer == "" {
+		return nil, false
+	}
+	if peer == s.selfNode() {
+		debugf("ops! peek my self! , i am : %s", peer)
+		return nil, false
+	}
+	debugf("[Server %s] Pick peer %s", s.self, peer)
+	s.peersMu.RLock()
+	client, ok := s.clients[peer]
+	s.peersMu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	loads, _ := s.peers.(consistenthash.BoundedLoader)
+	return &trackedPeer{PeerGetter: client, node: peer, peers: loads}, true
+}
+
+// AllPeers returns the other nodes on the ring
+func (s *Server) AllPeers() map[string]connect.PeerGetter {
+	s.peersMu.RLock()
+	defer s.peersMu.RUnlock()
+	loads, _ := s.peers.(consistenthash.BoundedLoader)
+	out := make(map[string]connect.PeerGetter, len(s.clients))
+	for name, client := range s.clients {
+		if name != s.selfNode() {
+			out[name] = &trackedPeer{PeerGetter: client, node: name, peers: loads}
 		}
-		s.Log("Pick peer %s", peer)
-		return s.clients[peer], true
 	}
-	return nil, false
+	return out
+}
+
+// lookupPeer returns the node to load key from, honoring bounded loads when enabled
+func (s *Server) lookupPeer(key string) string {
+	if loads, ok := s.peers.(consistenthash.BoundedLoader); ok && loads.BoundedLoad() {
+		return loads.GetLeast(key)
+	}
+	return s.peers.Get(key)
+}
+
+// SetPlacement replaces the placement algorithm, it must be called before SetPeers
+func (s *Server) SetPlacement(p consistenthash.Placement) {
+	s.peers = p
+}
+
+// EnableBoundedLoad turns on consistent hashing with bounded loads: a key is
+// routed to the next node on the ring when its owner already carries more than
+// (1+epsilon) times the average in-flight load.
+func (s *Server) EnableBoundedLoad(epsilon float64) error {
+	loads, ok := s.peers.(consistenthash.BoundedLoader)
+	if !ok {
+		return errors.New("bounded loads require the ring placement")
+	}
+	loads.SetLoadFactor(epsilon)
+	return nil
+}
+
+// selfNode returns the name of this node on the hash ring
+func (s *Server) selfNode() string {
+	return s.name
+}
+
+// trackSelf counts a request served by this node towards its ring load
+func (s *Server) trackSelf() {
+	if loads, ok := s.peers.(consistenthash.BoundedLoader); ok {
+		loads.Inc(s.selfNode())
+	}
+}
+
+func (s *Server) untrackSelf() {
+	if loads, ok := s.peers.(consistenthash.BoundedLoader); ok {
+		loads.Done(s.selfNode())
+	}
+}
+
+// trackedPeer records metrics for every peer call and, with the ring placement,
+// feeds in-flight requests back into it so that bounded loads see each node's load
+type trackedPeer struct {
+	connect.PeerGetter
+	node  string
+	peers consistenthash.BoundedLoader // nil if the placement does not track loads
+}
+
+func (p *trackedPeer) Get(group string, key string) (*pb.GetResponse, error) {
+	defer p.track()()
+	start := time.Now()
+	value, err := p.PeerGetter.Get(group, key)
+	p.record(start, err)
+	return value, err
+}
+
+func (p *trackedPeer) Peek(group string, key string) (*pb.GetResponse, error) {
+	defer p.track()()
+	start := time.Now()
+	value, err := p.PeerGetter.Peek(group, key)
+	p.record(start, err)
+	return value, err
+}
+
+func (p *trackedPeer) Delete(group string, key string) (bool, error) {
+	defer p.track()()
+	start := time.Now()
+	deleted, err := p.PeerGetter.Delete(group, key)
+	p.record(start, err)
+	return deleted, err
+}
+
+func (p *trackedPeer) CompareAndSet(group string, key string, version uint64, value []byte, expire time.Time, flags uint32, tags []string) (uint64, error) {
+	defer p.track()()
+	start := time.Now()
+	stored, err := p.PeerGetter.CompareAndSet(group, key, version, value, expire, flags, tags)
+	p.record(start, err)
+	return stored, err
+}
+
+func (p *trackedPeer) Incr(group string, key string, delta int64, expire time.Time) (int64, error) {
+	defer p.track()()
+	start := time.Now()
+	n, err := p.PeerGetter.Incr(group, key, delta, expire)
+	p.record(start, err)
+	return n, err
+}
+
+func (p *trackedPeer) Set(group string, key string, value []byte, expire time.Time, flags uint32, tags []string, ishot bool, pinned bool) error {
+	defer p.track()()
+	start := time.Now()
+	err := p.PeerGetter.Set(group, key, value, expire, flags, tags, ishot, pinned)
+	p.record(start, err)
+	return err
+}
+
+func (p *trackedPeer) Invalidate(group string, tag string, prefix string) (int64, error) {
+	defer p.track()()
+	start := time.Now()
+	removed, err := p.PeerGetter.Invalidate(group, tag, prefix)
+	p.record(start, err)
+	return removed, err
+}
+
+func (p *trackedPeer) Flush(group string) error {
+	defer p.track()()
+	start := time.Now()
+	err := p.PeerGetter.Flush(group)
+	p.record(start, err)
+	return err
+}
+
+// track marks a call in flight and returns the func ending it
+func (p *trackedPeer) track() func() {
+	if p.peers == nil {
+		return func() {}
+	}
+	p.peers.Inc(p.node)
+	return func() { p.peers.Done(p.node) }
+}
+
+func (p *trackedPeer) record(start time.Time, err error) {
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	metrics.RecordPeerRequest(p.node, status, time.Since(start).Seconds())
 }
 
 // RemovePeerByKey finds and removes the node that stores the given key from the hash ring
 func (s *Server) RemovePeerByKey(key string) {
+	s.peersMu.Lock()
+	defer s.peersMu.Unlock()
+	old := s.peers.Clone()
 	peer := s.peers.Get(key)
 	s.peers.Remove(peer)
+	delete(s.clients, peer)
 	log.Printf("RemovePeer %s", peer)
+	s.ringChanged(old)
 }
 
-// StartServer 开启grpc服务，并在etcd上注册
-func (s *Server) StartServer() error {
-	// -----------------Start Server----------------------
-	// 1. Set status to true indicating server is running
-	// 2. Initialize TCP socket and start listening
-	// 3. Register RPC service with gRPC so it can dispatch requests to server
-	// ------------------------------------------------
+// SetListenAddr changes the address the gRPC server binds to on its next Start.
+// The address peers dial is the one the node advertises in etcd, so the server
+// may bind a wildcard or a Unix socket (unix:///path) independently of it.
+func (s *Server) SetListenAddr(addr string) {
 	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listenAddr = addr
+}
+
+// Start listens on the gRPC address and serves in the background. It returns
+// once the listener is bound, so that peers can connect as soon as it returns.
+// A server that was shut down can be started again.
+func (s *Server) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.status {
-		s.mu.Unlock()
 		return ErrorServerHasStarted
 	}
-	// Start gRPC server
-	lis, err := net.Listen("tcp", defaultListenAddr)
+	lis, err := connect.Listen(ctx, s.listenAddr)
 	if err != nil {
 		log.Println("listen server error:", err)
 		return ErrorTcpListen
 	}
+	// A grpc.Server can't be reused after it was stopped, so each run gets its own
 	grpcServer := grpc.NewServer()
 	pb.RegisterNexusCacheServer(grpcServer, s)
+	for _, svc := range s.services {
+		grpcServer.RegisterService(svc.desc, svc.impl)
+	}
+
+	log.Println("start grpc server:", s.self, "listening on", lis.Addr())
+	s.grpcServer, s.lis, s.serveErr = grpcServer, lis, nil
+	s.stopped = make(chan struct{})
+	s.status = true
+	go s.serve(grpcServer, lis, s.stopped)
+	return nil
+}
+
+// RegisterService adds a service, such as the public cache API, to the gRPC
+// server peers connect to. It implements grpc.ServiceRegistrar and takes
+// effect the next time the server starts.
+func (s *Server) RegisterService(desc *grpc.ServiceDesc, impl any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.services = append(s.services, service{desc, impl})
+}
 
-	log.Println("start grpc server:", s.self)
-	err = grpcServer.Serve(lis)
+// serve runs the gRPC server until it is stopped and then records the state
+func (s *Server) serve(srv *grpc.Server, lis net.Listener, stopped chan struct{}) {
+	err := srv.Serve(lis)
 	if err != nil {
 		log.Println(ErrorGrpcServerStart, "err： ", err)
-		return ErrorGrpcServerStart
 	}
-	s.status = true
+	s.mu.Lock()
+	if s.grpcServer == srv {
+		s.grpcServer, s.lis, s.serveErr = nil, nil, err
+		s.status = false
+	}
+	s.mu.Unlock()
+	close(stopped)
+}
+
+// Shutdown stops accepting RPCs and waits for running ones to finish. If ctx
+// is done first the server is stopped hard and ctx.Err() is returned.
+// Shutting down a server that is not running is a no-op.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	srv, stopped := s.grpcServer, s.stopped
+	s.mu.Unlock()
+	if srv == nil {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		srv.Stop()
+		err = ctx.Err()
+	}
+	<-stopped
+	log.Println("grpc server stopped:", s.self)
+	return err
+}
+
+// Running reports whether the gRPC server is serving
+func (s *Server) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// Addr returns the address the gRPC server is bound to, "" when it is not running
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lis == nil {
+		return ""
+	}
+	return s.lis.Addr().String()
+}
+
+// StartServer starts the gRPC server and blocks until it is shut down
+func (s *Server) StartServer() error {
+	if err := s.Start(context.Background()); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	stopped := s.stopped
 	s.mu.Unlock()
+	<-stopped
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.serveErr != nil {
+		return ErrorGrpcServerStart
+	}
 	return nil
 }
 
-var _ connect.PeerPicker = (*Server)(nil)
+var (
+	_ connect.PeerPicker     = (*Server)(nil)
+	_ connect.PeerLister     = (*Server)(nil)
+	_ connect.LoadPeerPicker = (*Server)(nil)
+	_ grpc.ServiceRegistrar  = (*Server)(nil)
+)
@@ -0,0 +1,271 @@
+package nexuscache
+
+import (
+	"NexusCache/connect"
+	"NexusCache/consistenthash"
+	pb "NexusCache/nexuscachepb"
+	"context"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestPickPeerSameHost(t *testing.T) {
+	s := NewServer("svc1", "127.0.0.1:8001", nil)
+	s.addPeer("svc1", connect.NodeInfo{Addr: "127.0.0.1:8001", Weight: 1})
+	s.addPeer("svc2", connect.NodeInfo{Addr: "127.0.0.1:8002", Weight: 1})
+
+	if nodes := s.peers.Distribution(); len(nodes) != 2 {
+		t.Fatalf("nodes sharing a host should both be on the ring, got %v", nodes)
+	}
+	local, remote := 0, 0
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		peer, ok := s.PickPeer(key)
+		owner := s.peers.Get(key)
+		if ok != (owner == "svc2") {
+			t.Fatalf("key %s owned by %s, PickPeer returned remote=%v", key, owner, ok)
+		}
+		if !ok {
+			local++
+			continue
+		}
+		remote++
+		if client := peer.(*trackedPeer).PeerGetter.(*connect.Client); client.Name != "svc2" || client.Addr != "127.0.0.1:8002" {
+			t.Fatalf("key %s routed to %+v", key, client)
+		}
+	}
+	if local == 0 || remote == 0 {
+		t.Fatalf("expected keys on both nodes, got local=%d remote=%d", local, remote)
+	}
+}
+
+func TestUnknownGroupNotFound(t *testing.T) {
+	s := NewServer("svc1", "127.0.0.1:8001", nil)
+	if _, err := s.Get(context.Background(), &pb.GetRequest{Group: "missing", Key: "k"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound for Get, got %v", err)
+	}
+	if _, err := s.Set(context.Background(), &pb.SetRequest{Group: "missing", Key: "k"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound for Set, got %v", err)
+	}
+}
+
+// remotePeers makes every key owned by peer
+type remotePeers struct{ peer connect.PeerGetter }
+
+func (p remotePeers) PickPeer(key string) (connect.PeerGetter, bool) { return p.peer, true }
+
+// forbiddenPeer fails the test when it is called
+type forbiddenPeer struct {
+	connect.PeerGetter
+	t *testing.T
+}
+
+func (p forbiddenPeer) Get(group string, key string) (*pb.GetResponse, error) {
+	p.t.Fatalf("peer service forwarded Get %s", key)
+	return nil, nil
+}
+
+func (p forbiddenPeer) Peek(group string, key string) (*pb.GetResponse, error) {
+	p.t.Fatalf("peer service forwarded Peek %s", key)
+	return nil, nil
+}
+
+func (p forbiddenPeer) Delete(group string, key string) (bool, error) {
+	p.t.Fatalf("peer service forwarded Delete %s", key)
+	return false, nil
+}
+
+func (p forbiddenPeer) Set(group string, key string, value []byte, expire time.Time, flags uint32, tags []string, ishot bool, pinned bool) error {
+	p.t.Fatalf("peer service forwarded Set %s", key)
+	return nil
+}
+
+func TestPeerServiceNeverForwards(t *testing.T) {
+	// This node's ring says another node owns every key, as it may while
+	// membership changes propagate
+	g := NewGroup("peer-local", 1<<20, 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("origin-" + key), nil
+	}))
+	g.RegisterPeers(remotePeers{forbiddenPeer{t: t}})
+	s := NewServer("svc1", "127.0.0.1:8001", nil)
+	ctx := context.Background()
+
+	out, err := s.Get(ctx, &pb.GetRequest{Group: "peer-local", Key: "a"})
+	if err != nil || string(out.GetValue()) != "origin-a" {
+		t.Fatalf("Get = %v, %v", out, err)
+	}
+	expire := time.Now().Add(time.Minute).Unix()
+	if _, err := s.Set(ctx, &pb.SetRequest{Group: "peer-local", Key: "b", Value: []byte("v"), Expire: expire, Flags: 7}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	out, err = s.Get(ctx, &pb.GetRequest{Group: "peer-local", Key: "b", Peek: true})
+	if err != nil || string(out.GetValue()) != "v" || out.GetFlags() != 7 || out.GetTtlMs() <= 0 {
+		t.Fatalf("Peek = %v, %v", out, err)
+	}
+	if _, err := s.Get(ctx, &pb.GetRequest{Group: "peer-local", Key: "absent", Peek: true}); status.Code(err) != codes.NotFound {
+		t.Fatalf("Peek of an uncached key: expected NotFound, got %v", err)
+	}
+	if out.GetVersion() == 0 {
+		t.Fatalf("Peek should return the version")
+	}
+	cas, err := s.CompareAndSet(ctx, &pb.CompareAndSetRequest{Group: "peer-local", Key: "b", Value: []byte("w"), Version: out.GetVersion()})
+	if err != nil || cas.GetVersion() <= out.GetVersion() {
+		t.Fatalf("CompareAndSet = %v, %v", cas, err)
+	}
+	if _, err := s.CompareAndSet(ctx, &pb.CompareAndSetRequest{Group: "peer-local", Key: "b", Version: out.GetVersion()}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("stale CompareAndSet: expected FailedPrecondition, got %v", err)
+	}
+	incr, err := s.Incr(ctx, &pb.IncrRequest{Group: "peer-local", Key: "n", Delta: 2})
+	if err != nil || incr.GetValue() != 2 {
+		t.Fatalf("Incr = %v, %v", incr, err)
+	}
+	if _, err := s.Incr(ctx, &pb.IncrRequest{Group: "peer-local", Key: "b", Delta: 1}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Incr of a string: expected InvalidArgument, got %v", err)
+	}
+	del, err := s.Delete(ctx, &pb.DeleteRequest{Group: "peer-local", Key: "b"})
+	if err != nil || !del.GetDeleted() {
+		t.Fatalf("Delete = %v, %v", del, err)
+	}
+	if st := g.Stats(); st.Gets != 1 || st.Loads != 1 || st.PeerLoads != 0 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+// recordingPeer is a peer gRPC service recording the writes it receives
+type recordingPeer struct {
+	pb.UnimplementedNexusCacheServer
+	mu        sync.Mutex
+	calls     []string
+	migrated  []*pb.MigrateEntry
+	onMigrate func() // Called before a migration is answered
+}
+
+func (p *recordingPeer) record(call string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, call)
+}
+
+func (p *recordingPeer) Calls() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.calls...)
+}
+
+func (p *recordingPeer) Get(ctx context.Context, in *pb.GetRequest) (*pb.GetResponse, error) {
+	p.record("get " + in.GetKey())
+	return &pb.GetResponse{Value: []byte("remote")}, nil
+}
+
+func (p *recordingPeer) Set(ctx context.Context, in *pb.SetRequest) (*pb.SetResponse, error) {
+	p.record("set " + in.GetKey())
+	return &pb.SetResponse{Ok: true}, nil
+}
+
+func (p *recordingPeer) Delete(ctx context.Context, in *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	p.record("delete " + in.GetKey())
+	return &pb.DeleteResponse{Deleted: true}, nil
+}
+
+func (p *recordingPeer) Incr(ctx context.Context, in *pb.IncrRequest) (*pb.IncrResponse, error) {
+	p.record("incr " + in.GetKey())
+	return &pb.IncrResponse{Value: in.GetDelta()}, nil
+}
+
+func (p *recordingPeer) Migrate(stream grpc.ClientStreamingServer[pb.MigrateEntry, pb.MigrateResponse]) error {
+	var entries []*pb.MigrateEntry
+	for {
+		in, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		entries = append(entries, in)
+	}
+	if p.onMigrate != nil {
+		p.onMigrate()
+	}
+	p.mu.Lock()
+	p.migrated = append(p.migrated, entries...)
+	p.mu.Unlock()
+	return stream.SendAndClose(&pb.MigrateResponse{Received: int64(len(entries))})
+}
+
+// Migrated returns the keys migrated to the peer
+func (p *recordingPeer) Migrated() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var keys []string
+	for _, e := range p.migrated {
+		keys = append(keys, e.GetKey())
+	}
+	return keys
+}
+
+// startRecordingPeer serves a recordingPeer on a local port
+func startRecordingPeer(t *testing.T) (*recordingPeer, string) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := &recordingPeer{}
+	srv := grpc.NewServer()
+	pb.RegisterNexusCacheServer(srv, peer)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return peer, lis.Addr().String()
+}
+
+func TestBoundedLoadKeepsWritesOnOwner(t *testing.T) {
+	g := NewGroup("bounded-writes", 1<<20, 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("origin"), nil
+	}))
+	remote, addr := startRecordingPeer(t)
+	s := NewServer("svc1", "127.0.0.1:8001", nil)
+	s.addPeer("svc1", connect.NodeInfo{Addr: "127.0.0.1:8001", Weight: 1})
+	s.addPeer("svc2", connect.NodeInfo{Addr: addr, Weight: 1})
+	if err := s.EnableBoundedLoad(0.25); err != nil {
+		t.Fatal(err)
+	}
+	g.RegisterPeers(s)
+
+	key := "0"
+	for i := 1; s.peers.Get(key) != "svc2"; i++ {
+		key = strconv.Itoa(i)
+	}
+	// svc2 owns key but is far over its bound
+	loads := s.peers.(consistenthash.BoundedLoader)
+	for i := 0; i < 10; i++ {
+		loads.Inc("svc2")
+	}
+	if _, ok := s.PickLoadPeer(key); ok {
+		t.Fatalf("loads of %s should stay on this node while svc2 is busy", key)
+	}
+	if view, err := g.Get(key); err != nil || view.String() != "origin" {
+		t.Fatalf("Get = %v, %v", view, err)
+	}
+	if err := g.Set(key, NewByteView([]byte("v"), time.Now().Add(time.Minute)), false, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Incr(key, 1, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if calls := remote.Calls(); !reflect.DeepEqual(calls, []string{"set " + key, "delete " + key, "incr " + key}) {
+		t.Fatalf("writes should reach the owner, it received %v", calls)
+	}
+}
@@ -0,0 +1,32 @@
+package nexuscache
+
+import "sync/atomic"
+
+// Stats describes a group on this node
+type Stats struct {
+	Gets      int64 // Get calls, including those of peers
+	Hits      int64 // Gets answered from this node's caches
+	Loads     int64 // Keys loaded from the getter
+	PeerLoads int64 // Keys fetched from the peer owning them
+	Items     int64 // Entries in the main cache
+	Bytes     int64
+	HotItems  int64 // Entries in the hot cache
+	HotBytes  int64
+}
+
+type groupStats struct {
+	gets, hits, loads, peerLoads atomic.Int64
+}
+
+// Stats returns the counters and cache sizes of the group on this node
+func (g *Group) Stats() Stats {
+	s := Stats{
+		Gets:      g.stats.gets.Load(),
+		Hits:      g.stats.hits.Load(),
+		Loads:     g.stats.loads.Load(),
+		PeerLoads: g.stats.peerLoads.Load(),
+	}
+	s.Items, s.Bytes = g.mainCache.stats()
+	s.HotItems, s.HotBytes = g.hotCache.stats()
+	return s
+}
@@ -0,0 +1,72 @@
+package nexuscache
+
+import (
+	"NexusCache/connect"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrorInvalidateScope is returned when an invalidation names neither a tag
+// nor a prefix, or both
+var ErrorInvalidateScope = errors.New("nexuscache: invalidate needs either a tag or a prefix")
+
+// Values carry the tags they were set with, see ByteView.WithTags, and every
+// node indexes the tags of the entries in its caches. Invalidations only drop
+// cached entries: the backend of a group with a writer keeps its values, and
+// a Set racing with an invalidation may survive it.
+
+// InvalidateTag drops the keys set with tag from every node, hot copies
+// included, and returns how many cached entries were dropped. When some nodes
+// can't be reached the others are still invalidated and the error names the
+// first that failed.
+func (g *Group) InvalidateTag(tag string) (int, error) {
+	if tag == "" {
+		return 0, ErrorInvalidateScope
+	}
+	return g.invalidate(tag, "")
+}
+
+// InvalidatePrefix drops the keys starting with prefix from every node, see
+// InvalidateTag
+func (g *Group) InvalidatePrefix(prefix string) (int, error) {
+	if prefix == "" {
+		return 0, ErrorInvalidateScope
+	}
+	return g.invalidate("", prefix)
+}
+
+// invalidate drops keys on this node and on every peer
+func (g *Group) invalidate(tag, prefix string) (int, error) {
+	removed, err := g.invalidateOwned(tag, prefix)
+	if err != nil {
+		return 0, err
+	}
+	var mu sync.Mutex
+	err = g.forEachPeer(func(peer connect.PeerGetter) error {
+		n, err := peer.Invalidate(g.name, tag, prefix)
+		mu.Lock()
+		removed += int(n)
+		mu.Unlock()
+		return err
+	})
+	return removed, err
+}
+
+// invalidateOwned is invalidate for a peer fanning it out: it drops the keys
+// from this node's caches only and reports them deleted to watchers
+func (g *Group) invalidateOwned(tag, prefix string) (int, error) {
+	var keys []string
+	switch {
+	case tag != "" && prefix == "":
+		keys = append(g.mainCache.removeTag(tag), g.hotCache.removeTag(tag)...)
+	case prefix != "" && tag == "":
+		keys = append(g.mainCache.removePrefix(prefix), g.hotCache.removePrefix(prefix)...)
+	default:
+		return 0, ErrorInvalidateScope
+	}
+	for _, key := range keys {
+		g.publishChange(key, nil)
+	}
+	return len(keys), nil
+}
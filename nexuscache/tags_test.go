@@ -0,0 +1,120 @@
+package nexuscache
+
+import (
+	"NexusCache/connect"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// listedPeers owns every key locally but lists peers to fan out to
+type listedPeers struct{ peers map[string]connect.PeerGetter }
+
+func (listedPeers) PickPeer(key string) (connect.PeerGetter, bool) { return nil, false }
+
+func (p listedPeers) AllPeers() map[string]connect.PeerGetter { return p.peers }
+
+// invalidatingPeer records the invalidations it receives
+type invalidatingPeer struct {
+	connect.PeerGetter
+	calls *[]string
+}
+
+func (p invalidatingPeer) Invalidate(group string, tag string, prefix string) (int64, error) {
+	*p.calls = append(*p.calls, group+"/"+tag+"/"+prefix)
+	return 2, nil
+}
+
+func TestInvalidateTag(t *testing.T) {
+	g := NewGroup("tags", 1<<20, 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrorNotFound
+	}))
+	var calls []string
+	g.RegisterPeers(listedPeers{map[string]connect.PeerGetter{"b": invalidatingPeer{calls: &calls}}})
+	expire := time.Now().Add(time.Minute)
+	set := func(key string, ishot bool, tags ...string) {
+		t.Helper()
+		if err := g.Set(key, NewByteView([]byte(key), expire).WithTags(tags...), ishot, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	set("user:42:profile", false, "user:42")
+	set("user:42:feed", false, "user:42", "feeds")
+	set("user:42:hot", true, "user:42")
+	set("user:7:feed", false, "user:7", "feeds")
+	set("other", false)
+
+	after := LastEventSeq()
+	w, err := g.Watch("user:", true, after, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	removed, err := g.InvalidateTag("user:42")
+	if err != nil || removed != 3+2 {
+		t.Fatalf("InvalidateTag = %d, %v, want 3 local and 2 remote", removed, err)
+	}
+	if !reflect.DeepEqual(calls, []string{"tags/user:42/"}) {
+		t.Fatalf("unexpected peer calls %v", calls)
+	}
+	for _, key := range []string{"user:42:profile", "user:42:feed", "user:42:hot"} {
+		if _, err := g.Peek(key); errors.Cause(err) != ErrorNotFound {
+			t.Fatalf("%s should be invalidated, got %v", key, err)
+		}
+	}
+	var deleted []string
+	for len(deleted) < 3 {
+		e := <-w.C
+		if e.Type != EventDelete {
+			t.Fatalf("expected a delete event, got %v", e.Type)
+		}
+		deleted = append(deleted, e.Key)
+	}
+	sort.Strings(deleted)
+	if !reflect.DeepEqual(deleted, []string{"user:42:feed", "user:42:hot", "user:42:profile"}) {
+		t.Fatalf("unexpected delete events %v", deleted)
+	}
+
+	// Setting a key again without the tag takes it out of the index
+	set("user:7:feed", false)
+	if removed, _ := g.InvalidateTag("feeds"); removed != 2 {
+		t.Fatalf("feeds should only be on the remote peer now, removed %d", removed)
+	}
+	if removed, _ := g.InvalidatePrefix("user:7:"); removed != 1+2 {
+		t.Fatalf("InvalidatePrefix removed %d", removed)
+	}
+	if _, err := g.Peek("other"); err != nil {
+		t.Fatalf("other should survive, got %v", err)
+	}
+	if _, err := g.InvalidatePrefix(""); errors.Cause(err) != ErrorInvalidateScope {
+		t.Fatalf("empty prefix: expected ErrorInvalidateScope, got %v", err)
+	}
+}
+
+func TestTagIndexFollowsEvictions(t *testing.T) {
+	g := NewGroup("tags-evictions", 40, 0, GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrorNotFound
+	}))
+	g.RegisterPeers(localPeers{})
+	expire := time.Now().Add(time.Minute)
+	for _, key := range []string{"k1", "k2", "k3", "k4", "k5"} {
+		g.Set(key, NewByteView([]byte("0123456789"), expire).WithTags("t", key), false, false)
+	}
+	g.Delete("k5")
+
+	c := &g.mainCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var cached []string
+	for key := range c.tagged["t"] {
+		cached = append(cached, key)
+	}
+	sort.Strings(cached)
+	// 40 bytes hold the last three entries of 12 bytes, k5 was deleted
+	if !reflect.DeepEqual(cached, []string{"k3", "k4"}) || len(c.keyTags) != 2 || len(c.tagged) != 3 {
+		t.Fatalf("index out of step with the cache: %v, %v, %v", cached, c.keyTags, c.tagged)
+	}
+}
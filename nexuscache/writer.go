@@ -0,0 +1,225 @@
+package nexuscache
+
+import (
+	"NexusCache/metrics"
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/segmentio/fasthash/fnv1"
+)
+
+var (
+	ErrorWriteQueueFull = errors.New("nexuscache: write-behind queue is full")
+	ErrorWriterClosed   = errors.New("nexuscache: writer is closed")
+)
+
+// Write modes, also used as metric labels
+const (
+	WriteThrough = "through"
+	WriteBehind  = "behind"
+)
+
+// WriteBehindOptions configures Group.SetWriteBehind, zero fields take the defaults
+type WriteBehindOptions struct {
+	QueueSize     int           // Writes that may wait, Set fails with ErrorWriteQueueFull beyond it (1024)
+	BatchSize     int           // Writes handed to the Setter at once (64)
+	FlushInterval time.Duration // Longest a write waits for its batch to fill (100ms)
+	Retries       int           // Extra attempts for failed writes before they are dropped (3), negative for none
+	RetryBackoff  time.Duration // Wait before the first retry, doubled for each next one (100ms)
+}
+
+func (o *WriteBehindOptions) withDefaults() {
+	if o.QueueSize <= 0 {
+		o.QueueSize = 1024
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 64
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = 100 * time.Millisecond
+	}
+	if o.Retries < 0 {
+		o.Retries = 0
+	} else if o.Retries == 0 {
+		o.Retries = 3
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = 100 * time.Millisecond
+	}
+}
+
+// keyLocks serializes the writes of a key on its owner, so that the backend
+// sees them in the order they were cached. Keys share a fixed set of mutexes
+// instead of keeping state per key.
+type keyLocks [64]sync.Mutex
+
+// lock locks key and returns the func unlocking it
+func (l *keyLocks) lock(key string) func() {
+	m := &l[fnv1.HashString64(key)%uint64(len(l))]
+	m.Lock()
+	return m.Unlock
+}
+
+// writer passes the values set in a Group on to its backend
+type writer struct {
+	setter Setter
+	mode   string
+	group  string
+	opts   WriteBehindOptions
+
+	mu     sync.RWMutex // Guards closed against writes racing close
+	closed bool
+	queue  chan Write    // Write-behind only
+	done   chan struct{} // Closed once the queue is drained
+}
+
+func newWriteBehind(group string, s Setter, opts WriteBehindOptions) *writer {
+	opts.withDefaults()
+	w := &writer{
+		setter: s,
+		mode:   WriteBehind,
+		group:  group,
+		opts:   opts,
+		queue:  make(chan Write, opts.QueueSize),
+		done:   make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// write hands a value to the backend: synchronously for write-through,
+// through the queue for write-behind
+func (w *writer) write(key string, value []byte) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return ErrorWriterClosed
+	}
+	if w.mode == WriteThrough {
+		err := w.setter.Set(key, value)
+		status := "success"
+		if err != nil {
+			status = "error"
+		}
+		metrics.RecordOriginWrites(w.mode, status, 1)
+		return err
+	}
+	select {
+	case w.queue <- Write{Key: key, Value: value}:
+		metrics.UpdateWriteBehindQueue(w.group, len(w.queue))
+		return nil
+	default:
+		return ErrorWriteQueueFull
+	}
+}
+
+// run batches queued writes until the queue is closed and drained
+func (w *writer) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.opts.FlushInterval)
+	defer ticker.Stop()
+	var batch []Write
+	for {
+		select {
+		case wr, ok := <-w.queue:
+			if !ok {
+				w.flush(batch)
+				return
+			}
+			batch = append(batch, wr)
+			if len(batch) < w.opts.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		metrics.UpdateWriteBehindQueue(w.group, len(w.queue))
+		w.flush(batch)
+		batch = nil
+	}
+}
+
+// flush writes a batch, retrying the writes that failed
+func (w *writer) flush(batch []Write) {
+	batch = coalesce(batch)
+	backoff := w.opts.RetryBackoff
+	for attempt := 0; len(batch) > 0; attempt++ {
+		failed := w.setBatch(batch)
+		metrics.RecordOriginWrites(w.mode, "success", len(batch)-len(failed))
+		if len(failed) == 0 {
+			return
+		}
+		if attempt >= w.opts.Retries {
+			log.Printf("group %s: dropping %d writes after %d attempts", w.group, len(failed), attempt+1)
+			metrics.RecordOriginWrites(w.mode, "dropped", len(failed))
+			return
+		}
+		metrics.RecordOriginWrites(w.mode, "error", len(failed))
+		time.Sleep(backoff)
+		backoff *= 2
+		batch = failed
+	}
+}
+
+// setBatch writes batch and returns the writes that failed
+func (w *writer) setBatch(batch []Write) (failed []Write) {
+	if bs, ok := w.setter.(BatchSetter); ok {
+		if err := bs.SetBatch(batch); err != nil {
+			log.Printf("group %s: write batch of %d: %v", w.group, len(batch), err)
+			return batch
+		}
+		return nil
+	}
+	for _, wr := range batch {
+		if err := w.setter.Set(wr.Key, wr.Value); err != nil {
+			log.Printf("group %s: write %s: %v", w.group, wr.Key, err)
+			failed = append(failed, wr)
+		}
+	}
+	return failed
+}
+
+// coalesce keeps only the last write of every key, in write order
+func coalesce(batch []Write) []Write {
+	last := make(map[string]int, len(batch))
+	for i, wr := range batch {
+		last[wr.Key] = i
+	}
+	if len(last) == len(batch) {
+		return batch
+	}
+	out := make([]Write, 0, len(last))
+	for i, wr := range batch {
+		if last[wr.Key] == i {
+			out = append(out, wr)
+		}
+	}
+	return out
+}
+
+// close stops accepting writes and waits until the queued ones reached the
+// backend or ctx is done
+func (w *writer) close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		if w.queue != nil {
+			close(w.queue)
+		}
+	}
+	w.mu.Unlock()
+	if w.done == nil {
+		return nil
+	}
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrapf(ctx.Err(), "group %s: %d writes not flushed", w.group, len(w.queue))
+	}
+}
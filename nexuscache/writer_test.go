@@ -0,0 +1,183 @@
+package nexuscache
+
+import (
+	"NexusCache/connect"
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// localPeers makes every key owned by this node
+type localPeers struct{}
+
+func (localPeers) PickPeer(key string) (connect.PeerGetter, bool) { return nil, false }
+
+// recordingSetter records the batches it is given and fails the first fail calls
+type recordingSetter struct {
+	mu      sync.Mutex
+	fail    int
+	batches [][]Write
+}
+
+func (s *recordingSetter) Set(key string, value []byte) error {
+	return s.SetBatch([]Write{{Key: key, Value: value}})
+}
+
+func (s *recordingSetter) SetBatch(writes []Write) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail > 0 {
+		s.fail--
+		return errors.New("backend down")
+	}
+	s.batches = append(s.batches, append([]Write(nil), writes...))
+	return nil
+}
+
+func (s *recordingSetter) keys() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out [][]string
+	for _, b := range s.batches {
+		var keys []string
+		for _, w := range b {
+			keys = append(keys, w.Key+"="+string(w.Value))
+		}
+		out = append(out, keys)
+	}
+	return out
+}
+
+func TestWriteThrough(t *testing.T) {
+	g := NewGroup("write-through", 1<<10, 1<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("origin"), nil
+	}))
+	g.RegisterPeers(localPeers{})
+	setter := &recordingSetter{fail: 1}
+	g.SetWriteThrough(setter)
+	expire := time.Now().Add(time.Hour)
+
+	if err := g.Set("k", NewByteView([]byte("v1"), expire), false, false); err == nil {
+		t.Fatalf("a failed origin write should fail the Set")
+	}
+	if v, _ := g.Get("k"); v.String() != "origin" {
+		t.Fatalf("a failed write must not be cached, got %q", v.String())
+	}
+	if err := g.Set("k", NewByteView([]byte("v2"), expire), false, false); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := g.Get("k"); v.String() != "v2" {
+		t.Fatalf("expected the written value, got %q", v.String())
+	}
+	if err := g.Set("h", NewByteView([]byte("v3"), expire), true, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := setter.keys(); !reflect.DeepEqual(got, [][]string{{"k=v2"}, {"h=v3"}}) {
+		t.Fatalf("unexpected writes %v", got)
+	}
+}
+
+func TestSetDuringLoad(t *testing.T) {
+	loading, release := make(chan struct{}), make(chan struct{})
+	g := NewGroup("write-during-load", 1<<10, 0, GetterFunc(func(key string) ([]byte, error) {
+		close(loading)
+		<-release
+		return []byte("origin"), nil
+	}))
+	g.RegisterPeers(localPeers{})
+	setter := &recordingSetter{}
+	g.SetWriteThrough(setter)
+
+	loaded := make(chan *ByteView)
+	go func() {
+		v, err := g.Get("k")
+		if err != nil {
+			t.Error(err)
+		}
+		loaded <- v
+	}()
+	<-loading
+	// The Set must neither wait for the load nor take over its result
+	if err := g.Set("k", NewByteView([]byte("new"), time.Now().Add(time.Hour)), false, false); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	if v := <-loaded; v.String() != "new" {
+		t.Fatalf("a load finishing after the Set should return the written value, got %q", v.String())
+	}
+	if got := setter.keys(); !reflect.DeepEqual(got, [][]string{{"k=new"}}) {
+		t.Fatalf("the Set should reach the backend, got %v", got)
+	}
+	if v, _ := g.Peek("k"); v.String() != "new" {
+		t.Fatalf("the loaded value overwrote the Set, got %q", v.String())
+	}
+}
+
+func TestWriteBehind(t *testing.T) {
+	g := NewGroup("write-behind", 1<<10, 0, GetterFunc(func(key string) ([]byte, error) {
+		return nil, errors.New("not found")
+	}))
+	g.RegisterPeers(localPeers{})
+	setter := &recordingSetter{fail: 1}
+	g.SetWriteBehind(setter, WriteBehindOptions{
+		QueueSize:     4,
+		BatchSize:     3,
+		FlushInterval: time.Hour,
+		RetryBackoff:  time.Millisecond,
+	})
+	expire := time.Now().Add(time.Hour)
+	set := func(key, value string) error {
+		return g.Set(key, NewByteView([]byte(value), expire), false, false)
+	}
+
+	// A full batch is written at once, the second write of a is coalesced
+	for _, kv := range [][2]string{{"a", "1"}, {"b", "1"}, {"a", "2"}} {
+		if err := set(kv[0], kv[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v, err := g.Get("a"); err != nil || v.String() != "2" {
+		t.Fatalf("write-behind should cache right away, got %v %v", v, err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(setter.keys()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := setter.keys(); !reflect.DeepEqual(got, [][]string{{"b=1", "a=2"}}) {
+		t.Fatalf("expected the failed batch to be retried coalesced, got %v", got)
+	}
+
+	// The rest waits for the flush interval, until CloseWriter flushes it
+	if err := set("c", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.CloseWriter(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := setter.keys(); len(got) != 2 || !reflect.DeepEqual(got[1], []string{"c=1"}) {
+		t.Fatalf("closing should flush queued writes, got %v", got)
+	}
+	if err := set("d", "1"); err != ErrorWriterClosed {
+		t.Fatalf("expected ErrorWriterClosed after close, got %v", err)
+	}
+}
+
+func TestWriteBehindQueueFull(t *testing.T) {
+	block := make(chan struct{})
+	w := newWriteBehind("queue-full", SetterFunc(func(key string, value []byte) error {
+		<-block
+		return nil
+	}), WriteBehindOptions{QueueSize: 2, BatchSize: 1})
+	defer close(block)
+
+	var err error
+	for i := 0; i < 10 && err == nil; i++ {
+		err = w.write("k", nil)
+	}
+	if err != ErrorWriteQueueFull {
+		t.Fatalf("expected ErrorWriteQueueFull once the queue is full, got %v", err)
+	}
+}
@@ -21,8 +21,14 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	NexusCache_Get_FullMethodName = "/nexuscachepb.NexusCache/Get"
-	NexusCache_Set_FullMethodName = "/nexuscachepb.NexusCache/Set"
+	NexusCache_Get_FullMethodName           = "/nexuscachepb.NexusCache/Get"
+	NexusCache_Set_FullMethodName           = "/nexuscachepb.NexusCache/Set"
+	NexusCache_Migrate_FullMethodName       = "/nexuscachepb.NexusCache/Migrate"
+	NexusCache_Delete_FullMethodName        = "/nexuscachepb.NexusCache/Delete"
+	NexusCache_CompareAndSet_FullMethodName = "/nexuscachepb.NexusCache/CompareAndSet"
+	NexusCache_Incr_FullMethodName          = "/nexuscachepb.NexusCache/Incr"
+	NexusCache_Invalidate_FullMethodName    = "/nexuscachepb.NexusCache/Invalidate"
+	NexusCache_Flush_FullMethodName         = "/nexuscachepb.NexusCache/Flush"
 )
 
 // NexusCacheClient is the client API for NexusCache service.
@@ -31,6 +37,15 @@ const (
 type NexusCacheClient interface {
 	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
 	Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error)
+	Migrate(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[MigrateEntry, MigrateResponse], error)
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	// CompareAndSet and Incr fail with FailedPrecondition when the version
+	// doesn't match, and Incr with InvalidArgument when the value is not an
+	// integer or would overflow
+	CompareAndSet(ctx context.Context, in *CompareAndSetRequest, opts ...grpc.CallOption) (*CompareAndSetResponse, error)
+	Incr(ctx context.Context, in *IncrRequest, opts ...grpc.CallOption) (*IncrResponse, error)
+	Invalidate(ctx context.Context, in *InvalidateRequest, opts ...grpc.CallOption) (*InvalidateResponse, error)
+	Flush(ctx context.Context, in *FlushRequest, opts ...grpc.CallOption) (*FlushResponse, error)
 }
 
 type nexusCacheClient struct {
@@ -61,12 +76,84 @@ func (c *nexusCacheClient) Set(ctx context.Context, in *SetRequest, opts ...grpc
 	return out, nil
 }
 
+func (c *nexusCacheClient) Migrate(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[MigrateEntry, MigrateResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &NexusCache_ServiceDesc.Streams[0], NexusCache_Migrate_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[MigrateEntry, MigrateResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type NexusCache_MigrateClient = grpc.ClientStreamingClient[MigrateEntry, MigrateResponse]
+
+func (c *nexusCacheClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, NexusCache_Delete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nexusCacheClient) CompareAndSet(ctx context.Context, in *CompareAndSetRequest, opts ...grpc.CallOption) (*CompareAndSetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CompareAndSetResponse)
+	err := c.cc.Invoke(ctx, NexusCache_CompareAndSet_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nexusCacheClient) Incr(ctx context.Context, in *IncrRequest, opts ...grpc.CallOption) (*IncrResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(IncrResponse)
+	err := c.cc.Invoke(ctx, NexusCache_Incr_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nexusCacheClient) Invalidate(ctx context.Context, in *InvalidateRequest, opts ...grpc.CallOption) (*InvalidateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(InvalidateResponse)
+	err := c.cc.Invoke(ctx, NexusCache_Invalidate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nexusCacheClient) Flush(ctx context.Context, in *FlushRequest, opts ...grpc.CallOption) (*FlushResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FlushResponse)
+	err := c.cc.Invoke(ctx, NexusCache_Flush_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // NexusCacheServer is the server API for NexusCache service.
 // All implementations must embed UnimplementedNexusCacheServer
 // for forward compatibility.
 type NexusCacheServer interface {
 	Get(context.Context, *GetRequest) (*GetResponse, error)
 	Set(context.Context, *SetRequest) (*SetResponse, error)
+	Migrate(grpc.ClientStreamingServer[MigrateEntry, MigrateResponse]) error
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	// CompareAndSet and Incr fail with FailedPrecondition when the version
+	// doesn't match, and Incr with InvalidArgument when the value is not an
+	// integer or would overflow
+	CompareAndSet(context.Context, *CompareAndSetRequest) (*CompareAndSetResponse, error)
+	Incr(context.Context, *IncrRequest) (*IncrResponse, error)
+	Invalidate(context.Context, *InvalidateRequest) (*InvalidateResponse, error)
+	Flush(context.Context, *FlushRequest) (*FlushResponse, error)
 	mustEmbedUnimplementedNexusCacheServer()
 }
 
@@ -83,6 +170,24 @@ func (UnimplementedNexusCacheServer) Get(context.Context, *GetRequest) (*GetResp
 func (UnimplementedNexusCacheServer) Set(context.Context, *SetRequest) (*SetResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method Set not implemented")
 }
+func (UnimplementedNexusCacheServer) Migrate(grpc.ClientStreamingServer[MigrateEntry, MigrateResponse]) error {
+	return status.Error(codes.Unimplemented, "method Migrate not implemented")
+}
+func (UnimplementedNexusCacheServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedNexusCacheServer) CompareAndSet(context.Context, *CompareAndSetRequest) (*CompareAndSetResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method CompareAndSet not implemented")
+}
+func (UnimplementedNexusCacheServer) Incr(context.Context, *IncrRequest) (*IncrResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Incr not implemented")
+}
+func (UnimplementedNexusCacheServer) Invalidate(context.Context, *InvalidateRequest) (*InvalidateResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Invalidate not implemented")
+}
+func (UnimplementedNexusCacheServer) Flush(context.Context, *FlushRequest) (*FlushResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Flush not implemented")
+}
 func (UnimplementedNexusCacheServer) mustEmbedUnimplementedNexusCacheServer() {}
 func (UnimplementedNexusCacheServer) testEmbeddedByValue()                    {}
 
@@ -140,6 +245,103 @@ func _NexusCache_Set_Handler(srv interface{}, ctx context.Context, dec func(inte
 	return interceptor(ctx, in, info, handler)
 }
 
+func _NexusCache_Migrate_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(NexusCacheServer).Migrate(&grpc.GenericServerStream[MigrateEntry, MigrateResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type NexusCache_MigrateServer = grpc.ClientStreamingServer[MigrateEntry, MigrateResponse]
+
+func _NexusCache_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NexusCacheServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NexusCache_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NexusCacheServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NexusCache_CompareAndSet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CompareAndSetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NexusCacheServer).CompareAndSet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NexusCache_CompareAndSet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NexusCacheServer).CompareAndSet(ctx, req.(*CompareAndSetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NexusCache_Incr_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IncrRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NexusCacheServer).Incr(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NexusCache_Incr_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NexusCacheServer).Incr(ctx, req.(*IncrRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NexusCache_Invalidate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InvalidateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NexusCacheServer).Invalidate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NexusCache_Invalidate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NexusCacheServer).Invalidate(ctx, req.(*InvalidateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NexusCache_Flush_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FlushRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NexusCacheServer).Flush(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NexusCache_Flush_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NexusCacheServer).Flush(ctx, req.(*FlushRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // NexusCache_ServiceDesc is the grpc.ServiceDesc for NexusCache service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -155,7 +357,33 @@ var NexusCache_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Set",
 			Handler:    _NexusCache_Set_Handler,
 		},
+		{
+			MethodName: "Delete",
+			Handler:    _NexusCache_Delete_Handler,
+		},
+		{
+			MethodName: "CompareAndSet",
+			Handler:    _NexusCache_CompareAndSet_Handler,
+		},
+		{
+			MethodName: "Incr",
+			Handler:    _NexusCache_Incr_Handler,
+		},
+		{
+			MethodName: "Invalidate",
+			Handler:    _NexusCache_Invalidate_Handler,
+		},
+		{
+			MethodName: "Flush",
+			Handler:    _NexusCache_Flush_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Migrate",
+			Handler:       _NexusCache_Migrate_Handler,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "nexuscachepb/nexuscachepb.proto",
 }
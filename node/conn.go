@@ -0,0 +1,119 @@
+package node
+
+import (
+	"NexusCache/connect"
+	"context"
+	"log"
+	"net"
+	"sync"
+)
+
+// ConnServer accepts connections on Addr as a Service and serves each one
+// with Handle in its own goroutine, for protocols spoken over plain sockets.
+// Handle should return once the connection is closed; Shutdown closes the
+// open connections and waits for their handlers.
+type ConnServer struct {
+	Name   string // Used in logs, e.g. "resp"
+	Addr   string // host:port or unix:///path/to.sock
+	Handle func(c net.Conn)
+
+	mu    sync.Mutex
+	lis   net.Listener
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+func (s *ConnServer) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lis != nil {
+		return ErrorServiceRunning
+	}
+	lis, err := connect.Listen(ctx, s.Addr)
+	if err != nil {
+		return err
+	}
+	s.lis, s.conns = lis, make(map[net.Conn]struct{})
+	log.Printf("%s server is running at %s", s.Name, lis.Addr())
+	s.wg.Add(1)
+	go s.serve(lis)
+	return nil
+}
+
+func (s *ConnServer) serve(lis net.Listener) {
+	defer s.wg.Done()
+	for {
+		c, err := lis.Accept()
+		s.mu.Lock()
+		if s.lis != lis {
+			// Shut down while accepting
+			s.mu.Unlock()
+			if c != nil {
+				c.Close()
+			}
+			return
+		}
+		if err != nil {
+			s.mu.Unlock()
+			log.Printf("%s server error: %v", s.Name, err)
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, c)
+				s.mu.Unlock()
+				c.Close()
+			}()
+			s.Handle(c)
+		}()
+	}
+}
+
+func (s *ConnServer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	lis := s.lis
+	s.lis = nil
+	if lis != nil {
+		lis.Close()
+		for c := range s.conns {
+			c.Close()
+		}
+	}
+	s.mu.Unlock()
+	if lis == nil {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// BoundAddr returns the address the server listens on, "" when it is not running
+func (s *ConnServer) BoundAddr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lis == nil {
+		return ""
+	}
+	return s.lis.Addr().String()
+}
+
+// Conns returns the number of open connections
+func (s *ConnServer) Conns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
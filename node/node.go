@@ -0,0 +1,138 @@
+// Package node manages the lifecycle of the servers making up a cache node:
+// the gRPC peer server, the HTTP API and the metrics endpoint.
+package node
+
+import (
+	"NexusCache/connect"
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+)
+
+var (
+	ErrorNodeRunning    = errors.New("node is already running")
+	ErrorServiceRunning = errors.New("service is already running")
+)
+
+// Service is a server with a managed lifecycle. Start must return once the
+// service accepts requests; Shutdown stops it gracefully within ctx.
+type Service interface {
+	Start(ctx context.Context) error
+	Shutdown(ctx context.Context) error
+}
+
+// Node starts its services in order and shuts them down in reverse order
+type Node struct {
+	mu       sync.Mutex
+	services []Service
+	running  bool
+}
+
+func New(services ...Service) *Node {
+	return &Node{services: services}
+}
+
+// Start starts every service. If one fails, the services already started are
+// shut down again and the error is returned.
+func (n *Node) Start(ctx context.Context) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.running {
+		return ErrorNodeRunning
+	}
+	for i, svc := range n.services {
+		if err := svc.Start(ctx); err != nil {
+			shutdown(ctx, n.services[:i])
+			return err
+		}
+	}
+	n.running = true
+	return nil
+}
+
+// Shutdown stops every service in reverse start order and returns the first error
+func (n *Node) Shutdown(ctx context.Context) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.running {
+		return nil
+	}
+	n.running = false
+	return shutdown(ctx, n.services)
+}
+
+// Running reports whether the node has been started and not shut down
+func (n *Node) Running() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.running
+}
+
+func shutdown(ctx context.Context, services []Service) error {
+	var first error
+	for i := len(services) - 1; i >= 0; i-- {
+		if err := services[i].Shutdown(ctx); err != nil {
+			log.Println("shutdown err:", err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// HTTPServer serves Handler on Addr as a Service
+type HTTPServer struct {
+	Name    string // Used in logs, e.g. "api" or "metrics"
+	Addr    string // host:port or unix:///path/to.sock
+	Handler http.Handler
+
+	mu  sync.Mutex
+	srv *http.Server
+	lis net.Listener
+}
+
+func (h *HTTPServer) Start(ctx context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.srv != nil {
+		return ErrorServiceRunning
+	}
+	lis, err := connect.Listen(ctx, h.Addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: h.Handler}
+	h.srv, h.lis = srv, lis
+	log.Printf("%s server is running at %s", h.Name, lis.Addr())
+	go func() {
+		if err := srv.Serve(lis); err != nil && err != http.ErrServerClosed {
+			log.Printf("%s server error: %v", h.Name, err)
+		}
+	}()
+	return nil
+}
+
+func (h *HTTPServer) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	srv := h.srv
+	h.srv, h.lis = nil, nil
+	h.mu.Unlock()
+	if srv == nil {
+		return nil
+	}
+	return srv.Shutdown(ctx)
+}
+
+// BoundAddr returns the address the server listens on, "" when it is not running
+func (h *HTTPServer) BoundAddr() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.lis == nil {
+		return ""
+	}
+	return h.lis.Addr().String()
+}
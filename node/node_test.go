@@ -0,0 +1,147 @@
+package node
+
+import (
+	"NexusCache/api"
+	"NexusCache/metrics"
+	"NexusCache/nexuscache"
+	pb "NexusCache/nexuscachepb"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func httpGet(t *testing.T, url string) string {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestNodeStartShutdownRepeatedly(t *testing.T) {
+	group := nexuscache.NewGroup("node-lifecycle", 2<<10, 2<<7, nexuscache.GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("v-" + key), nil
+		}))
+	svr := nexuscache.NewServer("test", "127.0.0.1", nil)
+	svr.SetListenAddr("127.0.0.1:0")
+	apiServer := &HTTPServer{Name: "api", Addr: "127.0.0.1:0", Handler: api.NewHandler(group, svr)}
+	metricsServer := &HTTPServer{Name: "metrics", Addr: "127.0.0.1:0", Handler: metrics.Handler()}
+	n := New(svr, apiServer, metricsServer)
+
+	for i := 0; i < 3; i++ {
+		if err := n.Start(context.Background()); err != nil {
+			t.Fatalf("run %d: start failed: %v", i, err)
+		}
+		if !n.Running() || !svr.Running() {
+			t.Fatalf("run %d: node should be running", i)
+		}
+		if err := n.Start(context.Background()); err != ErrorNodeRunning {
+			t.Fatalf("run %d: second start should fail, got %v", i, err)
+		}
+
+		if body := httpGet(t, "http://"+apiServer.BoundAddr()+"/api/get?key=Tom"); body != "value=v-Tom\n" {
+			t.Fatalf("run %d: unexpected api response %q", i, body)
+		}
+		if body := httpGet(t, "http://"+metricsServer.BoundAddr()+"/health"); body != "OK" {
+			t.Fatalf("run %d: unexpected health response %q", i, body)
+		}
+		conn, err := grpc.NewClient(svr.Addr(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := pb.NewNexusCacheClient(conn).Get(context.Background(), &pb.GetRequest{Group: "node-lifecycle", Key: "Jack"})
+		conn.Close()
+		if err != nil || string(resp.GetValue()) != "v-Jack" {
+			t.Fatalf("run %d: grpc get failed: %v", i, err)
+		}
+
+		apiAddr := apiServer.BoundAddr()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := n.Shutdown(ctx); err != nil {
+			t.Fatalf("run %d: shutdown failed: %v", i, err)
+		}
+		cancel()
+		if n.Running() || svr.Running() || svr.Addr() != "" || apiServer.BoundAddr() != "" {
+			t.Fatalf("run %d: node should be stopped", i)
+		}
+		if _, err := http.Get("http://" + apiAddr + "/api/get?key=Tom"); err == nil {
+			t.Fatalf("run %d: api should not answer after shutdown", i)
+		}
+		if err := n.Shutdown(context.Background()); err != nil {
+			t.Fatalf("run %d: shutting down a stopped node should be a no-op, got %v", i, err)
+		}
+	}
+}
+
+type failingService struct{}
+
+func (failingService) Start(ctx context.Context) error    { return errors.New("boom") }
+func (failingService) Shutdown(ctx context.Context) error { return nil }
+
+func TestNodeStartRollsBack(t *testing.T) {
+	first := &HTTPServer{Name: "first", Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()}
+	n := New(first, failingService{})
+	if err := n.Start(context.Background()); err == nil {
+		t.Fatalf("start should fail")
+	}
+	if n.Running() || first.BoundAddr() != "" {
+		t.Fatalf("started services should be shut down after a failed start")
+	}
+}
+
+func TestNodeUnixSockets(t *testing.T) {
+	nexuscache.NewGroup("node-unix", 2<<10, 2<<7, nexuscache.GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("v-" + key), nil
+		}))
+	dir := t.TempDir()
+	svr := nexuscache.NewServer("test-unix", "127.0.0.1:8888", nil)
+	svr.SetListenAddr("unix://" + filepath.Join(dir, "grpc.sock"))
+	metricsSock := filepath.Join(dir, "metrics.sock")
+	metricsServer := &HTTPServer{Name: "metrics", Addr: "unix:" + metricsSock, Handler: metrics.Handler()}
+	n := New(svr, metricsServer)
+	if err := n.Start(context.Background()); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer n.Shutdown(context.Background())
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", metricsSock)
+		},
+	}}
+	resp, err := client.Get("http://metrics/health")
+	if err != nil {
+		t.Fatalf("GET over unix socket: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "OK" {
+		t.Fatalf("unexpected health response %q", body)
+	}
+
+	conn, err := grpc.NewClient("unix://"+svr.Addr(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := pb.NewNexusCacheClient(conn).Get(ctx, &pb.GetRequest{Group: "node-unix", Key: "k"})
+	if err != nil || string(out.GetValue()) != "v-k" {
+		t.Fatalf("grpc get over unix socket failed: %v", err)
+	}
+}
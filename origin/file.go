@@ -0,0 +1,59 @@
+package origin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// File loads key from the file {Dir}/{key} and, as a nexuscache.Setter,
+// writes it back there. Keys may contain slashes to reach subdirectories but
+// never leave Dir.
+type File struct {
+	Dir string
+}
+
+func (f File) Get(key string) ([]byte, error) {
+	path, err := f.path(key)
+	if err != nil {
+		return nil, err
+	}
+	value, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, errors.Wrapf(ErrorNotFound, "%s not exist", key)
+	}
+	return value, err
+}
+
+// Set replaces the file of key atomically, so readers never see a partial value
+func (f File) Set(key string, value []byte) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".nexuscache-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (f File) path(key string) (string, error) {
+	if !filepath.IsLocal(key) {
+		return "", fmt.Errorf("key %q is not a path inside the origin directory", key)
+	}
+	return filepath.Join(f.Dir, key), nil
+}
@@ -0,0 +1,51 @@
+package origin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestFileOrigin(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "users"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "users", "Tom"), []byte("630"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f := File{Dir: dir}
+
+	if v, err := f.Get("users/Tom"); err != nil || string(v) != "630" {
+		t.Fatalf("get users/Tom: %q %v", v, err)
+	}
+	if _, err := f.Get("users/Sam"); errors.Cause(err) != ErrorNotFound {
+		t.Fatalf("missing files should map to ErrorNotFound, got %v", err)
+	}
+	for _, key := range []string{"../secret", "/etc/passwd", "users/../../secret"} {
+		if _, err := f.Get(key); err == nil || errors.Cause(err) == ErrorNotFound {
+			t.Fatalf("key %s escapes the directory and should be refused, got %v", key, err)
+		}
+	}
+}
+
+func TestFileOriginSet(t *testing.T) {
+	f := File{Dir: t.TempDir()}
+	if err := f.Set("users/Tom", []byte("630")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Set("users/Tom", []byte("631")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := f.Get("users/Tom"); err != nil || string(v) != "631" {
+		t.Fatalf("expected the last write, got %q %v", v, err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(f.Dir, "users")); len(entries) != 1 {
+		t.Fatalf("temporary files should not be left behind, got %d entries", len(entries))
+	}
+	if err := f.Set("../escape", []byte("x")); err == nil {
+		t.Fatalf("writes outside the directory should be refused")
+	}
+}
@@ -0,0 +1,128 @@
+package origin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Defaults of the HTTP origin
+const (
+	DefaultHTTPTimeout  = 2 * time.Second
+	DefaultRetryBackoff = 100 * time.Millisecond
+	MaxValueBytes       = 64 << 20 // Larger responses are refused rather than cached
+)
+
+var ErrorOriginStatus = errors.New("unexpected origin status")
+
+// HTTP loads key with GET {BaseURL}/{key}. 404 and 410 mean the key does not
+// exist and return ErrorNotFound; transport errors, 429 and 5xx responses are
+// retried with exponential backoff; any other status fails immediately.
+// As a nexuscache.Setter it writes values back with PUT {BaseURL}/{key}.
+type HTTP struct {
+	BaseURL      string
+	Client       *http.Client  // Its Timeout bounds a single attempt
+	Retries      int           // Extra attempts after the first one
+	RetryBackoff time.Duration // Wait before the first retry, doubled for each next one
+}
+
+// NewHTTP returns an HTTP origin for baseURL, a zero timeout uses DefaultHTTPTimeout
+func NewHTTP(baseURL string, timeout time.Duration, retries int) *HTTP {
+	if timeout <= 0 {
+		timeout = DefaultHTTPTimeout
+	}
+	return &HTTP{
+		BaseURL:      strings.TrimSuffix(baseURL, "/"),
+		Client:       &http.Client{Timeout: timeout},
+		Retries:      retries,
+		RetryBackoff: DefaultRetryBackoff,
+	}
+}
+
+func (h *HTTP) Get(key string) ([]byte, error) {
+	return h.retry(func() ([]byte, bool, error) { return h.get(key) })
+}
+
+// Set stores value with PUT {BaseURL}/{key}, retrying like Get. Any 2xx
+// status is a success.
+func (h *HTTP) Set(key string, value []byte) error {
+	_, err := h.retry(func() ([]byte, bool, error) { return h.put(key, value) })
+	return err
+}
+
+// retry calls attempt until it succeeds, fails for good or runs out of retries
+func (h *HTTP) retry(attempt func() (value []byte, retry bool, err error)) ([]byte, error) {
+	backoff := h.RetryBackoff
+	for i := 0; ; i++ {
+		value, retry, err := attempt()
+		if err == nil || !retry || i >= h.Retries {
+			return value, err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// do sends one request for key, retry tells whether a failure is worth retrying
+func (h *HTTP) do(method, key string, body []byte) (resp *http.Response, retry bool, err error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(context.Background(), method, h.BaseURL+"/"+url.PathEscape(key), reader)
+	if err != nil {
+		return nil, false, err
+	}
+	resp, err = h.Client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	return resp, false, nil
+}
+
+// retryable reports whether a status may succeed when asked again
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+func (h *HTTP) get(key string) (value []byte, retry bool, err error) {
+	resp, retry, err := h.do(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, retry, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		value, err = io.ReadAll(io.LimitReader(resp.Body, MaxValueBytes+1))
+		if err != nil {
+			return nil, true, err
+		}
+		if len(value) > MaxValueBytes {
+			return nil, false, fmt.Errorf("value of %s exceeds %d bytes", key, MaxValueBytes)
+		}
+		return value, false, nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return nil, false, errors.Wrapf(ErrorNotFound, "%s not exist", key)
+	}
+	return nil, retryable(resp.StatusCode), errors.Wrapf(ErrorOriginStatus, "GET %s: %s", key, resp.Status)
+}
+
+func (h *HTTP) put(key string, value []byte) ([]byte, bool, error) {
+	resp, retry, err := h.do(http.MethodPut, key, value)
+	if err != nil {
+		return nil, retry, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 == 2 {
+		return nil, false, nil
+	}
+	return nil, retryable(resp.StatusCode), errors.Wrapf(ErrorOriginStatus, "PUT %s: %s", key, resp.Status)
+}
@@ -0,0 +1,112 @@
+package origin
+
+import (
+	"NexusCache/config"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestHTTPOrigin(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		switch r.URL.EscapedPath() {
+		case "/users/a%2Fb":
+			w.Write([]byte("escaped"))
+		case "/users/Tom":
+			w.Write([]byte("630"))
+		case "/users/flaky":
+			if calls.Load() < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("recovered"))
+		case "/users/down":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/users/forbidden":
+			w.WriteHeader(http.StatusForbidden)
+		case "/users/slow":
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte("late"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	h := NewHTTP(srv.URL+"/users/", 50*time.Millisecond, 2)
+	h.RetryBackoff = time.Millisecond
+
+	for key, want := range map[string]string{"Tom": "630", "a/b": "escaped"} {
+		if v, err := h.Get(key); err != nil || string(v) != want {
+			t.Fatalf("get %s: %q %v", key, v, err)
+		}
+	}
+
+	calls.Store(0)
+	if _, err := h.Get("missing"); errors.Cause(err) != ErrorNotFound || calls.Load() != 1 {
+		t.Fatalf("404 should map to ErrorNotFound without retries, got %v after %d calls", err, calls.Load())
+	}
+	calls.Store(0)
+	if _, err := h.Get("forbidden"); errors.Cause(err) != ErrorOriginStatus || calls.Load() != 1 {
+		t.Fatalf("403 should fail without retries, got %v after %d calls", err, calls.Load())
+	}
+	calls.Store(0)
+	if v, err := h.Get("flaky"); err != nil || string(v) != "recovered" || calls.Load() != 3 {
+		t.Fatalf("5xx should be retried, got %q %v after %d calls", v, err, calls.Load())
+	}
+	calls.Store(0)
+	if _, err := h.Get("down"); errors.Cause(err) != ErrorOriginStatus || calls.Load() != 3 {
+		t.Fatalf("expected 1 attempt and 2 retries, got %v after %d calls", err, calls.Load())
+	}
+	if _, err := h.Get("slow"); err == nil {
+		t.Fatalf("requests slower than the timeout should fail")
+	}
+}
+
+func TestNewFromConfig(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+	getter, err := New(config.Origin{Type: config.OriginHTTP, URL: srv.URL + "/api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := getter.Get("k"); err != nil || string(v) != "/api/k" {
+		t.Fatalf("unexpected value %q %v", v, err)
+	}
+	if _, err := New(config.Origin{Type: "redis"}); err == nil {
+		t.Fatalf("unknown origin types should fail")
+	}
+}
+
+func TestHTTPOriginSet(t *testing.T) {
+	var attempts atomic.Int32
+	stored := make(map[string]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		stored[r.URL.Path] = string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	h := NewHTTP(srv.URL, time.Second, 1)
+	h.RetryBackoff = time.Millisecond
+
+	if err := h.Set("k", []byte("v")); err != nil || stored["/k"] != "v" || attempts.Load() != 2 {
+		t.Fatalf("expected the PUT to succeed on retry, got %v after %d attempts, stored %v", err, attempts.Load(), stored)
+	}
+}
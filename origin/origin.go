@@ -0,0 +1,85 @@
+// Package origin builds the Getters groups load missing keys from
+package origin
+
+import (
+	"NexusCache/config"
+	"NexusCache/lru"
+	"NexusCache/nexuscache"
+	"fmt"
+	"log"
+
+	"github.com/pkg/errors"
+)
+
+// ErrorNotFound is returned by loaders for keys missing from the origin. It is
+// nexuscache.ErrorNotFound, so that front-ends can tell a miss from a failure.
+var ErrorNotFound = nexuscache.ErrorNotFound
+
+// New returns the Getter described by cfg
+func New(cfg config.Origin) (nexuscache.Getter, error) {
+	switch cfg.Type {
+	case config.OriginStatic:
+		return Static(cfg.Data), nil
+	case config.OriginHTTP:
+		return NewHTTP(cfg.URL, cfg.Timeout, cfg.Retries), nil
+	case config.OriginFile:
+		return File{Dir: cfg.Dir}, nil
+	}
+	return nil, fmt.Errorf("unknown origin type %q", cfg.Type)
+}
+
+// Static serves keys from a fixed map, useful for demos and tests
+type Static map[string]string
+
+func (s Static) Get(key string) ([]byte, error) {
+	log.Printf("Searching \"%v\" from database", key)
+	if v, ok := s[key]; ok {
+		return []byte(v), nil
+	}
+	return nil, errors.Wrapf(ErrorNotFound, "%s not exist", key)
+}
+
+// NewGroup creates the group described by cfg
+func NewGroup(cfg config.GroupConfig) (*nexuscache.Group, error) {
+	getter, err := New(cfg.Origin)
+	if err != nil {
+		return nil, errors.Wrapf(err, "group %s", cfg.Name)
+	}
+	setter, writable := getter.(nexuscache.Setter)
+	w := cfg.Origin.Write
+	if w.Mode != "" && !writable {
+		return nil, fmt.Errorf("group %s: origin %s can't be written to", cfg.Name, cfg.Origin.Type)
+	}
+	g := nexuscache.NewGroup(cfg.Name, cfg.CacheBytes, cfg.HotCacheBytes, getter)
+	Configure(g, cfg)
+	switch w.Mode {
+	case config.WriteThrough:
+		g.SetWriteThrough(setter)
+	case config.WriteBehind:
+		g.SetWriteBehind(setter, nexuscache.WriteBehindOptions{
+			QueueSize:     w.QueueSize,
+			BatchSize:     w.BatchSize,
+			FlushInterval: w.FlushInterval,
+			Retries:       w.Retries,
+		})
+	}
+	return g, nil
+}
+
+// Configure applies the settings of cfg that may change while the group is
+// serving: capacities, TTL, expiry jitter and the origin load rate limit
+func Configure(g *nexuscache.Group, cfg config.GroupConfig) {
+	g.SetCacheBytes(cfg.CacheBytes, cfg.HotCacheBytes)
+	if cfg.PinnedBytes > 0 {
+		g.SetPinnedBytes(cfg.PinnedBytes)
+	} else {
+		g.SetPinnedBytes(int64(float64(cfg.CacheBytes) * lru.DefaultMaxPinnedRatio))
+	}
+	g.SetTTL(cfg.TTL)
+	if cfg.TTLJitter != nil {
+		g.SetExpireJitter(*cfg.TTLJitter)
+	} else {
+		g.SetExpireJitter(lru.DefaultExpireRandom)
+	}
+	g.SetLoadRateLimit(cfg.LoadRateLimit, cfg.LoadBurst)
+}
@@ -0,0 +1,129 @@
+package origin
+
+import (
+	"NexusCache/config"
+	"NexusCache/connect"
+	"NexusCache/nexuscache"
+	"context"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// GroupPrefix is the etcd prefix cluster-wide group definitions are stored under
+const GroupPrefix = "/nexuscache/groups/"
+
+var ErrorUnmanagedGroup = errors.New("group was not created from a definition")
+
+// PublishGroup stores the definition of a group in etcd, so that every node
+// watching GroupPrefix creates or updates the group
+func PublishGroup(ctx context.Context, etcd *connect.Etcd, cfg config.GroupConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	data, err := config.MarshalGroup(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = etcd.EtcdCli.Put(ctx, GroupPrefix+cfg.Name, string(data))
+	return err
+}
+
+// Registry keeps the groups of this node in line with their definitions,
+// whether they come from the config file or from etcd. Once a group is
+// defined in etcd, that definition is authoritative and the config file no
+// longer changes the group.
+type Registry struct {
+	mu     sync.Mutex
+	defs   map[string]config.GroupConfig // Definitions the groups were created or last updated from
+	shared map[string]bool               // Groups defined in etcd
+	peers  connect.PeerPicker            // Registered with every group created, may be nil
+}
+
+func NewRegistry(peers connect.PeerPicker) *Registry {
+	return &Registry{defs: make(map[string]config.GroupConfig), shared: make(map[string]bool), peers: peers}
+}
+
+// Apply creates the group described by def in the config file, or applies the
+// differences to the existing group and returns them. Changes that can't be
+// applied live, see config.Diff, are rejected and leave the group untouched.
+// Groups defined in etcd are left alone.
+func (r *Registry) Apply(def config.GroupConfig) ([]config.Change, error) {
+	return r.apply(def, false)
+}
+
+// ApplyShared is Apply for a definition published in etcd, which from then on
+// takes precedence over the config file
+func (r *Registry) ApplyShared(def config.GroupConfig) ([]config.Change, error) {
+	return r.apply(def, true)
+}
+
+func (r *Registry) apply(def config.GroupConfig, shared bool) ([]config.Change, error) {
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !shared && r.shared[def.Name] {
+		if !reflect.DeepEqual(r.defs[def.Name], def) {
+			log.Printf("group %s is defined in etcd, ignoring its definition in the config file", def.Name)
+		}
+		return nil, nil
+	}
+	old, ok := r.defs[def.Name]
+	if !ok {
+		if nexuscache.GetGroup(def.Name) != nil {
+			return nil, errors.Wrapf(ErrorUnmanagedGroup, "group %s", def.Name)
+		}
+		g, err := NewGroup(def)
+		if err != nil {
+			return nil, err
+		}
+		if r.peers != nil {
+			g.RegisterPeers(r.peers)
+		}
+		r.defs[def.Name] = def
+		r.shared[def.Name] = shared
+		log.Printf("group %s created", def.Name)
+		return nil, nil
+	}
+	changes, err := config.DiffGroup(old, def)
+	if err != nil {
+		return nil, err
+	}
+	Configure(nexuscache.GetGroup(def.Name), def)
+	r.defs[def.Name] = def
+	r.shared[def.Name] = r.shared[def.Name] || shared
+	return changes, nil
+}
+
+// Watch applies the group definitions stored in etcd and keeps following
+// them until ctx is done. A deleted definition is only logged: the group keeps
+// serving until the node restarts, as peers may still route keys to it.
+func (r *Registry) Watch(ctx context.Context, etcd *connect.Etcd) error {
+	return connect.WatchPrefix(ctx, etcd.EtcdCli, GroupPrefix, func(key string, value []byte, deleted bool) {
+		name := strings.TrimPrefix(key, GroupPrefix)
+		if deleted {
+			log.Printf("group %s definition removed, it keeps serving until restart", name)
+			return
+		}
+		def, err := config.ParseGroup(value)
+		if err == nil && def.Name != name {
+			err = errors.Errorf("definition stored under %s names group %s", key, def.Name)
+		}
+		var changes []config.Change
+		if err == nil {
+			changes, err = r.ApplyShared(def)
+		}
+		if err != nil {
+			log.Printf("group %s definition rejected: %v", name, err)
+			return
+		}
+		for _, c := range changes {
+			log.Printf("group %s updated: %s", name, c)
+		}
+	})
+}
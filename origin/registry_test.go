@@ -0,0 +1,77 @@
+package origin
+
+import (
+	"NexusCache/config"
+	"NexusCache/nexuscache"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestRegistryApply(t *testing.T) {
+	r := NewRegistry(nil)
+	def := config.GroupConfig{
+		Name:       "registry",
+		CacheBytes: 1 << 10,
+		Origin:     config.Origin{Type: config.OriginStatic, Data: map[string]string{"k": "v"}},
+	}
+	if _, err := r.Apply(def); err != nil {
+		t.Fatal(err)
+	}
+	g := nexuscache.GetGroup("registry")
+	if g == nil {
+		t.Fatalf("group should be created")
+	}
+	if v, err := g.Get("k"); err != nil || v.String() != "v" {
+		t.Fatalf("group should load from its origin, got %v %v", v, err)
+	}
+
+	def.TTL = time.Hour
+	changes, err := r.Apply(def)
+	if err != nil || len(changes) != 1 || changes[0].Field != "groups.registry.ttl" {
+		t.Fatalf("expected the ttl change, got %v %v", changes, err)
+	}
+	if nexuscache.GetGroup("registry") != g || g.TTL() != time.Hour {
+		t.Fatalf("the existing group should be updated in place")
+	}
+
+	def.Origin.Data = map[string]string{"k": "other"}
+	if _, err := r.Apply(def); errors.Cause(err) != config.ErrorUnsafeChange {
+		t.Fatalf("changing the origin should be rejected, got %v", err)
+	}
+	if v, _ := g.Get("k"); v.String() != "v" {
+		t.Fatalf("a rejected definition must not touch the group")
+	}
+
+	nexuscache.NewGroup("registry-unmanaged", 1<<10, 0, Static{})
+	if _, err := r.Apply(config.GroupConfig{Name: "registry-unmanaged", CacheBytes: 1, Origin: def.Origin}); errors.Cause(err) != ErrorUnmanagedGroup {
+		t.Fatalf("groups created elsewhere should not be redefined, got %v", err)
+	}
+}
+
+func TestRegistryPrefersEtcd(t *testing.T) {
+	r := NewRegistry(nil)
+	file := config.GroupConfig{
+		Name:       "registry-shared",
+		CacheBytes: 1 << 10,
+		TTL:        time.Minute,
+		Origin:     config.Origin{Type: config.OriginStatic, Data: map[string]string{"k": "v"}},
+	}
+	if _, err := r.Apply(file); err != nil {
+		t.Fatal(err)
+	}
+	shared := file
+	shared.TTL = time.Hour
+	if changes, err := r.ApplyShared(shared); err != nil || len(changes) != 1 {
+		t.Fatalf("expected the ttl change from etcd, got %v %v", changes, err)
+	}
+	// Reloading the config file, e.g. after an unrelated edit, must not
+	// revert the definition published in etcd
+	if changes, err := r.Apply(file); err != nil || len(changes) != 0 {
+		t.Fatalf("the file definition should be ignored, got %v %v", changes, err)
+	}
+	if ttl := nexuscache.GetGroup("registry-shared").TTL(); ttl != time.Hour {
+		t.Fatalf("expected the ttl from etcd, got %v", ttl)
+	}
+}
@@ -0,0 +1,116 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Limits on the requests a client may send
+const (
+	MaxArgs      = 1 << 20
+	MaxBulkBytes = 64 << 20
+)
+
+var ErrorProtocol = errors.New("protocol error")
+
+// readCommand reads one command, either a RESP array of bulk strings or an
+// inline command separated by spaces. Empty inline lines return no args.
+func readCommand(r *bufio.Reader) ([][]byte, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return bytes.Fields(line), nil
+	}
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > MaxArgs {
+		return nil, errors.Wrap(ErrorProtocol, "invalid multibulk length")
+	}
+	args := make([][]byte, 0, max(n, 0))
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errors.Wrapf(ErrorProtocol, "expected '$', got '%s'", line)
+		}
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 || size > MaxBulkBytes {
+			return nil, errors.Wrap(ErrorProtocol, "invalid bulk length")
+		}
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(r, arg); err != nil {
+			return nil, err
+		}
+		if arg[size] != '\r' || arg[size+1] != '\n' {
+			return nil, errors.Wrap(ErrorProtocol, "bulk string not terminated by CRLF")
+		}
+		args = append(args, arg[:size])
+	}
+	return args, nil
+}
+
+// readLine reads a line terminated by CRLF or a bare LF, without the terminator
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, errors.Wrap(ErrorProtocol, "line too long")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(line[:len(line)-1], []byte{'\r'}), nil
+}
+
+// writer encodes replies in the protocol version the client asked for with
+// HELLO. RESP2 has no null or map types: they are sent as a null bulk string
+// and as a flat array of keys and values.
+type writer struct {
+	*bufio.Writer
+	proto int
+}
+
+func (w *writer) line(prefix byte, s string) {
+	w.WriteByte(prefix)
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
+
+func (w *writer) simple(s string) { w.line('+', s) }
+
+func (w *writer) error(msg string) { w.line('-', msg) }
+
+func (w *writer) integer(n int64) { w.line(':', strconv.FormatInt(n, 10)) }
+
+func (w *writer) bulk(b []byte) {
+	w.line('$', strconv.Itoa(len(b)))
+	w.Write(b)
+	w.WriteString("\r\n")
+}
+
+func (w *writer) bulkString(s string) { w.bulk([]byte(s)) }
+
+func (w *writer) null() {
+	if w.proto >= 3 {
+		w.WriteString("_\r\n")
+		return
+	}
+	w.WriteString("$-1\r\n")
+}
+
+func (w *writer) array(n int) { w.line('*', strconv.Itoa(n)) }
+
+// mapHeader starts a map of n pairs, followed by the keys and values in turn
+func (w *writer) mapHeader(n int) {
+	if w.proto >= 3 {
+		w.line('%', strconv.Itoa(n))
+		return
+	}
+	w.array(2 * n)
+}
@@ -0,0 +1,418 @@
+// Package resp serves the cache over the Redis protocol, so that Redis
+// clients can read and write groups without a NexusCache client library.
+package resp
+
+import (
+	"NexusCache/nexuscache"
+	"NexusCache/node"
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// redisVersion is reported by HELLO and INFO, clients check it to pick the
+// commands they send
+const redisVersion = "7.0.0"
+
+// Server accepts RESP2 and RESP3 connections and maps the string commands of
+// Redis onto groups. Database i of SELECT is the group Groups[i]; SELECT also
+// takes a group name. With KeyPrefix set, a key "name:rest" addresses key
+// "rest" of group "name" whenever such a group exists.
+type Server struct {
+	Addr      string
+	Groups    []string
+	KeyPrefix bool
+
+	srv     node.ConnServer
+	started time.Time
+}
+
+func (s *Server) Start(ctx context.Context) error {
+	if len(s.Groups) == 0 {
+		return errors.New("resp server needs at least one group")
+	}
+	s.srv.Name, s.srv.Addr, s.srv.Handle = "resp", s.Addr, s.handle
+	s.started = time.Now()
+	return s.srv.Start(ctx)
+}
+
+// Shutdown stops accepting connections, closes the open ones and waits for
+// their commands to finish or ctx to be done
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+// BoundAddr returns the address the server listens on, "" when it is not running
+func (s *Server) BoundAddr() string {
+	return s.srv.BoundAddr()
+}
+
+// session is the state of one client connection
+type session struct {
+	*Server
+	w     *writer
+	group string // Group selected with SELECT
+	quit  bool
+}
+
+func (s *Server) handle(c net.Conn) {
+	r := bufio.NewReader(c)
+	ss := &session{Server: s, w: &writer{Writer: bufio.NewWriter(c), proto: 2}, group: s.Groups[0]}
+	for !ss.quit {
+		args, err := readCommand(r)
+		if err != nil {
+			if errors.Cause(err) == ErrorProtocol {
+				ss.w.error("ERR Protocol error: " + err.Error())
+				ss.w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		ss.exec(args)
+		// Pipelined commands are answered together
+		if r.Buffered() == 0 {
+			if err := ss.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+	ss.w.Flush()
+}
+
+// command runs a command on its arguments, args[0] being the command name
+type command struct {
+	arity int // Number of args including the name, negative for at least -arity
+	run   func(ss *session, args [][]byte)
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"PING":    {-1, (*session).ping},
+		"ECHO":    {2, func(ss *session, args [][]byte) { ss.w.bulk(args[1]) }},
+		"QUIT":    {1, (*session).quitCmd},
+		"HELLO":   {-1, (*session).hello},
+		"SELECT":  {2, (*session).selectCmd},
+		"GET":     {2, (*session).get},
+		"SET":     {-3, (*session).set},
+		"DEL":     {-2, (*session).del},
+		"MGET":    {-2, (*session).mget},
+		"MSET":    {-3, (*session).mset},
+		"EXISTS":  {-2, (*session).exists},
+		"TTL":     {2, func(ss *session, args [][]byte) { ss.ttl(args, time.Second) }},
+		"PTTL":    {2, func(ss *session, args [][]byte) { ss.ttl(args, time.Millisecond) }},
+		"INFO":    {-1, (*session).info},
+		"COMMAND": {-1, func(ss *session, args [][]byte) { ss.w.array(0) }},
+		"CLIENT":  {-2, func(ss *session, args [][]byte) { ss.w.simple("OK") }},
+	}
+}
+
+func (ss *session) exec(args [][]byte) {
+	name := strings.ToUpper(string(args[0]))
+	cmd, ok := commands[name]
+	if !ok {
+		ss.w.error(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		return
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		ss.w.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+		return
+	}
+	cmd.run(ss, args)
+}
+
+// resolve returns the group and the key within it addressed by key
+func (ss *session) resolve(key []byte) (*nexuscache.Group, string, error) {
+	k := string(key)
+	if ss.KeyPrefix {
+		if name, rest, ok := strings.Cut(k, ":"); ok && rest != "" {
+			if g := nexuscache.GetGroup(name); g != nil {
+				return g, rest, nil
+			}
+		}
+	}
+	g := nexuscache.GetGroup(ss.group)
+	if g == nil {
+		return nil, "", errors.Errorf("group %q not found", ss.group)
+	}
+	return g, k, nil
+}
+
+// replyError answers with the error of a failed group operation
+func (ss *session) replyError(err error) {
+	msg := strings.ReplaceAll(err.Error(), "\r\n", " ")
+	ss.w.error("ERR " + strings.ReplaceAll(msg, "\n", " "))
+}
+
+func isNotFound(err error) bool {
+	return errors.Cause(err) == nexuscache.ErrorNotFound
+}
+
+func (ss *session) ping(args [][]byte) {
+	switch len(args) {
+	case 1:
+		ss.w.simple("PONG")
+	case 2:
+		ss.w.bulk(args[1])
+	default:
+		ss.w.error("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func (ss *session) quitCmd(args [][]byte) {
+	ss.w.simple("OK")
+	ss.quit = true
+}
+
+// hello switches the protocol version and describes the server. AUTH is not
+// supported; SETNAME is accepted and ignored.
+func (ss *session) hello(args [][]byte) {
+	if len(args) > 1 {
+		proto, err := strconv.Atoi(string(args[1]))
+		if err != nil {
+			ss.w.error("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if proto != 2 && proto != 3 {
+			ss.w.error("NOPROTO unsupported protocol version")
+			return
+		}
+		for i := 2; i < len(args); i++ {
+			switch strings.ToUpper(string(args[i])) {
+			case "SETNAME":
+				if i+1 >= len(args) {
+					ss.w.error("ERR syntax error")
+					return
+				}
+				i++
+			case "AUTH":
+				ss.w.error("ERR AUTH is not supported")
+				return
+			default:
+				ss.w.error("ERR syntax error")
+				return
+			}
+		}
+		ss.w.proto = proto
+	}
+	ss.w.mapHeader(6)
+	ss.w.bulkString("server")
+	ss.w.bulkString("nexuscache")
+	ss.w.bulkString("version")
+	ss.w.bulkString(redisVersion)
+	ss.w.bulkString("proto")
+	ss.w.integer(int64(ss.w.proto))
+	ss.w.bulkString("mode")
+	ss.w.bulkString("standalone")
+	ss.w.bulkString("role")
+	ss.w.bulkString("master")
+	ss.w.bulkString("modules")
+	ss.w.array(0)
+}
+
+// selectCmd picks the group of later commands by index into Groups or by name
+func (ss *session) selectCmd(args [][]byte) {
+	arg := string(args[1])
+	if i, err := strconv.Atoi(arg); err == nil {
+		if i < 0 || i >= len(ss.Groups) {
+			ss.w.error("ERR DB index is out of range")
+			return
+		}
+		ss.group = ss.Groups[i]
+		ss.w.simple("OK")
+		return
+	}
+	if nexuscache.GetGroup(arg) == nil {
+		ss.w.error(fmt.Sprintf("ERR group '%s' not found", arg))
+		return
+	}
+	ss.group = arg
+	ss.w.simple("OK")
+}
+
+func (ss *session) get(args [][]byte) {
+	g, key, err := ss.resolve(args[1])
+	if err != nil {
+		ss.replyError(err)
+		return
+	}
+	view, err := g.Get(key)
+	switch {
+	case isNotFound(err):
+		ss.w.null()
+	case err != nil:
+		ss.replyError(err)
+	default:
+		ss.w.bulk(view.ByteSlice())
+	}
+}
+
+// set stores a value for the TTL given with EX or PX, the group's TTL without
+func (ss *session) set(args [][]byte) {
+	var ttl time.Duration
+	for i := 3; i < len(args); i++ {
+		opt := strings.ToUpper(string(args[i]))
+		if (opt != "EX" && opt != "PX") || ttl != 0 || i+1 >= len(args) {
+			ss.w.error("ERR syntax error")
+			return
+		}
+		i++
+		n, err := strconv.ParseInt(string(args[i]), 10, 64)
+		if err != nil {
+			ss.w.error("ERR value is not an integer or out of range")
+			return
+		}
+		if n <= 0 {
+			ss.w.error("ERR invalid expire time in 'set' command")
+			return
+		}
+		unit := time.Second
+		if opt == "PX" {
+			unit = time.Millisecond
+		}
+		ttl = time.Duration(n) * unit
+	}
+	g, key, err := ss.resolve(args[1])
+	if err != nil {
+		ss.replyError(err)
+		return
+	}
+	if err := setValue(g, key, args[2], ttl); err != nil {
+		ss.replyError(err)
+		return
+	}
+	ss.w.simple("OK")
+}
+
+func setValue(g *nexuscache.Group, key string, value []byte, ttl time.Duration) error {
+	if ttl == 0 {
+		ttl = g.TTL()
+	}
+	return g.Set(key, nexuscache.NewByteView(value, time.Now().Add(ttl)), false, false)
+}
+
+func (ss *session) del(args [][]byte) {
+	var n int64
+	for _, arg := range args[1:] {
+		g, key, err := ss.resolve(arg)
+		if err != nil {
+			ss.replyError(err)
+			return
+		}
+		deleted, err := g.Delete(key)
+		if err != nil {
+			ss.replyError(err)
+			return
+		}
+		if deleted {
+			n++
+		}
+	}
+	ss.w.integer(n)
+}
+
+// mget answers nil for keys that can't be read, like Redis does for keys
+// holding another type
+func (ss *session) mget(args [][]byte) {
+	ss.w.array(len(args) - 1)
+	for _, arg := range args[1:] {
+		g, key, err := ss.resolve(arg)
+		if err != nil {
+			ss.w.null()
+			continue
+		}
+		view, err := g.Get(key)
+		if err != nil {
+			if !isNotFound(err) {
+				log.Printf("resp: mget %s: %v", arg, err)
+			}
+			ss.w.null()
+			continue
+		}
+		ss.w.bulk(view.ByteSlice())
+	}
+}
+
+func (ss *session) mset(args [][]byte) {
+	if len(args)%2 == 0 {
+		ss.w.error("ERR wrong number of arguments for 'mset' command")
+		return
+	}
+	for i := 1; i < len(args); i += 2 {
+		g, key, err := ss.resolve(args[i])
+		if err == nil {
+			err = setValue(g, key, args[i+1], 0)
+		}
+		if err != nil {
+			ss.replyError(err)
+			return
+		}
+	}
+	ss.w.simple("OK")
+}
+
+// exists counts the keys that are cached, without loading missing ones
+func (ss *session) exists(args [][]byte) {
+	var n int64
+	for _, arg := range args[1:] {
+		g, key, err := ss.resolve(arg)
+		if err != nil {
+			ss.replyError(err)
+			return
+		}
+		_, err = g.Peek(key)
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			ss.replyError(err)
+			return
+		}
+		n++
+	}
+	ss.w.integer(n)
+}
+
+// ttl answers the remaining lifetime of a cached key in unit, -2 when it is
+// not cached. Every cached key expires, so -1 is never returned.
+func (ss *session) ttl(args [][]byte, unit time.Duration) {
+	g, key, err := ss.resolve(args[1])
+	if err != nil {
+		ss.replyError(err)
+		return
+	}
+	view, err := g.Peek(key)
+	if isNotFound(err) {
+		ss.w.integer(-2)
+		return
+	}
+	if err != nil {
+		ss.replyError(err)
+		return
+	}
+	left := max(time.Until(view.Expire()), 0)
+	ss.w.integer(int64((left + unit/2) / unit))
+}
+
+func (ss *session) info(args [][]byte) {
+	s := ss.Server
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Server\r\nredis_version:%s\r\nredis_mode:standalone\r\n", redisVersion)
+	fmt.Fprintf(&b, "uptime_in_seconds:%d\r\n", int64(time.Since(s.started).Seconds()))
+	fmt.Fprintf(&b, "\r\n# Clients\r\nconnected_clients:%d\r\n", s.srv.Conns())
+	b.WriteString("\r\n# Keyspace\r\n")
+	for i, name := range s.Groups {
+		fmt.Fprintf(&b, "db%d:group=%s\r\n", i, name)
+	}
+	ss.w.bulkString(b.String())
+}